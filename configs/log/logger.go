@@ -27,7 +27,7 @@ func (l *Logger) Debugf(ctx context.Context, format string, a ...interface{}) {
 	for k, v := range withCtx(ctx) {
 		evt = evt.Str(k, v)
 	}
-	evt.Msgf(format, a)
+	evt.Msgf(format, a...)
 }
 
 func (l *Logger) Info(ctx context.Context, msg string) {
@@ -43,7 +43,7 @@ func (l *Logger) Infof(ctx context.Context, format string, a ...interface{}) {
 	for k, v := range withCtx(ctx) {
 		evt = evt.Str(k, v)
 	}
-	evt.Msgf(format, a)
+	evt.Msgf(format, a...)
 }
 
 func (l *Logger) Warn(ctx context.Context, msg string) {
@@ -59,7 +59,7 @@ func (l *Logger) Warnf(ctx context.Context, format string, a ...interface{}) {
 	for k, v := range withCtx(ctx) {
 		evt = evt.Str(k, v)
 	}
-	evt.Msgf(format, a)
+	evt.Msgf(format, a...)
 }
 
 func (l *Logger) Error(ctx context.Context, msg string) {
@@ -71,11 +71,11 @@ func (l *Logger) Error(ctx context.Context, msg string) {
 }
 
 func (l *Logger) Errorf(ctx context.Context, format string, a ...interface{}) {
-	evt := l.Logger.Fatal()
+	evt := l.Logger.Error()
 	for k, v := range withCtx(ctx) {
 		evt = evt.Str(k, v)
 	}
-	evt.Msgf(format, a)
+	evt.Msgf(format, a...)
 }
 
 func (l *Logger) Fatal(ctx context.Context, msg string) {
@@ -91,7 +91,7 @@ func (l *Logger) Fatalf(ctx context.Context, format string, a ...interface{}) {
 	for k, v := range withCtx(ctx) {
 		evt = evt.Str(k, v)
 	}
-	evt.Msgf(format, a)
+	evt.Msgf(format, a...)
 }
 
 func (l *Logger) SetLevel(level string) {
@@ -5,4 +5,5 @@ import (
 	_ "github.com/aka-yz/go-micro-core/providers/redis"
 	_ "github.com/aka-yz/go-micro-core/providers/transport/grpc"
 	_ "github.com/aka-yz/go-micro-core/providers/transport/http"
+	_ "github.com/aka-yz/go-micro-core/providers/transport/mux"
 )
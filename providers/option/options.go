@@ -136,4 +136,42 @@ type HttpClientConfig struct {
 	MaxConnectionNum int
 	Timeout          time.Duration
 	Name             string
+	// Breaker/RateLimit 不为空时按 "METHOD host" 熔断, 按 host 限流
+	Breaker   *BreakerConfig
+	RateLimit *RateLimitConfig
+	// Auth 请求携带的凭证
+	Auth *CredentialsConfig
+}
+
+// BreakerConfig 熔断配置, 时间单位为秒, SlowCall 为毫秒, 0 使用默认值
+type BreakerConfig struct {
+	Window           int
+	Buckets          int
+	MinRequests      int
+	FailureRatio     float64
+	SlowCall         int
+	SlowRatio        float64
+	OpenTimeout      int
+	HalfOpenRequests int
+}
+
+// RateLimitConfig client 限流配置, Rate 为每秒请求数,
+// Wait 为 true 时等待令牌(不超过请求的 deadline), 否则直接拒绝
+type RateLimitConfig struct {
+	Rate  float64
+	Burst int
+	Wait  bool
+}
+
+// CredentialsConfig client 调用时携带的凭证, 同时配置时都会携带
+type CredentialsConfig struct {
+	APIKey string
+	HMAC   *HMACCredentials
+	// Token 静态的 bearer token
+	Token string
+}
+
+type HMACCredentials struct {
+	ID     string
+	Secret string
 }
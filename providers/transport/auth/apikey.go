@@ -0,0 +1,38 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+)
+
+type apiKeys struct {
+	// keys api key 的 sha256 -> 调用方
+	keys map[[sha256.Size]byte]*Principal
+}
+
+// NewAPIKeys authenticates by the static api key in APIKeyHeader
+func NewAPIKeys(keys map[string]*Principal) Authenticator {
+	a := &apiKeys{keys: make(map[[sha256.Size]byte]*Principal, len(keys))}
+	for key, p := range keys {
+		a.keys[sha256.Sum256([]byte(key))] = p
+	}
+	return a
+}
+
+func (a *apiKeys) Authenticate(ctx context.Context, r *Request) (*Principal, error) {
+	key := r.Header(APIKeyHeader)
+	if key == "" {
+		return nil, errNoCredentials
+	}
+
+	// 比较 hash, 避免通过比较时间猜测 key
+	sum := sha256.Sum256([]byte(key))
+	for k, p := range a.keys {
+		if subtle.ConstantTimeCompare(k[:], sum[:]) == 1 {
+			return &Principal{Subject: p.Subject, Scopes: p.Scopes, Method: "apikey"}, nil
+		}
+	}
+	return nil, errors.New("invalid api key")
+}
@@ -0,0 +1,142 @@
+// Package auth authenticates the service to service calls by api keys, hmac
+// signatures and jwt, and authorizes them by a per-method policy. The same
+// Auth is used by the grpc interceptors and the gin middleware.
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// 认证使用的 header, grpc metadata 中为小写
+const (
+	APIKeyHeader        = "x-api-key"
+	SignatureHeader     = "signature"
+	AuthorizationHeader = "authorization"
+	// PrincipalHeader 认证通过后 server 写入的调用方, 请求中携带的值会被删除
+	PrincipalHeader = "x-principal"
+)
+
+var (
+	ErrUnauthenticated  = errors.New("unauthenticated")
+	ErrPermissionDenied = errors.New("permission denied")
+	// errNoCredentials 请求中没有该认证方式的凭证, 继续尝试其他方式
+	errNoCredentials = errors.New("no credentials")
+)
+
+// Principal is the verified caller
+type Principal struct {
+	Subject string
+	Scopes  []string
+	// Method 认证方式: apikey, hmac, jwt
+	Method string
+}
+
+func (p *Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type principalKey struct{}
+
+func NewContext(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext returns the principal of the request, false for anonymous requests
+func FromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok
+}
+
+// Request is the part of a grpc or http request used by the authenticators
+type Request struct {
+	// Target grpc 为完整方法名 /pkg.Svc/Method, http 为 "GET /users/:id"
+	Target string
+	// Signed hmac 签名的请求, grpc 与 Target 相同, http 为 "GET /users/1?a=b"
+	Signed string
+	// Header 按名称取第一个值, 不区分大小写
+	Header func(key string) string
+	// Body http 请求的 body, 用于 hmac 签名, grpc 为空
+	Body []byte
+}
+
+// Authenticator verifies one kind of credentials, it returns errNoCredentials
+// when the request has none of its credentials
+type Authenticator interface {
+	Authenticate(ctx context.Context, r *Request) (*Principal, error)
+}
+
+// Auth authenticates by the first authenticator whose credentials are present,
+// then checks the policy
+type Auth struct {
+	authenticators []Authenticator
+	policy         *Policy
+
+	// refs FromConfig 返回的次数, 都 Close 后才释放, 由 sharedMu 保护
+	refs      int
+	release   func()
+	closeOnce sync.Once
+}
+
+func New(policy *Policy, authenticators ...Authenticator) *Auth {
+	if policy == nil {
+		policy = &Policy{}
+	}
+	return &Auth{authenticators: authenticators, policy: policy}
+}
+
+// Close stops the background work of the authenticators, such as the jwks
+// refresh. An Auth shared by FromConfig is closed by the last caller.
+func (a *Auth) Close() error {
+	sharedMu.Lock()
+	if a.refs > 1 {
+		a.refs--
+		sharedMu.Unlock()
+		return nil
+	}
+	a.refs = 0
+	if a.release != nil {
+		a.release()
+		a.release = nil
+	}
+	sharedMu.Unlock()
+
+	a.closeOnce.Do(func() {
+		for _, authenticator := range a.authenticators {
+			if c, ok := authenticator.(io.Closer); ok {
+				_ = c.Close()
+			}
+		}
+	})
+	return nil
+}
+
+// Authenticate returns the principal of the request, nil when the anonymous
+// request is allowed. The errors wrap ErrUnauthenticated or ErrPermissionDenied.
+func (a *Auth) Authenticate(ctx context.Context, r *Request) (*Principal, error) {
+	var p *Principal
+	for _, authenticator := range a.authenticators {
+		var err error
+		p, err = authenticator.Authenticate(ctx, r)
+		if err == errNoCredentials {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrUnauthenticated, err)
+		}
+		break
+	}
+
+	if err := a.policy.Check(r.Target, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
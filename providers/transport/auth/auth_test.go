@@ -0,0 +1,162 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aka-yz/go-micro-core/providers/option"
+	"github.com/golang-jwt/jwt/v4"
+	"go.uber.org/config"
+)
+
+func request(target string, headers map[string]string, body []byte) *Request {
+	return &Request{
+		Target: target,
+		Signed: target,
+		Header: func(key string) string { return headers[key] },
+		Body:   body,
+	}
+}
+
+func TestAuth(t *testing.T) {
+	dir := t.TempDir()
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	jwks := fmt.Sprintf(`{"keys":[{"kty":"RSA","kid":"k1","use":"sig","n":%q,"e":%q}]}`,
+		base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()))
+	if err := ioutil.WriteFile(filepath.Join(dir, "jwks.json"), []byte(jwks), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	yaml := fmt.Sprintf(`
+auth:
+  apikeys:
+    - key: secret-key
+      subject: order
+      scopes: [user.read]
+  hmac:
+    keys:
+      - id: pay
+        secret: pay-secret
+  jwt:
+    jwks: %s
+    issuer: test
+  policy:
+    methods:
+      /user.User/*:
+        scopes: [user.read]
+      /user.User/Delete:
+        callers: [admin]
+      GET /health:
+        anonymous: true
+`, filepath.Join(dir, "jwks.json"))
+	conf, err := config.NewYAML(config.Source(strings.NewReader(yaml)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := FromConfig(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// grpc 和 http server 从同一份配置获取的是同一个 Auth
+	shared, err := FromConfig(conf)
+	if err != nil || shared != a {
+		t.Fatalf("auth not shared: %v", err)
+	}
+	shared.Close()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"sub": "admin", "iss": "test", "scope": "user.read", "exp": time.Now().Add(time.Minute).Unix(),
+	})
+	token.Header["kid"] = "k1"
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	noExp := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{"sub": "admin", "iss": "test", "scope": "user.read"})
+	noExp.Header["kid"] = "k1"
+	signedNoExp, err := noExp.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayed := Sign("pay", "pay-secret", "/pay.Pay/Get", nil, time.Now())
+
+	ctx := context.Background()
+	for _, c := range []struct {
+		name    string
+		target  string
+		headers map[string]string
+		subject string
+		err     error
+	}{
+		{"api key", "/user.User/Get", map[string]string{APIKeyHeader: "secret-key"}, "order", nil},
+		{"wrong api key", "/user.User/Get", map[string]string{APIKeyHeader: "wrong"}, "", ErrUnauthenticated},
+		{"caller not allowed", "/user.User/Delete", map[string]string{APIKeyHeader: "secret-key"}, "", ErrPermissionDenied},
+		{"no scope", "/user.User/Get", map[string]string{SignatureHeader: Sign("pay", "pay-secret", "/user.User/Get", nil, time.Now())}, "", ErrPermissionDenied},
+		{"hmac", "/pay.Pay/Get", map[string]string{SignatureHeader: Sign("pay", "pay-secret", "/pay.Pay/Get", nil, time.Now())}, "pay", nil},
+		{"hmac other target", "/pay.Pay/Put", map[string]string{SignatureHeader: Sign("pay", "pay-secret", "/pay.Pay/Get", nil, time.Now())}, "", ErrUnauthenticated},
+		{"hmac expired", "/pay.Pay/Get", map[string]string{SignatureHeader: Sign("pay", "pay-secret", "/pay.Pay/Get", nil, time.Now().Add(-time.Hour))}, "", ErrUnauthenticated},
+		{"hmac", "/pay.Pay/Get", map[string]string{SignatureHeader: replayed}, "pay", nil},
+		{"hmac replayed", "/pay.Pay/Get", map[string]string{SignatureHeader: replayed}, "", ErrUnauthenticated},
+		{"hmac no nonce", "/pay.Pay/Get", map[string]string{SignatureHeader: strings.Replace(replayed, "nonce=", "x=", 1)}, "", ErrUnauthenticated},
+		{"jwt", "/user.User/Delete", map[string]string{AuthorizationHeader: "Bearer " + signed}, "admin", nil},
+		{"jwt no exp", "/user.User/Delete", map[string]string{AuthorizationHeader: "Bearer " + signedNoExp}, "", ErrUnauthenticated},
+		{"health", "/grpc.health.v1.Health/Check", nil, "", nil},
+		{"anonymous", "GET /health", nil, "", nil},
+		{"no credentials", "/pay.Pay/Get", nil, "", ErrUnauthenticated},
+	} {
+		p, err := a.Authenticate(ctx, request(c.target, c.headers, nil))
+		if c.err != nil {
+			if !errors.Is(err, c.err) {
+				t.Fatalf("%s: unexpected err %v", c.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if (p == nil && c.subject != "") || (p != nil && p.Subject != c.subject) {
+			t.Fatalf("%s: unexpected principal %+v", c.name, p)
+		}
+	}
+
+	// 全部 Close 后再获取是新的 Auth
+	a.Close()
+	if renewed, err := FromConfig(conf); err != nil || renewed == a {
+		t.Fatalf("closed auth reused: %v", err)
+	} else {
+		renewed.Close()
+	}
+
+	for _, bad := range []string{
+		"auth: {apikeys: [{key: k}]}",
+		"auth: {hmac: {keys: [{id: pay}]}}",
+		"auth: {jwt: {issuer: test}}",
+		"auth: {apikeys: 1}",
+	} {
+		conf, err := config.NewYAML(config.Source(strings.NewReader(bad)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := FromConfig(conf); err == nil {
+			t.Errorf("%s should fail", bad)
+		}
+	}
+
+	// signer 生成的 header 可以通过认证
+	s := NewSigner(option.CredentialsConfig{HMAC: &option.HMACCredentials{ID: "pay", Secret: "pay-secret"}})
+	body := []byte(`{"id":1}`)
+	if p, err := a.Authenticate(ctx, request("POST /pay", s.Headers("POST /pay", body), body)); err != nil || p.Subject != "pay" {
+		t.Fatalf("signer: %v %+v", err, p)
+	}
+}
@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/config"
+)
+
+// ConfigKey server 认证和授权的配置, grpc 和 http server 共用
+const ConfigKey = "auth"
+
+// Config auth 的 yaml 配置, 时间单位为秒
+type Config struct {
+	APIKeys []*apiKeyConfig
+	HMAC    *hmacConfig
+	JWT     *jwtConfig
+	Policy  *Policy
+}
+
+type apiKeyConfig struct {
+	Key     string
+	Subject string
+	Scopes  []string
+}
+
+type hmacConfig struct {
+	Skew int
+	Keys []*hmacKeyConfig
+}
+
+type hmacKeyConfig struct {
+	ID      string
+	Secret  string
+	Subject string
+	Scopes  []string
+}
+
+type jwtConfig struct {
+	JWKS     string
+	Issuer   string
+	Audience string
+	Refresh  int
+	// AllowNoExp 允许没有 exp 的 token
+	AllowNoExp bool
+}
+
+var (
+	sharedMu sync.Mutex
+	// shared 同一份配置创建的 server 共用一个 Auth, hmac 的 nonce 在各协议间共享,
+	// 一个 nonce 不能在 grpc 和 http 上各使用一次
+	shared = make(map[config.Provider]*Auth)
+)
+
+// FromConfig returns nil when auth is not configured. The servers built from
+// the same config share one Auth, each of them calls Close when it stops.
+func FromConfig(conf config.Provider) (*Auth, error) {
+	cv := conf.Get(ConfigKey)
+	if !cv.HasValue() {
+		return nil, nil
+	}
+
+	sharedMu.Lock()
+	defer sharedMu.Unlock()
+	if a, ok := shared[conf]; ok {
+		a.refs++
+		return a, nil
+	}
+
+	var cfg Config
+	if err := cv.Populate(&cfg); err != nil {
+		return nil, fmt.Errorf("auth config error:%v", err)
+	}
+	a, err := cfg.New()
+	if err != nil {
+		return nil, err
+	}
+	a.refs = 1
+	a.release = func() { delete(shared, conf) }
+	shared[conf] = a
+	return a, nil
+}
+
+// New builds the authenticators in the order of api key, hmac and jwt
+func (c *Config) New() (*Auth, error) {
+	var authenticators []Authenticator
+	if len(c.APIKeys) > 0 {
+		keys := make(map[string]*Principal, len(c.APIKeys))
+		for _, k := range c.APIKeys {
+			if k.Key == "" || k.Subject == "" {
+				return nil, fmt.Errorf("auth config error: api key and subject required")
+			}
+			keys[k.Key] = &Principal{Subject: k.Subject, Scopes: k.Scopes}
+		}
+		authenticators = append(authenticators, NewAPIKeys(keys))
+	}
+
+	if h := c.HMAC; h != nil && len(h.Keys) > 0 {
+		keys := make(map[string]*HMACKey, len(h.Keys))
+		for _, k := range h.Keys {
+			if k.ID == "" || k.Secret == "" {
+				return nil, fmt.Errorf("auth config error: hmac key id and secret required")
+			}
+			subject := k.Subject
+			if subject == "" {
+				subject = k.ID
+			}
+			keys[k.ID] = &HMACKey{Secret: k.Secret, Principal: &Principal{Subject: subject, Scopes: k.Scopes}}
+		}
+		authenticators = append(authenticators, NewHMAC(keys, time.Second*time.Duration(h.Skew)))
+	}
+
+	if j := c.JWT; j != nil {
+		if j.JWKS == "" {
+			return nil, fmt.Errorf("auth config error: jwt jwks required")
+		}
+		authenticators = append(authenticators, NewJWT(JWTOptions{
+			JWKS:       j.JWKS,
+			Issuer:     j.Issuer,
+			Audience:   j.Audience,
+			Refresh:    time.Second * time.Duration(j.Refresh),
+			AllowNoExp: j.AllowNoExp,
+		}))
+	}
+	return New(c.Policy, authenticators...), nil
+}
@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+
+	errs "github.com/aka-yz/go-micro-core/providers/transport/errors"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+)
+
+// MaxSignedBody hmac 签名请求 body 的最大长度, 签名校验需要读入整个 body
+var MaxSignedBody int64 = 4 << 20
+
+// GinMiddleware authenticates the http requests, the target is "METHOD route",
+// e.g. "GET /users/:id". It responds 401/403 with the problem json of the gin codec.
+func GinMiddleware(a *Auth) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		r := c.Request
+		r.Header.Del(PrincipalHeader)
+
+		var body []byte
+		if r.Header.Get(SignatureHeader) != "" && r.Body != nil {
+			var err error
+			if body, err = ioutil.ReadAll(http.MaxBytesReader(c.Writer, r.Body, MaxSignedBody)); err != nil {
+				abort(c, errs.New(codes.InvalidArgument, "INVALID_BODY", err.Error()))
+				return
+			}
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		}
+
+		route := c.FullPath()
+		if route == "" {
+			route = r.URL.Path
+		}
+		p, err := a.Authenticate(r.Context(), &Request{
+			Target: r.Method + " " + route,
+			Signed: r.Method + " " + r.URL.RequestURI(),
+			Header: r.Header.Get,
+			Body:   body,
+		})
+		if err != nil {
+			if errors.Is(err, ErrPermissionDenied) {
+				abort(c, errs.New(codes.PermissionDenied, "PERMISSION_DENIED", err.Error()))
+			} else {
+				abort(c, errs.New(codes.Unauthenticated, "UNAUTHENTICATED", err.Error()))
+			}
+			return
+		}
+
+		if p != nil {
+			r.Header.Set(PrincipalHeader, p.Subject)
+			c.Request = r.WithContext(NewContext(r.Context(), p))
+		}
+		c.Next()
+	}
+}
+
+func abort(c *gin.Context, err *errs.Error) {
+	c.Abort()
+	_ = errs.WriteHTTP(c.Writer, err)
+}
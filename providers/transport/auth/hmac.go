@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultSignatureSkew 签名时间与当前时间允许的最大差距
+var DefaultSignatureSkew = 5 * time.Minute
+
+// HMACKey is a shared secret of a caller
+type HMACKey struct {
+	Secret    string
+	Principal *Principal
+}
+
+type hmacAuth struct {
+	keys map[string]*HMACKey
+	skew time.Duration
+	// seen 签名有效期内已经使用过的 nonce, 拒绝重放的请求
+	seen nonceCache
+}
+
+// NewHMAC authenticates by the hmac-sha256 signature in SignatureHeader, the
+// header is "keyid=<id>,timestamp=<unix seconds>,nonce=<hex>,signature=<hex>", see Sign.
+// keys are keyed by the key id, skew 0 uses DefaultSignatureSkew. A nonce is
+// accepted once within the skew, so every request needs a new signature.
+func NewHMAC(keys map[string]*HMACKey, skew time.Duration) Authenticator {
+	if skew <= 0 {
+		skew = DefaultSignatureSkew
+	}
+	return &hmacAuth{keys: keys, skew: skew}
+}
+
+// Sign returns the SignatureHeader value with a random nonce, target is the Signed of Request.
+// The signed string is target + "\n" + timestamp + "\n" + nonce + "\n" + hex(sha256(body)).
+func Sign(keyID, secret, target string, body []byte, now time.Time) string {
+	ts := strconv.FormatInt(now.Unix(), 10)
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	nonce := hex.EncodeToString(b)
+	return fmt.Sprintf("keyid=%s,timestamp=%s,nonce=%s,signature=%s", keyID, ts, nonce, signature(secret, target, ts, nonce, body))
+}
+
+func signature(secret, target, ts, nonce string, body []byte) string {
+	bodySum := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(target + "\n" + ts + "\n" + nonce + "\n" + hex.EncodeToString(bodySum[:])))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (a *hmacAuth) Authenticate(ctx context.Context, r *Request) (*Principal, error) {
+	header := r.Header(SignatureHeader)
+	if header == "" {
+		return nil, errNoCredentials
+	}
+
+	fields := make(map[string]string, 3)
+	for _, kv := range strings.Split(header, ",") {
+		if i := strings.Index(kv, "="); i > 0 {
+			fields[strings.TrimSpace(kv[:i])] = strings.TrimSpace(kv[i+1:])
+		}
+	}
+	key, ok := a.keys[fields["keyid"]]
+	if !ok {
+		return nil, fmt.Errorf("unknown signature key:%s", fields["keyid"])
+	}
+	ts, err := strconv.ParseInt(fields["timestamp"], 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid signature timestamp")
+	}
+	now := time.Now()
+	if d := now.Sub(time.Unix(ts, 0)); d > a.skew || d < -a.skew {
+		return nil, errors.New("signature expired")
+	}
+	nonce := fields["nonce"]
+	if nonce == "" {
+		return nil, errors.New("signature nonce required")
+	}
+
+	want := signature(key.Secret, r.Signed, fields["timestamp"], nonce, r.Body)
+	if !hmac.Equal([]byte(want), []byte(fields["signature"])) {
+		return nil, errors.New("invalid signature")
+	}
+	// 签名校验通过后才记录 nonce, 保留到签名过期
+	if !a.seen.add(fields["keyid"]+"/"+nonce, now, time.Unix(ts, 0).Add(a.skew)) {
+		return nil, errors.New("signature replayed")
+	}
+	return &Principal{Subject: key.Principal.Subject, Scopes: key.Principal.Scopes, Method: "hmac"}, nil
+}
+
+// nonceCache 记录 nonce 到过期时间, 添加时顺带清理过期的 nonce
+type nonceCache struct {
+	sync.Mutex
+	expires map[string]time.Time
+	// next 下次清理的时间
+	next time.Time
+}
+
+// add 返回 false 表示 nonce 在过期之前已经使用过
+func (c *nonceCache) add(nonce string, now, expire time.Time) bool {
+	c.Lock()
+	defer c.Unlock()
+	if c.expires == nil {
+		c.expires = make(map[string]time.Time)
+	}
+	if now.After(c.next) {
+		for k, t := range c.expires {
+			if now.After(t) {
+				delete(c.expires, k)
+			}
+		}
+		c.next = now.Add(time.Minute)
+	}
+
+	if t, ok := c.expires[nonce]; ok && !now.After(t) {
+		return false
+	}
+	c.expires[nonce] = expire
+	return true
+}
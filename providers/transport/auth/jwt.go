@@ -0,0 +1,290 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aka-yz/go-micro-core/configs/log"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+var (
+	// DefaultJWKSRefresh 重新加载 jwks 的间隔
+	DefaultJWKSRefresh = 5 * time.Minute
+	// jwksMinInterval 遇到未知 kid 时重新加载 jwks 的最小间隔
+	jwksMinInterval = time.Minute
+	jwksHTTPTimeout = 10 * time.Second
+)
+
+// JWTOptions of the jwt authenticator
+type JWTOptions struct {
+	// JWKS jwks 的文件路径或 http(s) 地址
+	JWKS string
+	// Issuer/Audience 不为空时校验 iss/aud
+	Issuer   string
+	Audience string
+	// Refresh 重新加载 jwks 的间隔, 0 使用 DefaultJWKSRefresh
+	Refresh time.Duration
+	// AllowNoExp 允许没有 exp 的 token, 默认拒绝
+	AllowNoExp bool
+}
+
+type jwtAuth struct {
+	opts JWTOptions
+
+	sync.RWMutex
+	keys   map[string]crypto.PublicKey
+	loaded time.Time
+	// loading 不为空时正在加载, 同时遇到未知 kid 的请求等待同一次加载
+	loading chan struct{}
+
+	exit      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewJWT authenticates by the bearer token in AuthorizationHeader, verified by
+// the keys of the jwks. The subject is the sub claim, the scopes are the
+// space separated scope claim or the scp array. The authenticator is an
+// io.Closer, Close stops refreshing the jwks.
+func NewJWT(opts JWTOptions) Authenticator {
+	if opts.Refresh <= 0 {
+		opts.Refresh = DefaultJWKSRefresh
+	}
+	a := &jwtAuth{opts: opts, exit: make(chan struct{})}
+	// 加载失败时请求认证失败, 之后定时重试
+	if err := a.load(); err != nil {
+		log.Errorf(context.TODO(), "jwks:%s load error:%v", opts.JWKS, err)
+	}
+	go a.refresh()
+	return a
+}
+
+func (a *jwtAuth) refresh() {
+	ticker := time.NewTicker(a.opts.Refresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-a.exit:
+			return
+		case <-ticker.C:
+		}
+		if err := a.reload(0); err != nil {
+			log.Errorf(context.TODO(), "jwks:%s load error:%v", a.opts.JWKS, err)
+		}
+	}
+}
+
+func (a *jwtAuth) Close() error {
+	a.closeOnce.Do(func() { close(a.exit) })
+	return nil
+}
+
+// reload 距离上次加载超过 minInterval 时加载 jwks, 已经在加载时等待其结束.
+// 同一时间只有一次加载
+func (a *jwtAuth) reload(minInterval time.Duration) error {
+	a.Lock()
+	if loading := a.loading; loading != nil {
+		a.Unlock()
+		<-loading
+		return nil
+	}
+	if time.Since(a.loaded) < minInterval {
+		a.Unlock()
+		return nil
+	}
+	loading := make(chan struct{})
+	a.loading = loading
+	a.Unlock()
+
+	err := a.load()
+	a.Lock()
+	a.loading = nil
+	a.Unlock()
+	close(loading)
+	return err
+}
+
+func (a *jwtAuth) load() error {
+	var data []byte
+	var err error
+	if strings.HasPrefix(a.opts.JWKS, "http://") || strings.HasPrefix(a.opts.JWKS, "https://") {
+		data, err = fetch(a.opts.JWKS)
+	} else {
+		data, err = ioutil.ReadFile(a.opts.JWKS)
+	}
+	a.Lock()
+	a.loaded = time.Now()
+	a.Unlock()
+	if err != nil {
+		return err
+	}
+
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return err
+	}
+	a.Lock()
+	a.keys = keys
+	a.Unlock()
+	return nil
+}
+
+func fetch(url string) ([]byte, error) {
+	client := http.Client{Timeout: jwksHTTPTimeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("http code:%v", resp.StatusCode)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+func (a *jwtAuth) key(kid string) (crypto.PublicKey, error) {
+	a.RLock()
+	key, ok := a.keys[kid]
+	a.RUnlock()
+	if ok {
+		return key, nil
+	}
+
+	// 签名 key 轮换后可能还没有加载, 每 jwksMinInterval 最多加载一次
+	if err := a.reload(jwksMinInterval); err != nil {
+		return nil, err
+	}
+	a.RLock()
+	key, ok = a.keys[kid]
+	a.RUnlock()
+	if ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key id:%s", kid)
+}
+
+func (a *jwtAuth) Authenticate(ctx context.Context, r *Request) (*Principal, error) {
+	header := r.Header(AuthorizationHeader)
+	if len(header) < 7 || !strings.EqualFold(header[:7], "bearer ") {
+		return nil, errNoCredentials
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(strings.TrimSpace(header[7:]), claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return a.key(kid)
+	}, jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}))
+	if err != nil {
+		return nil, err
+	}
+	// MapClaims 只在有 exp 时校验, 没有 exp 的 token 永不过期
+	if _, ok := claims["exp"]; !ok && !a.opts.AllowNoExp {
+		return nil, errors.New("token has no exp")
+	}
+	if a.opts.Issuer != "" && !claims.VerifyIssuer(a.opts.Issuer, true) {
+		return nil, errors.New("invalid token issuer")
+	}
+	if a.opts.Audience != "" && !claims.VerifyAudience(a.opts.Audience, true) {
+		return nil, errors.New("invalid token audience")
+	}
+
+	p := &Principal{Method: "jwt"}
+	p.Subject, _ = claims["sub"].(string)
+	if scope, ok := claims["scope"].(string); ok {
+		p.Scopes = strings.Fields(scope)
+	}
+	if scp, ok := claims["scp"].([]interface{}); ok {
+		for _, s := range scp {
+			if s, ok := s.(string); ok {
+				p.Scopes = append(p.Scopes, s)
+			}
+		}
+	}
+	return p, nil
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// parseJWKS 解析 RSA 和 EC 公钥, 跳过其他类型和加密用的 key
+func parseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		switch k.Kty {
+		case "RSA":
+			n, err := decodeBig(k.N)
+			if err != nil {
+				return nil, err
+			}
+			e, err := decodeBig(k.E)
+			if err != nil {
+				return nil, err
+			}
+			keys[k.Kid] = &rsa.PublicKey{N: n, E: int(e.Int64())}
+		case "EC":
+			var curve elliptic.Curve
+			switch k.Crv {
+			case "P-256":
+				curve = elliptic.P256()
+			case "P-384":
+				curve = elliptic.P384()
+			case "P-521":
+				curve = elliptic.P521()
+			default:
+				continue
+			}
+			x, err := decodeBig(k.X)
+			if err != nil {
+				return nil, err
+			}
+			y, err := decodeBig(k.Y)
+			if err != nil {
+				return nil, err
+			}
+			keys[k.Kid] = &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no signing key in jwks")
+	}
+	return keys, nil
+}
+
+func decodeBig(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Rule of the callers and scopes allowed to call a method
+type Rule struct {
+	// Callers 允许的调用方 Subject, 为空时不限制
+	Callers []string
+	// Scopes 调用方需要拥有全部 scope
+	Scopes []string
+	// Anonymous 允许没有凭证的请求, 携带了错误凭证的请求仍然拒绝
+	Anonymous bool
+}
+
+// Policy 按方法的授权规则. Methods 的 key 为完整方法名 /pkg.Svc/Method 或 "GET /users/:id",
+// 以 * 结尾时按前缀匹配, 如 /pkg.Svc/*. 没有匹配的规则时, 健康检查和反射服务允许匿名调用,
+// 其他使用 Default, Default 为空时只要求通过认证
+type Policy struct {
+	Default *Rule
+	Methods map[string]*Rule
+}
+
+// anonymousServices 默认允许匿名调用的 grpc 服务, Methods 中可以覆盖
+var anonymousServices = []string{
+	"/grpc.health.v1.Health/",
+	"/grpc.reflection.v1alpha.ServerReflection/",
+	"/grpc.reflection.v1.ServerReflection/",
+}
+
+func (p *Policy) rule(target string) *Rule {
+	if r, ok := p.Methods[target]; ok {
+		return r
+	}
+
+	// 最长的前缀优先
+	var rule *Rule
+	var longest int
+	for key, r := range p.Methods {
+		prefix := strings.TrimSuffix(key, "*")
+		if len(prefix) == len(key) || !strings.HasPrefix(target, prefix) {
+			continue
+		}
+		if rule == nil || len(prefix) > longest {
+			rule, longest = r, len(prefix)
+		}
+	}
+	if rule != nil {
+		return rule
+	}
+	for _, prefix := range anonymousServices {
+		if strings.HasPrefix(target, prefix) {
+			return &Rule{Anonymous: true}
+		}
+	}
+	if p.Default != nil {
+		return p.Default
+	}
+	return &Rule{}
+}
+
+// Check authorizes the principal, nil principal is an anonymous request
+func (p *Policy) Check(target string, principal *Principal) error {
+	rule := p.rule(target)
+	if principal == nil {
+		if rule.Anonymous {
+			return nil
+		}
+		return fmt.Errorf("%w: no credentials for %s", ErrUnauthenticated, target)
+	}
+
+	if len(rule.Callers) > 0 {
+		var allowed bool
+		for _, caller := range rule.Callers {
+			if caller == principal.Subject {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("%w: caller:%s is not allowed to call %s", ErrPermissionDenied, principal.Subject, target)
+		}
+	}
+	for _, scope := range rule.Scopes {
+		if !principal.HasScope(scope) {
+			return fmt.Errorf("%w: caller:%s has no scope:%s for %s", ErrPermissionDenied, principal.Subject, scope, target)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/aka-yz/go-micro-core/providers/option"
+)
+
+// Signer adds the credentials to the client requests
+type Signer struct {
+	cfg option.CredentialsConfig
+}
+
+func NewSigner(cfg option.CredentialsConfig) *Signer {
+	return &Signer{cfg: cfg}
+}
+
+// Headers returns the credential headers of the request, target and body are
+// the Signed and Body of Request
+func (s *Signer) Headers(target string, body []byte) map[string]string {
+	headers := make(map[string]string, 3)
+	if s.cfg.APIKey != "" {
+		headers[APIKeyHeader] = s.cfg.APIKey
+	}
+	if h := s.cfg.HMAC; h != nil {
+		headers[SignatureHeader] = Sign(h.ID, h.Secret, target, body, time.Now())
+	}
+	if s.cfg.Token != "" {
+		headers[AuthorizationHeader] = "Bearer " + s.cfg.Token
+	}
+	return headers
+}
@@ -0,0 +1,298 @@
+// Package breaker is a circuit breaker with a sliding window of error
+// and slow call ratios, shared by the rpc and http clients
+package breaker
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrOpen is returned by Allow when the breaker rejects the call
+var ErrOpen = errors.New("circuit breaker is open")
+
+type State int
+
+const (
+	Closed State = iota
+	Open
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// 默认值
+var (
+	DefaultWindow           = 10 * time.Second
+	DefaultBuckets          = 10
+	DefaultMinRequests      = 20
+	DefaultFailureRatio     = 0.5
+	DefaultOpenTimeout      = 30 * time.Second
+	DefaultHalfOpenRequests = 5
+)
+
+// Hook is called when the state of a breaker changes, outside the lock of the breaker.
+// Hooks of different changes may run concurrently
+type Hook func(name string, from, to State)
+
+// Options of the breaker, zero values use the defaults
+type Options struct {
+	// Window 统计窗口, 分为 Buckets 个桶滑动
+	Window  time.Duration
+	Buckets int
+	// MinRequests 窗口内请求数达到后才判断比例
+	MinRequests int
+	// FailureRatio 失败比例达到后打开
+	FailureRatio float64
+	// SlowCall 超过该耗时的请求为慢请求, SlowRatio 慢请求比例达到后打开, 0 不检查
+	SlowCall  time.Duration
+	SlowRatio float64
+	// OpenTimeout 打开后经过该时间进入半开
+	OpenTimeout time.Duration
+	// HalfOpenRequests 半开时允许的探测请求数, 全部成功后关闭
+	HalfOpenRequests int
+	Hooks            []Hook
+	// Now 当前时间, 默认 time.Now, 测试时替换
+	Now func() time.Time
+}
+
+func (o Options) withDefaults() Options {
+	if o.Window <= 0 {
+		o.Window = DefaultWindow
+	}
+	if o.Buckets <= 0 {
+		o.Buckets = DefaultBuckets
+	}
+	if o.MinRequests <= 0 {
+		o.MinRequests = DefaultMinRequests
+	}
+	if o.FailureRatio <= 0 {
+		o.FailureRatio = DefaultFailureRatio
+	}
+	if o.OpenTimeout <= 0 {
+		o.OpenTimeout = DefaultOpenTimeout
+	}
+	if o.HalfOpenRequests <= 0 {
+		o.HalfOpenRequests = DefaultHalfOpenRequests
+	}
+	if o.Now == nil {
+		o.Now = time.Now
+	}
+	return o
+}
+
+type bucket struct {
+	start                   time.Time
+	total, failures, slowed int
+}
+
+// Breaker is a circuit breaker with closed, open and half-open states
+type Breaker struct {
+	name string
+	opts Options
+
+	mu      sync.Mutex
+	state   State
+	buckets []bucket
+	// openedAt 打开的时间, 用于进入半开
+	openedAt time.Time
+	// probes/successes 半开时已放行和已成功的探测请求
+	probes, successes int
+	// generation 每次状态变化加一, 请求结束时不是放行时的 generation 则忽略结果
+	generation uint64
+	// changes 锁内发生的状态变化, 解锁后执行 hook
+	changes []change
+}
+
+type change struct {
+	from, to State
+}
+
+func New(name string, opts Options) *Breaker {
+	o := opts.withDefaults()
+	return &Breaker{
+		name:    name,
+		opts:    o,
+		buckets: make([]bucket, o.Buckets),
+	}
+}
+
+func (b *Breaker) Name() string {
+	return b.name
+}
+
+// State returns the current state
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.unlock()
+	b.tick(b.opts.Now())
+	return b.state
+}
+
+// Allow checks whether the call is allowed, the returned func must be called
+// with the result of the call
+func (b *Breaker) Allow() (func(failed bool, elapsed time.Duration), error) {
+	b.mu.Lock()
+	defer b.unlock()
+
+	b.tick(b.opts.Now())
+	switch b.state {
+	case Open:
+		return nil, ErrOpen
+	case HalfOpen:
+		if b.probes >= b.opts.HalfOpenRequests {
+			return nil, ErrOpen
+		}
+		b.probes++
+	}
+
+	var once sync.Once
+	generation := b.generation
+	return func(failed bool, elapsed time.Duration) {
+		once.Do(func() {
+			b.done(generation, failed, elapsed)
+		})
+	}, nil
+}
+
+func (b *Breaker) done(generation uint64, failed bool, elapsed time.Duration) {
+	b.mu.Lock()
+	defer b.unlock()
+
+	now := b.opts.Now()
+	b.tick(now)
+	// 放行后状态已经变化, 如关闭时放行的请求在半开时结束, 不能算作探测结果
+	if generation != b.generation {
+		return
+	}
+	slow := b.opts.SlowCall > 0 && elapsed >= b.opts.SlowCall
+
+	switch b.state {
+	case HalfOpen:
+		if failed || slow {
+			b.setState(Open, now)
+			return
+		}
+		if b.successes++; b.successes >= b.opts.HalfOpenRequests {
+			b.setState(Closed, now)
+		}
+	case Closed:
+		bk := b.bucket(now)
+		bk.total++
+		if failed {
+			bk.failures++
+		}
+		if slow {
+			bk.slowed++
+		}
+		b.check(now)
+	}
+}
+
+// tick 打开超时后进入半开
+func (b *Breaker) tick(now time.Time) {
+	if b.state == Open && now.Sub(b.openedAt) >= b.opts.OpenTimeout {
+		b.setState(HalfOpen, now)
+	}
+}
+
+// check 窗口内的比例超过阈值时打开
+func (b *Breaker) check(now time.Time) {
+	var total, failures, slowed int
+	for _, bk := range b.buckets {
+		if now.Sub(bk.start) < b.opts.Window {
+			total += bk.total
+			failures += bk.failures
+			slowed += bk.slowed
+		}
+	}
+	if total < b.opts.MinRequests {
+		return
+	}
+	if float64(failures)/float64(total) >= b.opts.FailureRatio ||
+		(b.opts.SlowRatio > 0 && float64(slowed)/float64(total) >= b.opts.SlowRatio) {
+		b.setState(Open, now)
+	}
+}
+
+// bucket 返回当前时间所在的桶, 过期的桶会被重置
+func (b *Breaker) bucket(now time.Time) *bucket {
+	width := b.opts.Window / time.Duration(b.opts.Buckets)
+	start := now.Truncate(width)
+	bk := &b.buckets[int(start.UnixNano()/int64(width))%len(b.buckets)]
+	if !bk.start.Equal(start) {
+		*bk = bucket{start: start}
+	}
+	return bk
+}
+
+func (b *Breaker) setState(state State, now time.Time) {
+	from := b.state
+	if from == state {
+		return
+	}
+	b.state = state
+	b.generation++
+	b.probes, b.successes = 0, 0
+	switch state {
+	case Open:
+		b.openedAt = now
+	case Closed:
+		for i := range b.buckets {
+			b.buckets[i] = bucket{}
+		}
+	}
+
+	b.changes = append(b.changes, change{from: from, to: state})
+}
+
+// unlock 解锁后按顺序执行锁内状态变化的 hook
+func (b *Breaker) unlock() {
+	changes := b.changes
+	b.changes = nil
+	b.mu.Unlock()
+
+	for _, c := range changes {
+		for _, hook := range b.opts.Hooks {
+			hook(b.name, c.from, c.to)
+		}
+	}
+}
+
+// Group holds the breakers by name, created on first use with the same options
+type Group struct {
+	opts     Options
+	breakers sync.Map
+}
+
+func NewGroup(opts Options) *Group {
+	return &Group{opts: opts}
+}
+
+func (g *Group) Get(name string) *Breaker {
+	if b, ok := g.breakers.Load(name); ok {
+		return b.(*Breaker)
+	}
+	b, _ := g.breakers.LoadOrStore(name, New(name, g.opts))
+	return b.(*Breaker)
+}
+
+// States returns the state of the breakers by name
+func (g *Group) States() map[string]State {
+	states := make(map[string]State)
+	g.breakers.Range(func(key, value interface{}) bool {
+		states[key.(string)] = value.(*Breaker).State()
+		return true
+	})
+	return states
+}
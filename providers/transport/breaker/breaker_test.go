@@ -0,0 +1,117 @@
+package breaker
+
+import (
+	"testing"
+	"time"
+)
+
+// clock 测试用的时间, Add 前进
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+func (c *clock) Add(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func TestBreaker(t *testing.T) {
+	var changes []State
+	c := &clock{now: time.Now()}
+	b := New("test", Options{
+		MinRequests:      4,
+		FailureRatio:     0.5,
+		OpenTimeout:      50 * time.Millisecond,
+		HalfOpenRequests: 2,
+		Hooks:            []Hook{func(name string, from, to State) { changes = append(changes, to) }},
+		Now:              c.Now,
+	})
+
+	for i := 0; i < 4; i++ {
+		done, err := b.Allow()
+		if err != nil {
+			t.Fatal(err)
+		}
+		done(i%2 == 0, time.Millisecond)
+	}
+	if b.State() != Open {
+		t.Fatalf("unexpected state %v", b.State())
+	}
+	if _, err := b.Allow(); err != ErrOpen {
+		t.Fatalf("unexpected err %v", err)
+	}
+
+	// 半开只放行 HalfOpenRequests 个请求, 全部成功后关闭
+	c.Add(60 * time.Millisecond)
+	d1, err1 := b.Allow()
+	d2, err2 := b.Allow()
+	if _, err := b.Allow(); err1 != nil || err2 != nil || err != ErrOpen {
+		t.Fatalf("unexpected half-open errors %v %v %v", err1, err2, err)
+	}
+	d1(false, time.Millisecond)
+	d2(false, time.Millisecond)
+	if b.State() != Closed {
+		t.Fatalf("unexpected state %v", b.State())
+	}
+
+	want := []State{Open, HalfOpen, Closed}
+	if len(changes) != len(want) {
+		t.Fatalf("unexpected changes %v", changes)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Fatalf("unexpected changes %v", changes)
+		}
+	}
+}
+
+func TestBreakerGeneration(t *testing.T) {
+	c := &clock{now: time.Now()}
+	var b *Breaker
+	b = New("generation", Options{
+		MinRequests:      2,
+		OpenTimeout:      time.Second,
+		HalfOpenRequests: 1,
+		// hook 在锁外执行, 调用 State 不会死锁
+		Hooks: []Hook{func(name string, from, to State) { b.State() }},
+		Now:   c.Now,
+	})
+
+	// 关闭时放行的请求在半开时才结束, 不算作探测成功
+	slow, _ := b.Allow()
+	for i := 0; i < 2; i++ {
+		done, _ := b.Allow()
+		done(true, time.Millisecond)
+	}
+	c.Add(time.Second)
+	if b.State() != HalfOpen {
+		t.Fatalf("unexpected state %v", b.State())
+	}
+	slow(false, time.Millisecond)
+	if b.State() != HalfOpen {
+		t.Fatalf("stale call closed the breaker: %v", b.State())
+	}
+
+	probe, err := b.Allow()
+	if err != nil {
+		t.Fatal(err)
+	}
+	probe(false, time.Millisecond)
+	if b.State() != Closed {
+		t.Fatalf("unexpected state %v", b.State())
+	}
+}
+
+func TestSlowCall(t *testing.T) {
+	b := New("slow", Options{MinRequests: 2, SlowCall: 10 * time.Millisecond, SlowRatio: 0.5})
+	for i := 0; i < 2; i++ {
+		done, _ := b.Allow()
+		done(false, 20*time.Millisecond)
+	}
+	if b.State() != Open {
+		t.Fatalf("unexpected state %v", b.State())
+	}
+}
@@ -0,0 +1,50 @@
+package breaker
+
+import (
+	"context"
+	"expvar"
+	stdlog "log"
+	"time"
+
+	"github.com/aka-yz/go-micro-core/configs/log"
+	"github.com/aka-yz/go-micro-core/providers/option"
+)
+
+var (
+	// states expvar circuit_breaker_state: name -> 当前状态
+	states = expvar.NewMap("circuit_breaker_state")
+	// transitions expvar circuit_breaker_transitions: "name to" -> 次数
+	transitions = expvar.NewMap("circuit_breaker_transitions")
+)
+
+// LogHook logs the state changes, with the standard logger when the logger is not configured
+func LogHook(name string, from, to State) {
+	if l := log.GetInstance(); l != nil {
+		l.Warnf(context.Background(), "circuit breaker:%s state:%s -> %s", name, from, to)
+		return
+	}
+	stdlog.Printf("circuit breaker:%s state:%s -> %s", name, from, to)
+}
+
+// MetricsHook exports the states and transition counts by expvar
+func MetricsHook(name string, from, to State) {
+	s := new(expvar.String)
+	s.Set(to.String())
+	states.Set(name, s)
+	transitions.Add(name+" "+to.String(), 1)
+}
+
+// ConfigOptions converts the yaml config, with the log and metrics hooks
+func ConfigOptions(c *option.BreakerConfig) Options {
+	return Options{
+		Window:           time.Second * time.Duration(c.Window),
+		Buckets:          c.Buckets,
+		MinRequests:      c.MinRequests,
+		FailureRatio:     c.FailureRatio,
+		SlowCall:         time.Millisecond * time.Duration(c.SlowCall),
+		SlowRatio:        c.SlowRatio,
+		OpenTimeout:      time.Second * time.Duration(c.OpenTimeout),
+		HalfOpenRequests: c.HalfOpenRequests,
+		Hooks:            []Hook{LogHook, MetricsHook},
+	}
+}
@@ -0,0 +1,157 @@
+// Package discovery builds the registry and the registered service
+// shared by the rpc and http servers from the "registry" config
+package discovery
+
+import (
+	"fmt"
+	registry "github.com/aka-yz/go-micro-core/register"
+	"github.com/aka-yz/go-micro-core/register/cache"
+	"github.com/aka-yz/go-micro-core/register/dns"
+	"github.com/aka-yz/go-micro-core/register/etcdv3"
+	"github.com/aka-yz/go-micro-core/register/mdns"
+	"github.com/aka-yz/go-micro-core/register/static"
+	"github.com/aka-yz/go-micro-core/utils/uuid"
+	"go.uber.org/config"
+	"os"
+	"time"
+)
+
+// Config registry 配置
+type Config struct {
+	// Type etcdv3(default), static, dns, mdns
+	Type        string
+	Addrs       []string
+	RegistryTTL int
+	Name        string
+	// Services static/dns 的服务表 name -> [addr...]
+	Services map[string][]string
+	// Interval dns 重新解析的间隔(秒)
+	Interval int
+	// Timeout dns 解析和 mdns 浏览时等待回复的时间(毫秒), 0 为默认值: dns 5s, mdns 100ms
+	Timeout int
+	// Cache 不为空时在 registry 外加一层缓存
+	Cache *CacheConfig
+}
+
+type CacheConfig struct {
+	// TTL 缓存有效期(秒)
+	TTL int
+	// MaxStale registry 不可用时最多返回多旧的数据(秒), 0 不限制
+	MaxStale int
+}
+
+// GetConfig 读取 registry 配置, 未配置时返回 nil, 配置错误时返回 error
+func GetConfig(conf config.Provider) (*Config, error) {
+	var cv config.Value
+	if cv = conf.Get("registry"); !cv.HasValue() {
+		return nil, nil
+	}
+
+	var cfg Config
+	if err := cv.Populate(&cfg); err != nil {
+		return nil, fmt.Errorf("registry config: %w", err)
+	}
+
+	if cfg.RegistryTTL == 0 {
+		cfg.RegistryTTL = 30
+	}
+
+	return &cfg, nil
+}
+
+// Etcd type 为 etcdv3 时 Addrs 是 etcd 地址
+func (c *Config) Etcd() bool {
+	switch c.Type {
+	case "static", "dns", "mdns":
+		return false
+	}
+	return true
+}
+
+// NewRegistry 根据 type 创建 registry, 用完后由创建者调用 registry.Stop 释放
+func NewRegistry(cfg *Config) (registry.Registry, error) {
+	r, err := newBackendRegistry(cfg)
+	if err != nil || r == nil || cfg.Cache == nil {
+		return r, err
+	}
+
+	var opts []cache.Option
+	if cfg.Cache.TTL != 0 {
+		opts = append(opts, cache.WithTTL(time.Second*time.Duration(cfg.Cache.TTL)))
+	}
+	if cfg.Cache.MaxStale != 0 {
+		opts = append(opts, cache.WithMaxStale(time.Second*time.Duration(cfg.Cache.MaxStale)))
+	}
+	return cache.New(r, opts...), nil
+}
+
+func newBackendRegistry(cfg *Config) (registry.Registry, error) {
+	opts := []registry.Option{
+		registry.Addrs(cfg.Addrs...),
+		registry.Timeout(time.Second * time.Duration(cfg.RegistryTTL)),
+	}
+
+	switch cfg.Type {
+	case "static":
+		return static.NewRegistry(append(opts, static.Services(cfg.Services))...)
+	case "dns":
+		// 解析超时与 registryttl 无关, 否则 resolver 没有响应时刷新会卡住一个 ttl
+		dopts := []registry.Option{
+			dns.Services(cfg.Services),
+			dns.Interval(time.Second * time.Duration(cfg.Interval)),
+		}
+		if cfg.Timeout > 0 {
+			dopts = append(dopts, registry.Timeout(time.Millisecond*time.Duration(cfg.Timeout)))
+		}
+		return dns.NewRegistry(dopts...), nil
+	case "mdns":
+		// addrs 为组播地址, 浏览超时与 registryttl 无关
+		mopts := []registry.Option{registry.Addrs(cfg.Addrs...)}
+		if cfg.Timeout > 0 {
+			mopts = append(mopts, registry.Timeout(time.Millisecond*time.Duration(cfg.Timeout)))
+		}
+		return mdns.NewRegistry(mopts...), nil
+	default:
+		return etcdv3.NewRegistry(opts...), nil
+	}
+}
+
+// NewService 当前服务的注册信息, name + suffix 区分不同协议
+func NewService(conf config.Provider, suffix string) *registry.Service {
+	var service registry.Service
+	service.Name = conf.Get("name").String() + suffix
+	service.Version = envValue(conf, "VERSION", "version")
+	service.Nodes = make([]*registry.Node, 1)
+	service.Nodes[0] = &registry.Node{
+		Id: uuid.New(),
+	}
+
+	// 注册节点所在的 zone/region, 用于就近路由
+	zone, region := Locality(conf)
+	if zone != "" || region != "" {
+		service.Nodes[0].Metadata = make(map[string]string)
+		if zone != "" {
+			service.Nodes[0].Metadata[registry.ZoneKey] = zone
+		}
+		if region != "" {
+			service.Nodes[0].Metadata[registry.RegionKey] = region
+		}
+	}
+	return &service
+}
+
+// Locality 当前进程所在的 zone 和 region, 环境变量 ZONE/REGION 优先, 其次是配置中的 zone/region
+func Locality(conf config.Provider) (zone, region string) {
+	return envValue(conf, "ZONE", "zone"), envValue(conf, "REGION", "region")
+}
+
+// envValue 环境变量优先, 其次是配置
+func envValue(conf config.Provider, env, key string) string {
+	if v := os.Getenv(env); v != "" {
+		return v
+	}
+	if cv := conf.Get(key); cv.HasValue() {
+		return cv.String()
+	}
+	return ""
+}
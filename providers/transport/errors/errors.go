@@ -0,0 +1,161 @@
+// Package errors is the error model shared by the grpc and http transports.
+// An Error maps to a grpc status with errdetails and to an http status with a
+// problem json body, and both decode back to the same Error.
+package errors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// Error is a typed error. Code is the grpc code, Reason is a stable machine
+// readable reason such as USER_NOT_FOUND. The cause is only kept in the process,
+// it is not sent to the caller.
+type Error struct {
+	Code      codes.Code
+	Reason    string
+	Message   string
+	Metadata  map[string]string
+	Retryable bool
+
+	cause error
+}
+
+func New(code codes.Code, reason, message string) *Error {
+	return &Error{Code: code, Reason: reason, Message: message}
+}
+
+func Newf(code codes.Code, reason, format string, a ...interface{}) *Error {
+	return New(code, reason, fmt.Sprintf(format, a...))
+}
+
+// Wrap returns an Error with the cause
+func Wrap(cause error, code codes.Code, reason, message string) *Error {
+	return &Error{Code: code, Reason: reason, Message: message, cause: cause}
+}
+
+func (e *Error) Error() string {
+	s := fmt.Sprintf("code:%s reason:%s message:%s", e.Code, e.Reason, e.Message)
+	if e.cause != nil {
+		s += " cause:" + e.cause.Error()
+	}
+	return s
+}
+
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+// Is matches the errors with the same code and reason, so the sentinel errors
+// work with errors.Is after crossing the transport
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code && t.Reason == e.Reason
+}
+
+// WithMetadata returns a copy with the key value pairs added
+func (e *Error) WithMetadata(kv ...string) *Error {
+	c := e.clone()
+	c.Metadata = make(map[string]string, len(e.Metadata)+len(kv)/2)
+	for k, v := range e.Metadata {
+		c.Metadata[k] = v
+	}
+	for i := 0; i+1 < len(kv); i += 2 {
+		c.Metadata[kv[i]] = kv[i+1]
+	}
+	return c
+}
+
+// WithRetryable returns a copy marked as retryable or not
+func (e *Error) WithRetryable(retryable bool) *Error {
+	c := e.clone()
+	c.Retryable = retryable
+	return c
+}
+
+// WithCause returns a copy with the cause
+func (e *Error) WithCause(cause error) *Error {
+	c := e.clone()
+	c.cause = cause
+	return c
+}
+
+func (e *Error) clone() *Error {
+	c := *e
+	return &c
+}
+
+// GRPCStatus carries the reason and metadata by ErrorInfo, the retryable flag by RetryInfo
+func (e *Error) GRPCStatus() *status.Status {
+	s := status.New(e.Code, e.Message)
+	details := []proto.Message{&errdetails.ErrorInfo{Reason: e.Reason, Metadata: e.Metadata}}
+	if e.Retryable {
+		details = append(details, &errdetails.RetryInfo{RetryDelay: durationpb.New(0)})
+	}
+	for _, d := range details {
+		if ds, err := s.WithDetails(d); err == nil {
+			s = ds
+		}
+	}
+	return s
+}
+
+// FromError converts any error to an Error: an Error in the chain, a grpc status
+// with details, or a context error. Other errors are Unknown with the error as cause.
+func FromError(err error) *Error {
+	if err == nil {
+		return nil
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	if s, ok := status.FromError(err); ok {
+		return FromStatus(s)
+	}
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return Wrap(err, codes.DeadlineExceeded, "", err.Error())
+	case errors.Is(err, context.Canceled):
+		return Wrap(err, codes.Canceled, "", err.Error())
+	}
+	return Wrap(err, codes.Unknown, "", err.Error())
+}
+
+// FromStatus decodes the ErrorInfo and RetryInfo details
+func FromStatus(s *status.Status) *Error {
+	e := New(s.Code(), "", s.Message())
+	for _, d := range s.Details() {
+		switch d := d.(type) {
+		case *errdetails.ErrorInfo:
+			e.Reason = d.Reason
+			e.Metadata = d.Metadata
+		case *errdetails.RetryInfo:
+			e.Retryable = true
+		}
+	}
+	return e
+}
+
+// Code returns the code of the error, OK for nil
+func Code(err error) codes.Code {
+	if err == nil {
+		return codes.OK
+	}
+	return FromError(err).Code
+}
+
+// Reason returns the reason of the error, empty for the errors without reason
+func Reason(err error) string {
+	if err == nil {
+		return ""
+	}
+	return FromError(err).Reason
+}
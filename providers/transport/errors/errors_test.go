@@ -0,0 +1,70 @@
+package errors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var errUserNotFound = New(codes.NotFound, "USER_NOT_FOUND", "user not found")
+
+func TestStatusRoundTrip(t *testing.T) {
+	err := fmt.Errorf("get user: %w", errUserNotFound.WithMetadata("id", "42").WithRetryable(true))
+
+	// grpc 用 status 传输, 客户端收到的是 status error
+	s, ok := status.FromError(FromError(err))
+	if !ok || s.Code() != codes.NotFound {
+		t.Fatalf("status: %v", s)
+	}
+	got := FromError(s.Err())
+	if !errors.Is(got, errUserNotFound) {
+		t.Fatalf("errors.Is failed: %v", got)
+	}
+	if got.Metadata["id"] != "42" || !got.Retryable || got.Message != "user not found" {
+		t.Fatalf("got %+v", got)
+	}
+}
+
+func TestHTTPRoundTrip(t *testing.T) {
+	w := httptest.NewRecorder()
+	_ = WriteHTTP(w, errUserNotFound.WithMetadata("id", "42"))
+	if w.Code != http.StatusNotFound || w.Header().Get("Content-Type") != ProblemContentType {
+		t.Fatalf("code:%d content-type:%s", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	got := FromResponse(w.Result())
+	if !errors.Is(got, errUserNotFound) || got.Metadata["id"] != "42" {
+		t.Fatalf("got %+v", got)
+	}
+
+	// 非 problem 的响应使用 http status
+	if c := FromHTTP(http.StatusServiceUnavailable, []byte("oops"), "oops").Code; c != codes.Unavailable {
+		t.Fatalf("code: %v", c)
+	}
+}
+
+func TestFromError(t *testing.T) {
+	cases := []struct {
+		err  error
+		code codes.Code
+	}{
+		{context.DeadlineExceeded, codes.DeadlineExceeded},
+		{context.Canceled, codes.Canceled},
+		{status.Error(codes.Unavailable, "down"), codes.Unavailable},
+		{errors.New("plain"), codes.Unknown},
+	}
+	for _, c := range cases {
+		if got := Code(c.err); got != c.code {
+			t.Errorf("%v: got %v want %v", c.err, got, c.code)
+		}
+	}
+	if Code(nil) != codes.OK {
+		t.Errorf("nil should be OK")
+	}
+}
@@ -0,0 +1,172 @@
+package errors
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+)
+
+// ProblemContentType http 错误响应的 Content-Type
+const ProblemContentType = "application/problem+json"
+
+// Problem is the json body of the http error response (RFC 7807)
+type Problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail"`
+	// Code grpc code 名称, 如 NOT_FOUND
+	Code      string            `json:"code"`
+	Reason    string            `json:"reason,omitempty"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	Retryable bool              `json:"retryable,omitempty"`
+	// Message 与 Detail 相同, 兼容之前 {"code", "message"} 格式的调用方
+	Message string `json:"message"`
+}
+
+// 与 grpc-gateway 相同的映射
+var httpStatus = map[codes.Code]int{
+	codes.OK:                 http.StatusOK,
+	codes.Canceled:           499,
+	codes.Unknown:            http.StatusInternalServerError,
+	codes.InvalidArgument:    http.StatusBadRequest,
+	codes.DeadlineExceeded:   http.StatusGatewayTimeout,
+	codes.NotFound:           http.StatusNotFound,
+	codes.AlreadyExists:      http.StatusConflict,
+	codes.PermissionDenied:   http.StatusForbidden,
+	codes.ResourceExhausted:  http.StatusTooManyRequests,
+	codes.FailedPrecondition: http.StatusBadRequest,
+	codes.Aborted:            http.StatusConflict,
+	codes.OutOfRange:         http.StatusBadRequest,
+	codes.Unimplemented:      http.StatusNotImplemented,
+	codes.Internal:           http.StatusInternalServerError,
+	codes.Unavailable:        http.StatusServiceUnavailable,
+	codes.DataLoss:           http.StatusInternalServerError,
+	codes.Unauthenticated:    http.StatusUnauthorized,
+}
+
+// HTTPStatus returns the http status of the grpc code
+func HTTPStatus(code codes.Code) int {
+	if s, ok := httpStatus[code]; ok {
+		return s
+	}
+	return http.StatusInternalServerError
+}
+
+// CodeFromHTTPStatus 没有 problem body 的响应按 http status 得到 code
+func CodeFromHTTPStatus(s int) codes.Code {
+	switch s {
+	case http.StatusOK:
+		return codes.OK
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.Aborted
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case 499:
+		return codes.Canceled
+	case http.StatusNotImplemented:
+		return codes.Unimplemented
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	}
+	return codes.Unknown
+}
+
+// codeNames code 的大写名称, 如 NOT_FOUND
+var codeNames = map[codes.Code]string{}
+
+func init() {
+	for c := codes.OK; c <= codes.Unauthenticated; c++ {
+		name := c.String()
+		var b strings.Builder
+		for i, r := range name {
+			if i > 0 && r >= 'A' && r <= 'Z' {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r)
+		}
+		codeNames[c] = strings.ToUpper(b.String())
+	}
+	// String() 为 OK, 不需要加下划线
+	codeNames[codes.OK] = "OK"
+}
+
+func (e *Error) Problem() *Problem {
+	s := HTTPStatus(e.Code)
+	return &Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(s),
+		Status:    s,
+		Detail:    e.Message,
+		Code:      codeNames[e.Code],
+		Reason:    e.Reason,
+		Metadata:  e.Metadata,
+		Retryable: e.Retryable,
+		Message:   e.Message,
+	}
+}
+
+// Error decodes the problem, the code comes from the code name or the http status
+func (p *Problem) Error() *Error {
+	code := CodeFromHTTPStatus(p.Status)
+	for c, name := range codeNames {
+		if name == p.Code {
+			code = c
+			break
+		}
+	}
+	message := p.Detail
+	if message == "" {
+		message = p.Message
+	}
+	return &Error{Code: code, Reason: p.Reason, Message: message, Metadata: p.Metadata, Retryable: p.Retryable}
+}
+
+// WriteHTTP writes the error as a problem json response
+func WriteHTTP(w http.ResponseWriter, err error) error {
+	p := FromError(err).Problem()
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(p.Status)
+	return json.NewEncoder(w).Encode(p)
+}
+
+// FromResponse decodes the error of a response whose status is not 2xx, the body
+// is read but not closed
+func FromResponse(resp *http.Response) *Error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	msg := fmt.Sprintf("http code:%v", resp.StatusCode)
+	if resp.Request != nil {
+		msg += fmt.Sprintf(" url:%v", resp.Request.URL)
+	}
+	return FromHTTP(resp.StatusCode, body, msg)
+}
+
+// FromHTTP decodes the problem body, the bodies that are not a problem use the
+// http status and the message
+func FromHTTP(statusCode int, body []byte, message string) *Error {
+	var p Problem
+	if json.Unmarshal(body, &p) == nil && p.Code != "" {
+		if p.Status == 0 {
+			p.Status = statusCode
+		}
+		return p.Error()
+	}
+	return New(CodeFromHTTPStatus(statusCode), "", message)
+}
@@ -2,26 +2,36 @@ package gin
 
 import (
 	"encoding/json"
+	errs "github.com/aka-yz/go-micro-core/providers/transport/errors"
 	"github.com/golang/protobuf/jsonpb"
 	"github.com/golang/protobuf/proto"
-	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
 	"net/http"
 	"strings"
 )
 
+// defaultCodec 错误默认返回 200 和 {"code", "message"}, code 为 grpc 错误信息中 ": " 之前的部分.
+// problem 为 true 时按 grpc code 返回 http status 和 problem json, 见 WithProblemErrors
 type defaultCodec struct {
+	problem bool
 }
 
 func (c defaultCodec) Encode(r *http.Request, w http.ResponseWriter, v interface{}) error {
+	if err, _ := v.(error); err != nil && c.problem {
+		return errs.WriteHTTP(w, err)
+	}
+
 	w.Header().Set("Content-type", "application/json")
 	w.WriteHeader(200)
 
 	if err, _ := v.(error); err != nil {
 		var code, message string
-		parts := strings.Split(grpc.ErrorDesc(err), ": ")
+		parts := strings.Split(status.Convert(err).Message(), ": ")
 		if len(parts) > 1 {
 			code = strings.TrimSpace(parts[0])
 			message = strings.TrimSpace(strings.Join(parts[1:], ": "))
+		} else if e, ok := err.(*errs.Error); ok {
+			message = e.Message
 		} else {
 			message = err.Error()
 		}
@@ -0,0 +1,41 @@
+package gin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	errs "github.com/aka-yz/go-micro-core/providers/transport/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestDefaultCodecErrors(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+
+	// 默认与之前的格式相同: 200 和 {"code", "message"}
+	for err, want := range map[error]map[string]string{
+		status.Error(codes.NotFound, "1001: user: not found"):   {"code": "1001", "message": "user: not found"},
+		errs.New(codes.NotFound, "USER_NOT_FOUND", "not found"): {"code": "", "message": "not found"},
+	} {
+		w := httptest.NewRecorder()
+		if e := (defaultCodec{}).Encode(r, w, err); e != nil {
+			t.Fatal(e)
+		}
+		var got map[string]string
+		if e := json.Unmarshal(w.Body.Bytes(), &got); e != nil || w.Code != http.StatusOK || len(got) != 2 ||
+			got["code"] != want["code"] || got["message"] != want["message"] {
+			t.Fatalf("%v: %d %s", err, w.Code, w.Body)
+		}
+	}
+
+	// WithProblemErrors 按 grpc code 返回 http status 和 problem json
+	w := httptest.NewRecorder()
+	NewHandler(WithProblemErrors()).opts.Codec.Encode(r, w, errs.New(codes.NotFound, "USER_NOT_FOUND", "not found"))
+	var p errs.Problem
+	if e := json.Unmarshal(w.Body.Bytes(), &p); e != nil || w.Code != http.StatusNotFound ||
+		w.Header().Get("Content-Type") != errs.ProblemContentType || p.Code != "NOT_FOUND" || p.Reason != "USER_NOT_FOUND" {
+		t.Fatalf("problem: %d %s", w.Code, w.Body)
+	}
+}
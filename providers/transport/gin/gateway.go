@@ -0,0 +1,504 @@
+package gin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	errs "github.com/aka-yz/go-micro-core/providers/transport/errors"
+	"github.com/gin-gonic/gin"
+	protov1 "github.com/golang/protobuf/proto"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// Gateway 按 proto 的 google.api.http 注解把 grpc 服务注册为 rest 接口, 实现 grpc.ServiceRegistrar:
+//
+//	handler := gin.NewHandler(gin.WithMaxBodySize(rpcServer.MaxRecvMsgSize()))
+//	pb.RegisterUserServer(rpcServer, impl)
+//	pb.RegisterUserServer(handler.Gateway(rpcServer.UnaryInterceptor()), impl)
+//
+// 请求在进程内调用 grpc 的 handler, 经过与 grpc 请求相同的拦截器. 没有注解的方法为
+// POST /{service}/{snake_case_method}, body 为 "*". 只支持 unary 方法. 有多段变量, ** 或 verb
+// 的模板使用 gin 的 NoRoute 匹配, Handler.NoRoute 设置的 handler 在模板都没有匹配时执行,
+// 不要直接设置 Engine 的 NoRoute
+type Gateway struct {
+	h           *Handler
+	interceptor grpc.UnaryServerInterceptor
+	// routes method + gin path -> 该路由上的模板, 按注册顺序匹配; 不能作为 gin 路由的模板
+	// 在 method 下, 由 NoRoute 按 before 的顺序匹配. 所有 Gateway 共用
+	routes map[string][]*gatewayRoute
+	// noRoute 是否已经设置 NoRoute, 只用 Handler 上的 gateway
+	noRoute bool
+}
+
+type gatewayRoute struct {
+	template     *pathTemplate
+	body         string
+	responseBody string
+	fullMethod   string
+	input        protoreflect.MessageType
+	desc         *grpc.MethodDesc
+	impl         interface{}
+	// interceptor 注册服务时的 Gateway 的拦截器
+	interceptor grpc.UnaryServerInterceptor
+}
+
+// Gateway interceptor 为 nil 时不经过拦截器, 只作用于通过返回的 Gateway 注册的服务
+func (s *Handler) Gateway(interceptor grpc.UnaryServerInterceptor) *Gateway {
+	if s.gateway == nil {
+		s.gateway = &Gateway{h: s, routes: make(map[string][]*gatewayRoute)}
+	}
+	return &Gateway{h: s, interceptor: interceptor, routes: s.gateway.routes}
+}
+
+func (g *Gateway) RegisterService(desc *grpc.ServiceDesc, impl interface{}) {
+	d, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(desc.ServiceName))
+	if err != nil {
+		panic(fmt.Errorf("gateway service:%v descriptor not found:%v", desc.ServiceName, err))
+	}
+	sd, ok := d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		panic(fmt.Errorf("gateway %v is not a service", desc.ServiceName))
+	}
+	for _, sm := range desc.Streams {
+		log.Printf("gateway skip stream method /%s/%s", desc.ServiceName, sm.StreamName)
+	}
+
+	for i := range desc.Methods {
+		m := &desc.Methods[i]
+		md := sd.Methods().ByName(protoreflect.Name(m.MethodName))
+		if md == nil {
+			panic(fmt.Errorf("gateway method /%s/%s descriptor not found", desc.ServiceName, m.MethodName))
+		}
+		input, err := protoregistry.GlobalTypes.FindMessageByName(md.Input().FullName())
+		if err != nil {
+			panic(fmt.Errorf("gateway method /%s/%s input:%v", desc.ServiceName, m.MethodName, err))
+		}
+
+		for j, rule := range gatewayRules(desc.ServiceName, md) {
+			method, pattern := rulePattern(rule)
+			if g.h.opts.Prefix != "" {
+				pattern = path.Join(g.h.opts.Prefix, pattern)
+			}
+			t, err := parseTemplate(pattern)
+			if err != nil {
+				panic(err)
+			}
+			if err := checkRule(md.Input(), t, rule.Body); err != nil {
+				panic(fmt.Errorf("gateway method /%s/%s %v", desc.ServiceName, m.MethodName, err))
+			}
+			g.handle(method, &gatewayRoute{
+				template:     t,
+				body:         rule.Body,
+				responseBody: rule.ResponseBody,
+				fullMethod:   "/" + desc.ServiceName + "/" + m.MethodName,
+				input:        input,
+				desc:         m,
+				impl:         impl,
+				interceptor:  g.interceptor,
+			})
+			g.h.apis = append(g.h.apis, &apiRoute{
+				method: method, path: t.openAPIPath(), service: desc.ServiceName, name: m.MethodName, binding: j,
+				body: rule.Body, template: t, responseBody: rule.ResponseBody, input: md.Input(), output: md.Output(),
+			})
+		}
+	}
+}
+
+// gatewayRules 方法的注解和 additional_bindings, 没有注解时为默认的 POST
+func gatewayRules(service string, md protoreflect.MethodDescriptor) []*annotations.HttpRule {
+	rule, _ := proto.GetExtension(md.Options(), annotations.E_Http).(*annotations.HttpRule)
+	if rule == nil || rule.Pattern == nil {
+		return []*annotations.HttpRule{{
+			Pattern: &annotations.HttpRule_Post{Post: "/" + service + "/" + ToUnderLine(string(md.Name()))},
+			Body:    "*",
+		}}
+	}
+	rules := []*annotations.HttpRule{rule}
+	for _, r := range rule.AdditionalBindings {
+		rules = append(rules, r)
+	}
+	return rules
+}
+
+// checkRule 路径变量和 body 必须是请求中存在的字段
+func checkRule(input protoreflect.MessageDescriptor, t *pathTemplate, body string) error {
+	for _, v := range t.variables {
+		if _, err := fieldPath(input, v); err != nil {
+			return err
+		}
+	}
+	if body != "" && body != "*" {
+		if input.Fields().ByName(protoreflect.Name(body)) == nil {
+			return fmt.Errorf("body field:%v not found", body)
+		}
+	}
+	return nil
+}
+
+func (g *Gateway) handle(method string, route *gatewayRoute) {
+	ginPath, ok := route.template.ginPath()
+	if !ok {
+		g.handleNoRoute(method, route)
+		return
+	}
+	key := method + " " + ginPath
+	routes, ok := g.routes[key]
+	g.routes[key] = append(routes, route)
+	if ok {
+		return
+	}
+
+	// 与其他路由冲突时 gin 会 panic, 加上 HttpRule 便于定位
+	defer func() {
+		if r := recover(); r != nil {
+			panic(fmt.Errorf("gateway %s %s conflicts with existing routes: %v", method, route.template.raw, r))
+		}
+	}()
+	g.h.Handle(method, ginPath, func(c *gin.Context) {
+		for _, r := range g.routes[key] {
+			if vars, ok := r.template.match(c.Request.URL.EscapedPath()); ok {
+				g.serve(c, r, vars)
+				return
+			}
+		}
+		g.h.opts.Codec.Encode(c.Request, c.Writer, errs.New(codes.NotFound, "NOT_FOUND", "no gateway route for "+c.Request.URL.Path))
+	})
+}
+
+// handleNoRoute 多段变量等模板在 gin 没有匹配的路由时按模板匹配, 不与 gin 的路由冲突
+func (g *Gateway) handleNoRoute(method string, route *gatewayRoute) {
+	routes := g.routes[method]
+	i := len(routes)
+	for j, r := range routes {
+		if route.template.before(r.template) {
+			i = j
+			break
+		}
+	}
+	routes = append(routes, nil)
+	copy(routes[i+1:], routes[i:])
+	routes[i] = route
+	g.routes[method] = routes
+
+	if g.h.gateway.noRoute {
+		return
+	}
+	g.h.gateway.noRoute = true
+	g.h.Engine.NoRoute(func(c *gin.Context) {
+		for _, r := range g.routes[c.Request.Method] {
+			if vars, ok := r.template.match(c.Request.URL.EscapedPath()); ok {
+				g.serve(c, r, vars)
+				return
+			}
+		}
+		// 之前或之后通过 Handler.NoRoute 设置的 handler
+		if len(g.h.noRoute) > 0 {
+			for _, h := range g.h.noRoute {
+				if h(c); c.IsAborted() {
+					return
+				}
+			}
+			return
+		}
+		g.h.opts.Codec.Encode(c.Request, c.Writer, errs.New(codes.NotFound, "NOT_FOUND", "no route for "+c.Request.URL.Path))
+	})
+}
+
+func (g *Gateway) serve(c *gin.Context, route *gatewayRoute, vars map[string]string) {
+	r := c.Request
+	req := route.input.New().Interface()
+	if err := bindRequest(req, c, route, vars, int64(g.h.opts.maxBodySize)); err != nil {
+		if _, ok := err.(*errs.Error); !ok {
+			err = errs.New(codes.InvalidArgument, "INVALID_ARGUMENT", err.Error())
+		}
+		g.h.opts.Codec.Encode(r, c.Writer, err)
+		return
+	}
+
+	stream := &gatewayStream{method: route.fullMethod}
+	ctx := metadata.NewIncomingContext(r.Context(), incomingMetadata(r.Header))
+	ctx = grpc.NewContextWithServerTransportStream(ctx, stream)
+	if addr, err := net.ResolveTCPAddr("tcp", r.RemoteAddr); err == nil {
+		ctx = peer.NewContext(ctx, &peer.Peer{Addr: addr})
+	}
+
+	dec := func(v interface{}) error {
+		m, ok := v.(protoreflect.ProtoMessage)
+		if !ok {
+			m = protov1.MessageV2(v)
+		}
+		proto.Merge(m, req)
+		return nil
+	}
+	reply, err := route.desc.Handler(route.impl, ctx, dec, route.interceptor)
+
+	for k, v := range stream.header {
+		for _, vv := range v {
+			c.Writer.Header().Add(k, vv)
+		}
+	}
+	if err != nil {
+		g.h.opts.Codec.Encode(r, c.Writer, err)
+		return
+	}
+	if route.responseBody != "" {
+		if reply, err = responseField(reply, route.responseBody); err != nil {
+			g.h.opts.Codec.Encode(r, c.Writer, errs.New(codes.Internal, "INTERNAL", err.Error()))
+			return
+		}
+	}
+	g.h.opts.Codec.Encode(r, c.Writer, reply)
+}
+
+// bindRequest 按 HttpRule 绑定: body 为 "*" 时整个 body 是请求, 为字段名时 body 是该字段;
+// 之后绑定路径变量, body 不为 "*" 时没有被绑定的 query 参数绑定到对应的字段. body 超过 max 时返回 ResourceExhausted
+func bindRequest(req proto.Message, c *gin.Context, route *gatewayRoute, vars map[string]string, max int64) error {
+	r := c.Request
+	if route.body != "" && r.Body != nil {
+		data, err := ioutil.ReadAll(http.MaxBytesReader(c.Writer, r.Body, max))
+		if err != nil {
+			// MaxBytesReader 读到 max 字节后返回错误
+			if int64(len(data)) >= max {
+				return errs.New(codes.ResourceExhausted, "RESOURCE_EXHAUSTED", fmt.Sprintf("request body larger than %d bytes", max))
+			}
+			return err
+		}
+		if len(data) > 0 {
+			if err := bindBody(req, route, data); err != nil {
+				return fmt.Errorf("body: %v", err)
+			}
+		}
+	}
+
+	for field, value := range vars {
+		if err := setField(req.ProtoReflect(), field, []string{value}); err != nil {
+			return err
+		}
+	}
+
+	if route.body == "*" {
+		return nil
+	}
+	for key, values := range r.URL.Query() {
+		if _, ok := vars[key]; ok {
+			continue
+		}
+		if route.body != "" && (key == route.body || strings.HasPrefix(key, route.body+".")) {
+			continue
+		}
+		// 不是请求字段的参数(如 access_token)忽略
+		if _, err := fieldPath(req.ProtoReflect().Descriptor(), key); err != nil {
+			continue
+		}
+		if err := setField(req.ProtoReflect(), key, values); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bindBody body 为 "*" 时解析为整个请求; 为消息字段时直接解析到该字段,
+// 其他字段(标量, repeated, map)解析到只有该字段的新消息后复制
+func bindBody(req proto.Message, route *gatewayRoute, data []byte) error {
+	unmarshal := protojson.UnmarshalOptions{DiscardUnknown: true}
+	if route.body == "*" {
+		return unmarshal.Unmarshal(data, req)
+	}
+
+	m := req.ProtoReflect()
+	fd := m.Descriptor().Fields().ByName(protoreflect.Name(route.body))
+	if fd == nil {
+		return fmt.Errorf("field:%v not found", route.body)
+	}
+	if fd.Message() != nil && !fd.IsList() && !fd.IsMap() {
+		return unmarshal.Unmarshal(data, m.Mutable(fd).Message().Interface())
+	}
+
+	// json.RawMessage 校验 body 是一个完整的 json 值
+	wrapped, err := json.Marshal(map[string]json.RawMessage{string(fd.Name()): data})
+	if err != nil {
+		return err
+	}
+	tmp := route.input.New()
+	if err := unmarshal.Unmarshal(wrapped, tmp.Interface()); err != nil {
+		return err
+	}
+	if tmp.Has(fd) {
+		m.Set(fd, tmp.Get(fd))
+	}
+	return nil
+}
+
+// fieldPath 解析 "a.b.c", 除了最后一个都必须是非 repeated 的消息字段
+func fieldPath(md protoreflect.MessageDescriptor, path string) ([]protoreflect.FieldDescriptor, error) {
+	var fds []protoreflect.FieldDescriptor
+	names := strings.Split(path, ".")
+	for i, name := range names {
+		fd := md.Fields().ByName(protoreflect.Name(name))
+		if fd == nil {
+			fd = md.Fields().ByJSONName(name)
+		}
+		if fd == nil {
+			return nil, fmt.Errorf("field:%v not found in %v", path, md.FullName())
+		}
+		fds = append(fds, fd)
+		if i < len(names)-1 {
+			if fd.Message() == nil || fd.IsList() || fd.IsMap() {
+				return nil, fmt.Errorf("field:%v is not a message", name)
+			}
+			md = fd.Message()
+		}
+	}
+	return fds, nil
+}
+
+func setField(m protoreflect.Message, path string, values []string) error {
+	fds, err := fieldPath(m.Descriptor(), path)
+	if err != nil {
+		return err
+	}
+	for _, fd := range fds[:len(fds)-1] {
+		m = m.Mutable(fd).Message()
+	}
+	fd := fds[len(fds)-1]
+	if fd.IsMap() {
+		return fmt.Errorf("field:%v map is not supported", path)
+	}
+	if !fd.IsList() && len(values) > 1 {
+		return fmt.Errorf("field:%v is not repeated", path)
+	}
+
+	for _, value := range values {
+		v, err := parseField(fd, value)
+		if err != nil {
+			return fmt.Errorf("field:%v %v", path, err)
+		}
+		if fd.IsList() {
+			m.Mutable(fd).List().Append(v)
+		} else {
+			m.Set(fd, v)
+		}
+	}
+	return nil
+}
+
+// parseField 按 protojson 的规则解析字符串, 如 enum 名称, bytes 的 base64, Timestamp
+func parseField(fd protoreflect.FieldDescriptor, value string) (protoreflect.Value, error) {
+	if fd.Kind() == protoreflect.StringKind {
+		return protoreflect.ValueOfString(value), nil
+	}
+
+	quoted, _ := json.Marshal(value)
+	if fd.Message() != nil {
+		mt, err := protoregistry.GlobalTypes.FindMessageByName(fd.Message().FullName())
+		if err != nil {
+			return protoreflect.Value{}, err
+		}
+		m := mt.New()
+		// Timestamp, Duration 等是字符串, BoolValue 等是 json 的值
+		if err := protojson.Unmarshal(quoted, m.Interface()); err != nil {
+			if err := protojson.Unmarshal([]byte(value), m.Interface()); err != nil {
+				return protoreflect.Value{}, err
+			}
+		}
+		return protoreflect.ValueOfMessage(m), nil
+	}
+
+	// 借助单字段的 json 解析标量, protojson 接受字符串形式的数字, bool 和 enum 的数字不能是字符串
+	raw := quoted
+	if _, err := strconv.Atoi(value); fd.Kind() == protoreflect.BoolKind || fd.Kind() == protoreflect.EnumKind && err == nil {
+		raw = []byte(value)
+	}
+	m := dynamicField(fd)
+	if err := protojson.Unmarshal([]byte(fmt.Sprintf("{%q:%s}", fd.Name(), raw)), m.Interface()); err != nil {
+		return protoreflect.Value{}, err
+	}
+	v := m.Get(fd)
+	if fd.IsList() {
+		return v.List().Get(0), nil
+	}
+	return v, nil
+}
+
+// dynamicField 字段所在消息的新实例
+func dynamicField(fd protoreflect.FieldDescriptor) protoreflect.Message {
+	mt, err := protoregistry.GlobalTypes.FindMessageByName(fd.ContainingMessage().FullName())
+	if err != nil {
+		panic(err)
+	}
+	return mt.New()
+}
+
+// responseField response_body 指定的字段, 编码为 json
+func responseField(reply interface{}, field string) (interface{}, error) {
+	m, ok := reply.(protoreflect.ProtoMessage)
+	if !ok {
+		m = protov1.MessageV2(reply)
+	}
+	data, err := protojson.MarshalOptions{EmitUnpopulated: true}.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	fd := m.ProtoReflect().Descriptor().Fields().ByName(protoreflect.Name(field))
+	if fd == nil {
+		return nil, fmt.Errorf("response_body field:%v not found", field)
+	}
+	return fields[fd.JSONName()], nil
+}
+
+// incomingMetadata http header 作为 grpc metadata, 去掉连接相关的 header
+func incomingMetadata(header http.Header) metadata.MD {
+	md := metadata.MD{}
+	for k, v := range header {
+		switch k = strings.ToLower(k); k {
+		case "connection", "content-length", "content-type", "transfer-encoding", "accept-encoding", "te", "upgrade", "keep-alive":
+			continue
+		}
+		md[k] = append(md[k], v...)
+	}
+	return md
+}
+
+// gatewayStream 进程内调用的 grpc.ServerTransportStream, header 写入 http 响应
+type gatewayStream struct {
+	method  string
+	header  metadata.MD
+	trailer metadata.MD
+}
+
+func (s *gatewayStream) Method() string {
+	return s.method
+}
+
+func (s *gatewayStream) SetHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+func (s *gatewayStream) SendHeader(md metadata.MD) error {
+	return s.SetHeader(md)
+}
+
+func (s *gatewayStream) SetTrailer(md metadata.MD) error {
+	s.trailer = metadata.Join(s.trailer, md)
+	return nil
+}
@@ -0,0 +1,347 @@
+package gin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aka-yz/go-micro-core/configs/log"
+	errs "github.com/aka-yz/go-micro-core/providers/transport/errors"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func TestPathTemplate(t *testing.T) {
+	cases := []struct {
+		template, path string
+		gin            string
+		vars           map[string]string
+	}{
+		{"/v1/users/{id}", "/v1/users/a%20b", "/v1/users/:id", map[string]string{"id": "a b"}},
+		{"/v1/{user.id}/books", "/v1/42/books", "/v1/:user.id/books", map[string]string{"user.id": "42"}},
+		{"/v1/{name=shelves/*/books/*}", "/v1/shelves/1/books/2", "", map[string]string{"name": "shelves/1/books/2"}},
+		{"/v1/{name=shelves/*}:publish", "/v1/shelves/1:publish", "", map[string]string{"name": "shelves/1"}},
+		{"/v1/files/{path=**}", "/v1/files/a/b/c", "", map[string]string{"path": "a/b/c"}},
+		{"/v1/{name=shelves/*}", "/v1/books/1", "", nil},
+		{"/v1/{name=shelves/*}:publish", "/v1/shelves/1", "", nil},
+	}
+	for _, c := range cases {
+		tpl, err := parseTemplate(c.template)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := tpl.ginPath(); got != c.gin {
+			t.Errorf("%s gin path: got %s want %s", c.template, got, c.gin)
+		}
+		vars, ok := tpl.match(c.path)
+		if ok != (c.vars != nil) {
+			t.Errorf("%s match %s: %v", c.template, c.path, ok)
+			continue
+		}
+		for k, v := range c.vars {
+			if vars[k] != v {
+				t.Errorf("%s match %s: %s=%q want %q", c.template, c.path, k, vars[k], v)
+			}
+		}
+	}
+
+	for _, bad := range []string{"v1/users", "/v1/{id", "/v1/{id=}", "/v1/**/users"} {
+		if _, err := parseTemplate(bad); err == nil {
+			t.Errorf("%s should fail", bad)
+		}
+	}
+}
+
+// libraryDesc 注册带有 HttpRule 的测试服务:
+//
+//	service Library {
+//	  rpc GetBook(BookRequest) returns (Book) { get: "/v1/{name=shelves/*/books/*}" }
+//	  rpc UpdateBook(BookRequest) returns (Book) {
+//	    patch: "/v1/{book.name=shelves/*/books/*}" body: "book" response_body: "title" }
+//	  rpc CreateBook(BookRequest) returns (Book)
+//	  rpc FindBook(BookRequest) returns (Book) { get: "/v1/books/{name}" }
+//	}
+func libraryDesc(t *testing.T) protoreflect.ServiceDescriptor {
+	if d, err := protoregistry.GlobalFiles.FindDescriptorByName("gwtest.Library"); err == nil {
+		return d.(protoreflect.ServiceDescriptor)
+	}
+
+	field := func(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type, typeName string, repeated bool) *descriptorpb.FieldDescriptorProto {
+		label := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+		if repeated {
+			label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+		}
+		f := &descriptorpb.FieldDescriptorProto{Name: proto.String(name), Number: proto.Int32(number), Type: typ.Enum(), Label: label.Enum()}
+		if typeName != "" {
+			f.TypeName = proto.String(typeName)
+		}
+		return f
+	}
+	rule := func(r *annotations.HttpRule) *descriptorpb.MethodOptions {
+		opts := &descriptorpb.MethodOptions{}
+		proto.SetExtension(opts, annotations.E_Http, r)
+		return opts
+	}
+
+	fdp := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("gwtest/library.proto"),
+		Package: proto.String("gwtest"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Book"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("name", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, "", false),
+				field("title", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING, "", false),
+				field("pages", 3, descriptorpb.FieldDescriptorProto_TYPE_INT32, "", false),
+				field("tags", 4, descriptorpb.FieldDescriptorProto_TYPE_STRING, "", true),
+			},
+		}, {
+			Name: proto.String("BookRequest"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("name", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, "", false),
+				field("book", 2, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".gwtest.Book", false),
+				field("version", 3, descriptorpb.FieldDescriptorProto_TYPE_INT64, "", false),
+			},
+		}},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("Library"),
+			Method: []*descriptorpb.MethodDescriptorProto{{
+				Name: proto.String("GetBook"), InputType: proto.String(".gwtest.BookRequest"), OutputType: proto.String(".gwtest.Book"),
+				Options: rule(&annotations.HttpRule{Pattern: &annotations.HttpRule_Get{Get: "/v1/{name=shelves/*/books/*}"}}),
+			}, {
+				Name: proto.String("UpdateBook"), InputType: proto.String(".gwtest.BookRequest"), OutputType: proto.String(".gwtest.Book"),
+				Options: rule(&annotations.HttpRule{
+					Pattern:      &annotations.HttpRule_Patch{Patch: "/v1/{book.name=shelves/*/books/*}"},
+					Body:         "book",
+					ResponseBody: "title",
+				}),
+			}, {
+				Name: proto.String("CreateBook"), InputType: proto.String(".gwtest.BookRequest"), OutputType: proto.String(".gwtest.Book"),
+			}, {
+				Name: proto.String("FindBook"), InputType: proto.String(".gwtest.BookRequest"), OutputType: proto.String(".gwtest.Book"),
+				Options: rule(&annotations.HttpRule{Pattern: &annotations.HttpRule_Get{Get: "/v1/books/{name}"}}),
+			}},
+		}},
+	}
+	fd, err := protodesc.NewFile(fdp, protoregistry.GlobalFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := protoregistry.GlobalFiles.RegisterFile(fd); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < fd.Messages().Len(); i++ {
+		if err := protoregistry.GlobalTypes.RegisterMessage(dynamicpb.NewMessageType(fd.Messages().Get(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return fd.Services().Get(0)
+}
+
+// libraryMethod 把请求转换为 Book: name, title, pages(version), tags(x-user metadata)
+func libraryMethod(sd protoreflect.ServiceDescriptor, method string) grpc.MethodDesc {
+	input, output := sd.Methods().Get(0).Input(), sd.Methods().Get(0).Output()
+	handler := func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+		req := dynamicpb.NewMessage(input)
+		if err := dec(req); err != nil {
+			return nil, err
+		}
+		call := func(ctx context.Context, r interface{}) (interface{}, error) {
+			req := r.(*dynamicpb.Message)
+			book := dynamicpb.NewMessage(output)
+			if b := req.Get(input.Fields().ByName("book")).Message(); b.IsValid() {
+				proto.Merge(book, b.Interface())
+			}
+			if name := req.Get(input.Fields().ByName("name")).String(); name != "" {
+				book.Set(output.Fields().ByName("name"), protoreflect.ValueOfString(name))
+			}
+			book.Set(output.Fields().ByName("pages"), protoreflect.ValueOfInt32(int32(req.Get(input.Fields().ByName("version")).Int())))
+			md, _ := metadata.FromIncomingContext(ctx)
+			tags := book.Mutable(output.Fields().ByName("tags")).List()
+			for _, v := range md.Get("x-user") {
+				tags.Append(protoreflect.ValueOfString(v))
+			}
+			return book, nil
+		}
+		if interceptor == nil {
+			return call(ctx, req)
+		}
+		return interceptor(ctx, req, &grpc.UnaryServerInfo{Server: srv, FullMethod: "/gwtest.Library/" + method}, call)
+	}
+	return grpc.MethodDesc{MethodName: method, Handler: handler}
+}
+
+func TestGateway(t *testing.T) {
+	log.InitLogger(&log.Option{DirPath: t.TempDir() + "/"})
+	sd := libraryDesc(t)
+	desc := &grpc.ServiceDesc{
+		ServiceName: "gwtest.Library",
+		Methods:     []grpc.MethodDesc{libraryMethod(sd, "GetBook"), libraryMethod(sd, "UpdateBook"), libraryMethod(sd, "CreateBook")},
+	}
+
+	var methods []string
+	interceptor := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		methods = append(methods, info.FullMethod)
+		return handler(ctx, req)
+	}
+	h := NewHandler(WithProblemErrors())
+	h.Gateway(interceptor).RegisterService(desc, nil)
+
+	do := func(method, target, body string) map[string]interface{} {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		r.Header.Set("X-User", "alice")
+		w := httptest.NewRecorder()
+		h.Engine.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s %s: %d %s", method, target, w.Code, w.Body)
+		}
+		var v map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &v); err != nil {
+			// response_body 不是对象
+			return map[string]interface{}{"": strings.TrimSpace(w.Body.String())}
+		}
+		return v
+	}
+
+	got := do("GET", "/v1/shelves/1/books/2?version=3&unknown=1", "")
+	if got["name"] != "shelves/1/books/2" || got["pages"] != float64(3) || got["tags"].([]interface{})[0] != "alice" {
+		t.Fatalf("get: %v", got)
+	}
+
+	got = do("PATCH", "/v1/shelves/1/books/2", `{"title":"go","pages":7}`)
+	if got[""] != `"go"` {
+		t.Fatalf("update: %v", got)
+	}
+
+	got = do("POST", "/gwtest.Library/create_book", `{"name":"shelves/1/books/3","version":"9"}`)
+	if got["name"] != "shelves/1/books/3" || got["pages"] != float64(9) {
+		t.Fatalf("create: %v", got)
+	}
+
+	if strings.Join(methods, ",") != "/gwtest.Library/GetBook,/gwtest.Library/UpdateBook,/gwtest.Library/CreateBook" {
+		t.Fatalf("interceptor methods: %v", methods)
+	}
+
+	// 路径不匹配和参数错误
+	for target, code := range map[string]int{
+		"/v1/shelves/1":                     http.StatusNotFound,
+		"/v1/shelves/1/books/2?version=abc": http.StatusBadRequest,
+	} {
+		w := httptest.NewRecorder()
+		h.Engine.ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+		if w.Code != code {
+			t.Errorf("%s: got %d want %d", target, w.Code, code)
+		}
+	}
+}
+
+// 同一方法下混合单段变量和多段变量的规则, 不同的 Gateway 使用各自的拦截器
+func TestGatewayMixedRules(t *testing.T) {
+	log.InitLogger(&log.Option{DirPath: t.TempDir() + "/"})
+	sd := libraryDesc(t)
+
+	var methods []string
+	interceptor := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		methods = append(methods, info.FullMethod)
+		return handler(ctx, req)
+	}
+	h := NewHandler()
+	h.GET("/v1/ping", func(c *gin.Context) { c.String(http.StatusOK, "pong") })
+	h.Gateway(interceptor).RegisterService(&grpc.ServiceDesc{
+		ServiceName: "gwtest.Library",
+		Methods:     []grpc.MethodDesc{libraryMethod(sd, "GetBook")},
+	}, nil)
+	h.Gateway(nil).RegisterService(&grpc.ServiceDesc{
+		ServiceName: "gwtest.Library",
+		Methods:     []grpc.MethodDesc{libraryMethod(sd, "FindBook")},
+	}, nil)
+
+	for target, name := range map[string]string{
+		"/v1/books/7":           "7",
+		"/v1/shelves/1/books/2": "shelves/1/books/2",
+	} {
+		w := httptest.NewRecorder()
+		h.Engine.ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+		var book map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &book); err != nil || w.Code != http.StatusOK || book["name"] != name {
+			t.Fatalf("%s: %d %s", target, w.Code, w.Body)
+		}
+	}
+	// 后注册的 Gateway(nil) 不影响之前服务的拦截器
+	if strings.Join(methods, ",") != "/gwtest.Library/GetBook" {
+		t.Fatalf("interceptor methods: %v", methods)
+	}
+
+	w := httptest.NewRecorder()
+	h.Engine.ServeHTTP(w, httptest.NewRequest("GET", "/v1/ping", nil))
+	if w.Body.String() != "pong" {
+		t.Fatalf("ping: %d %s", w.Code, w.Body)
+	}
+
+	// 没有匹配时经过 codec, 之后设置的 NoRoute 在模板之后执行
+	w = httptest.NewRecorder()
+	h.Engine.ServeHTTP(w, httptest.NewRequest("GET", "/v2/unknown", nil))
+	if !strings.Contains(w.Body.String(), "no route for /v2/unknown") {
+		t.Fatalf("no route: %d %s", w.Code, w.Body)
+	}
+	h.NoRoute(func(c *gin.Context) { c.String(http.StatusTeapot, "teapot") })
+	w = httptest.NewRecorder()
+	h.Engine.ServeHTTP(w, httptest.NewRequest("GET", "/v2/unknown", nil))
+	if w.Code != http.StatusTeapot {
+		t.Fatalf("user no route: %d %s", w.Code, w.Body)
+	}
+	w = httptest.NewRecorder()
+	h.Engine.ServeHTTP(w, httptest.NewRequest("GET", "/v1/shelves/1/books/2", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("gateway after no route: %d %s", w.Code, w.Body)
+	}
+}
+
+func TestGatewayBody(t *testing.T) {
+	sd := libraryDesc(t)
+	input, err := protoregistry.GlobalTypes.FindMessageByName(sd.Methods().Get(0).Input().FullName())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := input.Descriptor().Fields()
+	bind := func(body, data string, max int64) (protoreflect.Message, error) {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("POST", "/?name=q", strings.NewReader(data))
+		req := input.New()
+		return req, bindRequest(req.Interface(), c, &gatewayRoute{body: body, input: input}, nil, max)
+	}
+
+	// 标量字段, protojson 接受字符串形式的 int64
+	for _, data := range []string{`5`, `"5"`} {
+		req, err := bind("version", data, 1024)
+		if err != nil || req.Get(fields.ByName("version")).Int() != 5 || req.Get(fields.ByName("name")).String() != "q" {
+			t.Fatalf("version %s: %v", data, err)
+		}
+	}
+	req, err := bind("book", `{"title":"go"}`, 1024)
+	if err != nil || req.Get(fields.ByName("book")).Message().Get(fields.ByName("book").Message().Fields().ByName("title")).String() != "go" {
+		t.Fatalf("book: %v", err)
+	}
+	// body 不能改写请求的其他字段
+	for body, data := range map[string]string{"version": `1,"name":"x"`, "book": `{"title":"go"},"name":"x"`} {
+		if req, err := bind(body, data, 1024); err == nil {
+			t.Fatalf("%s %s: %v", body, data, req.Get(fields.ByName("name")))
+		}
+	}
+
+	if _, err := bind("book", `{"title":"a long title"}`, 8); errs.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("large body: %v", err)
+	}
+}
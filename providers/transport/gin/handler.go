@@ -15,9 +15,18 @@ import (
 
 var reg, _ = regexp.Compile("/[0-9]+")
 
+// defaultMaxBodySize 与 grpc 默认的接收消息上限相同
+const defaultMaxBodySize = 1024 * 1024 * 4
+
 type Handler struct {
 	*gin.Engine
 	opts Options
+	// gateway 注册了 grpc 服务时不为空, 路由使用 HttpRule 的完整路径
+	gateway *Gateway
+	// apis 注册的接口, 用于生成 OpenAPI 文档
+	apis []*apiRoute
+	// noRoute 通过 NoRoute 设置的 handler, Gateway 的模板都没有匹配时执行
+	noRoute []gin.HandlerFunc
 }
 
 func NewHandler(opts ...Option) *Handler {
@@ -29,15 +38,29 @@ func NewHandler(opts ...Option) *Handler {
 	for _, o := range opts {
 		o(&opt)
 	}
+	if opt.maxBodySize <= 0 {
+		opt.maxBodySize = defaultMaxBodySize
+	}
 
 	handler := &Handler{
 		Engine: newEngine(),
 		opts:   opt,
 	}
+	handler.Use(opt.middlewares...)
+	handler.registerDocs()
 
 	return handler
 }
 
+// NoRoute 与 gin 相同, 注册了 Gateway 时在 Gateway 的模板都没有匹配之后执行
+func (s *Handler) NoRoute(handlers ...gin.HandlerFunc) {
+	s.noRoute = handlers
+	if s.gateway != nil && s.gateway.noRoute {
+		return
+	}
+	s.Engine.NoRoute(handlers...)
+}
+
 func newEngine() *gin.Engine {
 	engine := gin.New()
 	engine.Use(Logger(), gin.Recovery())
@@ -104,8 +127,15 @@ func (s *Handler) RegisterService(srv interface{}) {
 	}
 	for method, v := range service.methods {
 		rules := pe.methodHttpRules(method)
-		for _, rule := range rules {
-			s.Handle(rule.method, path.Join(prefix, rule.pattern), s.ginHandler(v))
+		for i, rule := range rules {
+			ginPath := path.Join(prefix, rule.pattern)
+			s.Handle(rule.method, ginPath, s.ginHandler(v))
+
+			apiPath, params := openAPIParams(ginPath)
+			s.apis = append(s.apis, &apiRoute{
+				method: rule.method, path: apiPath, service: service.name, name: method, binding: i,
+				params: params, body: rule.body, reqType: v.ReqType, respType: v.RespType,
+			})
 		}
 	}
 }
@@ -120,7 +150,7 @@ func (s *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		panic(fmt.Errorf("rpc: no method in path %q", r.URL.Path))
 	}
 
-	if s.opts.Prefix == "" {
+	if s.opts.Prefix == "" && s.gateway == nil && !s.isDocPath(r.URL.Path) {
 		r.URL.Path = "/" + s.opts.ServiceName + r.URL.Path[idx:]
 	}
 
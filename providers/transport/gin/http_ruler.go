@@ -82,18 +82,24 @@ func (p *protoExtend) methodHttpRules(method string) (rules []httpRule) {
 }
 
 func methodPattern(hr *annotations.HttpRule) (method, pattern string) {
+	method, pattern = rulePattern(hr)
+	return method, ginMethodPattern(pattern)
+}
+
+// rulePattern HttpRule 的方法和原始路径模板
+func rulePattern(hr *annotations.HttpRule) (method, pattern string) {
 	if get, ok := hr.Pattern.(*annotations.HttpRule_Get); ok {
-		return "GET", ginMethodPattern(get.Get)
+		return "GET", get.Get
 	} else if post, ok := hr.Pattern.(*annotations.HttpRule_Post); ok {
-		return "POST", ginMethodPattern(post.Post)
+		return "POST", post.Post
 	} else if patch, ok := hr.Pattern.(*annotations.HttpRule_Patch); ok {
-		return "PATCH", ginMethodPattern(patch.Patch)
+		return "PATCH", patch.Patch
 	} else if put, ok := hr.Pattern.(*annotations.HttpRule_Put); ok {
-		return "PUT", ginMethodPattern(put.Put)
+		return "PUT", put.Put
 	} else if del, ok := hr.Pattern.(*annotations.HttpRule_Delete); ok {
-		return "DELETE", ginMethodPattern(del.Delete)
+		return "DELETE", del.Delete
 	} else if cus, ok := hr.Pattern.(*annotations.HttpRule_Custom); ok {
-		return cus.Custom.Kind, ginMethodPattern(cus.Custom.Path)
+		return cus.Custom.Kind, cus.Custom.Path
 	}
 	panic(fmt.Sprintf("can not support ruler:%v", hr.Pattern))
 }
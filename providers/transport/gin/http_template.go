@@ -0,0 +1,248 @@
+package gin
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// HttpRule 的路径模板:
+//
+//	Template = "/" Segments [ Verb ] ;
+//	Segments = Segment { "/" Segment } ;
+//	Segment  = "*" | "**" | LITERAL | Variable ;
+//	Variable = "{" FieldPath [ "=" Segments ] "}" ;
+//	Verb     = ":" LITERAL ;
+//
+// 例如 "/v1/{name=projects/*/books/*}:publish", "/v1/users/{user.id}"
+
+const (
+	segLiteral = iota
+	segStar
+	segDoubleStar
+)
+
+type templateSegment struct {
+	kind    int
+	literal string
+	// variable 所属变量的下标, -1 不属于变量
+	variable int
+}
+
+type pathTemplate struct {
+	raw       string
+	segments  []templateSegment
+	variables []string
+	verb      string
+}
+
+func parseTemplate(raw string) (*pathTemplate, error) {
+	if !strings.HasPrefix(raw, "/") {
+		return nil, fmt.Errorf("http template %q must start with /", raw)
+	}
+	t := &pathTemplate{raw: raw}
+	path := raw[1:]
+
+	// verb 在最后一个 "}" 或 "/" 之后
+	if i := strings.LastIndex(path, ":"); i >= 0 && i > strings.LastIndexAny(path, "}/") {
+		t.verb = path[i+1:]
+		path = path[:i]
+	}
+
+	for len(path) > 0 {
+		var seg string
+		if path[0] == '{' {
+			end := strings.IndexByte(path, '}')
+			if end < 0 {
+				return nil, fmt.Errorf("http template %q: unclosed variable", raw)
+			}
+			if err := t.parseVariable(path[1:end]); err != nil {
+				return nil, fmt.Errorf("http template %q: %v", raw, err)
+			}
+			path = path[end+1:]
+		} else {
+			if i := strings.IndexByte(path, '/'); i >= 0 {
+				seg, path = path[:i], path[i:]
+			} else {
+				seg, path = path, ""
+			}
+			t.segments = append(t.segments, newSegment(seg, -1))
+		}
+
+		if path != "" {
+			if path[0] != '/' {
+				return nil, fmt.Errorf("http template %q: unexpected %q", raw, path)
+			}
+			path = path[1:]
+		}
+	}
+
+	for i, s := range t.segments {
+		if s.kind == segDoubleStar && i != len(t.segments)-1 {
+			return nil, fmt.Errorf("http template %q: ** must be the last segment", raw)
+		}
+	}
+	return t, nil
+}
+
+func (t *pathTemplate) parseVariable(v string) error {
+	field, segments := v, "*"
+	if i := strings.IndexByte(v, '='); i >= 0 {
+		field, segments = v[:i], v[i+1:]
+	}
+	if field == "" || segments == "" {
+		return fmt.Errorf("invalid variable {%s}", v)
+	}
+	idx := len(t.variables)
+	t.variables = append(t.variables, field)
+	for _, seg := range strings.Split(segments, "/") {
+		if seg == "" || strings.ContainsAny(seg, "{}") {
+			return fmt.Errorf("invalid variable {%s}", v)
+		}
+		t.segments = append(t.segments, newSegment(seg, idx))
+	}
+	return nil
+}
+
+func newSegment(seg string, variable int) templateSegment {
+	switch seg {
+	case "*":
+		return templateSegment{kind: segStar, variable: variable}
+	case "**":
+		return templateSegment{kind: segDoubleStar, variable: variable}
+	}
+	return templateSegment{kind: segLiteral, literal: seg, variable: variable}
+}
+
+// ginPath gin 的路由: 只有字面量和单段变量时与模板相同. 有多段变量, ** 或 verb 时
+// 返回 false, gin 的 catch-all 会与同一前缀下的其他路由冲突, 这些模板在 NoRoute 中匹配
+func (t *pathTemplate) ginPath() (string, bool) {
+	var b strings.Builder
+	simple := t.verb == ""
+	for _, s := range t.segments {
+		if s.kind == segDoubleStar || (s.variable >= 0 && (s.kind != segStar || t.segmentsOf(s.variable) != 1)) ||
+			(s.variable < 0 && s.kind == segStar) {
+			simple = false
+		}
+	}
+
+	if !simple {
+		return "", false
+	}
+
+	for _, s := range t.segments {
+		if s.kind == segLiteral && s.variable < 0 {
+			b.WriteString("/" + s.literal)
+			continue
+		}
+		b.WriteString("/:" + t.variables[s.variable])
+	}
+	if b.Len() == 0 {
+		return "/", true
+	}
+	return b.String(), true
+}
+
+// before NoRoute 中 t 是否先于 o 匹配: 按段比较, 字面量先于 *, * 先于 **;
+// 都相同时有 verb 的先匹配
+func (t *pathTemplate) before(o *pathTemplate) bool {
+	for i := 0; i < len(t.segments) && i < len(o.segments); i++ {
+		if a, b := t.segments[i].kind, o.segments[i].kind; a != b {
+			return a < b
+		}
+	}
+	return t.verb != "" && o.verb == ""
+}
+
+func (t *pathTemplate) segmentsOf(variable int) (n int) {
+	for _, s := range t.segments {
+		if s.variable == variable {
+			n++
+		}
+	}
+	return
+}
+
+// match 返回变量的值, 单段变量的值会解码, 多段变量中的 "/" 保留
+func (t *pathTemplate) match(escapedPath string) (map[string]string, bool) {
+	if !strings.HasPrefix(escapedPath, "/") {
+		return nil, false
+	}
+	path := escapedPath[1:]
+	if t.verb != "" {
+		if !strings.HasSuffix(path, ":"+t.verb) {
+			return nil, false
+		}
+		path = strings.TrimSuffix(path, ":"+t.verb)
+	}
+
+	var parts []string
+	if path != "" {
+		parts = strings.Split(path, "/")
+	}
+	for i, p := range parts {
+		unescaped, err := url.PathUnescape(p)
+		if err != nil {
+			return nil, false
+		}
+		parts[i] = unescaped
+	}
+
+	values := make([][]string, len(t.variables))
+	for _, s := range t.segments {
+		if s.kind == segDoubleStar {
+			if s.variable >= 0 {
+				values[s.variable] = append(values[s.variable], parts...)
+			}
+			parts = nil
+			break
+		}
+		if len(parts) == 0 {
+			return nil, false
+		}
+		if s.kind == segLiteral && parts[0] != s.literal {
+			return nil, false
+		}
+		if s.variable >= 0 {
+			values[s.variable] = append(values[s.variable], parts[0])
+		}
+		parts = parts[1:]
+	}
+	if len(parts) > 0 {
+		return nil, false
+	}
+
+	vars := make(map[string]string, len(t.variables))
+	for i, name := range t.variables {
+		vars[name] = strings.Join(values[i], "/")
+	}
+	return vars, true
+}
+
+// openAPIPath OpenAPI 的路径, 每个变量为一个参数 {field}, 多段变量的值中包含 "/"
+func (t *pathTemplate) openAPIPath() string {
+	var b strings.Builder
+	last := -1
+	for _, s := range t.segments {
+		switch {
+		case s.variable >= 0:
+			if s.variable != last {
+				b.WriteString("/{" + t.variables[s.variable] + "}")
+			}
+			last = s.variable
+		case s.kind == segLiteral:
+			b.WriteString("/" + s.literal)
+		case s.kind == segStar:
+			b.WriteString("/*")
+		default:
+			b.WriteString("/**")
+		}
+	}
+	if b.Len() == 0 {
+		b.WriteString("/")
+	}
+	if t.verb != "" {
+		b.WriteString(":" + t.verb)
+	}
+	return b.String()
+}
@@ -0,0 +1,196 @@
+package gin
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"reflect"
+	"strings"
+
+	errs "github.com/aka-yz/go-micro-core/providers/transport/errors"
+	"github.com/aka-yz/go-micro-core/providers/transport/gin/openapi"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// apiRoute 注册的接口, 用于生成 OpenAPI 文档. RegisterService 的接口由 reqType/respType
+// 描述, Gateway 的接口由 proto 描述 input/output 描述
+type apiRoute struct {
+	method  string
+	path    string
+	service string
+	name    string
+	// binding 同一方法的第几个 HttpRule, additional_bindings 从 1 开始
+	binding int
+	params  []string
+	body    string
+
+	reqType  reflect.Type
+	respType reflect.Type
+
+	template     *pathTemplate
+	responseBody string
+	input        protoreflect.MessageDescriptor
+	output       protoreflect.MessageDescriptor
+}
+
+// OpenAPI 根据已注册的接口生成 OpenAPI 3 文档, 每次调用重新生成
+func (s *Handler) OpenAPI() *openapi.Document {
+	title := s.opts.ServiceName
+	if title == "" {
+		title = "api"
+	}
+	doc := openapi.New(openapi.Info{Title: title, Version: "1.0.0"})
+	problem := doc.TypeSchema(reflect.TypeOf(errs.Problem{}))
+
+	for _, api := range s.apis {
+		id := strings.Replace(api.service, ".", "_", -1) + "_" + api.name
+		if api.binding > 0 {
+			id = fmt.Sprintf("%s_%d", id, api.binding)
+		}
+		op := &openapi.Operation{
+			OperationID: id,
+			Summary:     "/" + api.service + "/" + api.name,
+			Tags:        []string{api.service},
+			Responses: map[string]*openapi.Response{
+				"default": {
+					Description: "error",
+					Content:     map[string]*openapi.MediaType{errs.ProblemContentType: {Schema: problem}},
+				},
+			},
+		}
+		if api.input != nil {
+			api.describeProto(doc, op)
+		} else {
+			api.describeType(doc, op)
+		}
+		doc.AddOperation(api.path, api.method, op)
+	}
+	return doc
+}
+
+// describeType RegisterService 的接口: body 整体解码为请求, 路径参数放在 metadata 中
+func (api *apiRoute) describeType(doc *openapi.Document, op *openapi.Operation) {
+	for _, p := range api.params {
+		op.Parameters = append(op.Parameters, &openapi.Parameter{Name: p, In: "path", Required: true, Schema: &openapi.Schema{Type: "string"}})
+	}
+	if hasBody(api.method) {
+		op.RequestBody = &openapi.RequestBody{Required: true, Content: openapi.JSONContent(doc.TypeSchema(api.reqType))}
+	}
+	op.Responses["200"] = &openapi.Response{Description: "OK", Content: openapi.JSONContent(doc.TypeSchema(api.respType))}
+}
+
+// describeProto Gateway 的接口, 与 bindRequest 的绑定规则一致
+func (api *apiRoute) describeProto(doc *openapi.Document, op *openapi.Operation) {
+	bound := make(map[string]bool)
+	for _, v := range api.template.variables {
+		bound[strings.Split(v, ".")[0]] = true
+		// checkRule 已经校验过路径变量, 找不到字段时按字符串描述
+		schema := &openapi.Schema{Type: "string"}
+		if fds, err := fieldPath(api.input, v); err == nil {
+			schema = doc.FieldSchema(fds[len(fds)-1])
+		}
+		op.Parameters = append(op.Parameters, &openapi.Parameter{
+			Name:     v,
+			In:       "path",
+			Required: true,
+			Schema:   schema,
+		})
+	}
+
+	switch api.body {
+	case "":
+	case "*":
+		op.RequestBody = &openapi.RequestBody{Required: true, Content: openapi.JSONContent(doc.MessageSchema(api.input))}
+	default:
+		fd := api.input.Fields().ByName(protoreflect.Name(api.body))
+		bound[api.body] = true
+		op.RequestBody = &openapi.RequestBody{Required: true, Content: openapi.JSONContent(doc.FieldSchema(fd))}
+	}
+
+	// body 不为 "*" 时, 其余的标量字段可以作为 query 参数
+	if api.body != "*" {
+		fields := api.input.Fields()
+		for i := 0; i < fields.Len(); i++ {
+			fd := fields.Get(i)
+			if bound[string(fd.Name())] || fd.IsMap() || fd.Message() != nil {
+				continue
+			}
+			op.Parameters = append(op.Parameters, &openapi.Parameter{Name: string(fd.Name()), In: "query", Schema: doc.FieldSchema(fd)})
+		}
+	}
+
+	resp := doc.MessageSchema(api.output)
+	if api.responseBody != "" {
+		resp = doc.FieldSchema(api.output.Fields().ByName(protoreflect.Name(api.responseBody)))
+	}
+	op.Responses["200"] = &openapi.Response{Description: "OK", Content: openapi.JSONContent(resp)}
+}
+
+func hasBody(method string) bool {
+	return method != http.MethodGet && method != http.MethodHead && method != http.MethodDelete
+}
+
+// openAPIParams gin 路由 :id, *path 转换为 {id}, {path}
+func openAPIParams(ginPath string) (string, []string) {
+	var params []string
+	segments := strings.Split(ginPath, "/")
+	for i, seg := range segments {
+		if strings.HasPrefix(seg, ":") || strings.HasPrefix(seg, "*") {
+			params = append(params, seg[1:])
+			segments[i] = "{" + seg[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/"), params
+}
+
+// registerDocs 注册 WithOpenAPI 和 WithSwaggerUI 的路由
+func (s *Handler) registerDocs() {
+	if s.opts.openAPIPath == "" {
+		return
+	}
+	s.GET(s.opts.openAPIPath, func(c *gin.Context) {
+		c.JSON(http.StatusOK, s.OpenAPI())
+	})
+	if s.opts.swaggerPath == "" {
+		return
+	}
+	assetsURL := strings.TrimSuffix(s.opts.swaggerPath, "/")
+	s.GET(s.opts.swaggerPath, func(c *gin.Context) {
+		c.Header("Content-Type", "text/html; charset=utf-8")
+		c.Status(http.StatusOK)
+		if err := openapi.WriteSwaggerUI(c.Writer, s.OpenAPI().Info.Title, s.opts.openAPIPath, assetsURL); err != nil {
+			c.Error(err)
+		}
+	})
+	// 静态资源内嵌在程序中, 不依赖外部的 cdn
+	for _, name := range openapi.SwaggerUIAssets {
+		data, err := openapi.SwaggerUIAsset(name)
+		if err != nil {
+			panic(err)
+		}
+		contentType := mime.TypeByExtension(path.Ext(name))
+		s.GET(assetsURL+"/"+name, func(c *gin.Context) {
+			c.Data(http.StatusOK, contentType, data)
+		})
+	}
+}
+
+func (s *Handler) isDocPath(p string) bool {
+	if p == "" {
+		return false
+	}
+	if p == s.opts.openAPIPath || p == s.opts.swaggerPath {
+		return true
+	}
+	if s.opts.swaggerPath == "" {
+		return false
+	}
+	for _, name := range openapi.SwaggerUIAssets {
+		if p == strings.TrimSuffix(s.opts.swaggerPath, "/")+"/"+name {
+			return true
+		}
+	}
+	return false
+}
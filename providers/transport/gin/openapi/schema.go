@@ -0,0 +1,217 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+
+	protov1 "github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+var (
+	typeOfTime     = reflect.TypeOf(time.Time{})
+	typeOfDuration = reflect.TypeOf(time.Duration(0))
+	typeOfRaw      = reflect.TypeOf(json.RawMessage{})
+	typeOfProtoV1  = reflect.TypeOf((*protov1.Message)(nil)).Elem()
+	typeOfProtoV2  = reflect.TypeOf((*proto.Message)(nil)).Elem()
+)
+
+// TypeSchema go 类型的 schema, 结构体加入 components 并返回 $ref. proto 消息按 protojson
+// 的格式生成, 与 gin codec 的编码一致, 其他类型按 json tag
+func (d *Document) TypeSchema(t reflect.Type) *Schema {
+	if md := messageDescriptor(t); md != nil {
+		return d.MessageSchema(md)
+	}
+
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t {
+	case typeOfTime:
+		return &Schema{Type: "string", Format: "date-time"}
+	case typeOfDuration:
+		return &Schema{Type: "integer", Format: "int64"}
+	case typeOfRaw:
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: d.TypeSchema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: d.TypeSchema(t.Elem())}
+	case reflect.Struct:
+		return d.structSchema(t)
+	}
+	// interface 等任意类型
+	return &Schema{}
+}
+
+func (d *Document) structSchema(t reflect.Type) *Schema {
+	name := strings.Replace(t.String(), "*", "", -1)
+	ref := &Schema{Ref: "#/components/schemas/" + name}
+	if t.Name() == "" {
+		name = ""
+	} else if _, ok := d.Components.Schemas[name]; ok {
+		return ref
+	}
+
+	s := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	if name != "" {
+		// 先占位, 递归的类型引用自己
+		d.Components.Schemas[name] = s
+	}
+	d.structFields(s, t)
+	if name == "" {
+		return s
+	}
+	return ref
+}
+
+func (d *Document) structFields(s *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" || (f.PkgPath != "" && !f.Anonymous) {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			for ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				d.structFields(s, ft)
+				continue
+			}
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		s.Properties[name] = d.TypeSchema(f.Type)
+	}
+}
+
+func messageDescriptor(t reflect.Type) protoreflect.MessageDescriptor {
+	if t.Kind() != reflect.Ptr {
+		t = reflect.PtrTo(t)
+	}
+	if t.Implements(typeOfProtoV2) {
+		return reflect.Zero(t).Interface().(proto.Message).ProtoReflect().Descriptor()
+	}
+	if t.Implements(typeOfProtoV1) {
+		return protov1.MessageV2(reflect.New(t.Elem()).Interface()).ProtoReflect().Descriptor()
+	}
+	return nil
+}
+
+// wellKnown protojson 对 well-known 类型的特殊编码
+var wellKnown = map[protoreflect.FullName]*Schema{
+	"google.protobuf.Timestamp":   {Type: "string", Format: "date-time"},
+	"google.protobuf.Duration":    {Type: "string", Description: "duration, e.g. 1.5s"},
+	"google.protobuf.FieldMask":   {Type: "string"},
+	"google.protobuf.Struct":      {Type: "object"},
+	"google.protobuf.Value":       {},
+	"google.protobuf.ListValue":   {Type: "array", Items: &Schema{}},
+	"google.protobuf.Any":         {Type: "object"},
+	"google.protobuf.Empty":       {Type: "object"},
+	"google.protobuf.BoolValue":   {Type: "boolean"},
+	"google.protobuf.StringValue": {Type: "string"},
+	"google.protobuf.BytesValue":  {Type: "string", Format: "byte"},
+	"google.protobuf.Int32Value":  {Type: "integer", Format: "int32"},
+	"google.protobuf.UInt32Value": {Type: "integer", Format: "int64"},
+	"google.protobuf.Int64Value":  {Type: "string", Format: "int64"},
+	"google.protobuf.UInt64Value": {Type: "string", Format: "uint64"},
+	"google.protobuf.FloatValue":  {Type: "number", Format: "float"},
+	"google.protobuf.DoubleValue": {Type: "number", Format: "double"},
+}
+
+// MessageSchema proto 消息的 schema, 字段名为 json name, 加入 components 并返回 $ref
+func (d *Document) MessageSchema(md protoreflect.MessageDescriptor) *Schema {
+	if s, ok := wellKnown[md.FullName()]; ok {
+		c := *s
+		return &c
+	}
+
+	name := string(md.FullName())
+	ref := &Schema{Ref: "#/components/schemas/" + name}
+	if _, ok := d.Components.Schemas[name]; ok {
+		return ref
+	}
+	s := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	d.Components.Schemas[name] = s
+
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		s.Properties[fd.JSONName()] = d.FieldSchema(fd)
+	}
+	return ref
+}
+
+// FieldSchema 字段的 schema, repeated 为 array, map 为 object
+func (d *Document) FieldSchema(fd protoreflect.FieldDescriptor) *Schema {
+	if fd.IsMap() {
+		return &Schema{Type: "object", AdditionalProperties: d.singularSchema(fd.MapValue())}
+	}
+	if fd.IsList() {
+		return &Schema{Type: "array", Items: d.singularSchema(fd)}
+	}
+	return d.singularSchema(fd)
+}
+
+func (d *Document) singularSchema(fd protoreflect.FieldDescriptor) *Schema {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return &Schema{Type: "boolean"}
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		return &Schema{Type: "integer", Format: "int32"}
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return &Schema{Type: "integer", Format: "int64"}
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		// protojson 把 64 位整数编码为字符串
+		return &Schema{Type: "string", Format: "int64"}
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return &Schema{Type: "string", Format: "uint64"}
+	case protoreflect.FloatKind:
+		return &Schema{Type: "number", Format: "float"}
+	case protoreflect.DoubleKind:
+		return &Schema{Type: "number", Format: "double"}
+	case protoreflect.StringKind:
+		return &Schema{Type: "string"}
+	case protoreflect.BytesKind:
+		return &Schema{Type: "string", Format: "byte"}
+	case protoreflect.EnumKind:
+		values := fd.Enum().Values()
+		s := &Schema{Type: "string"}
+		for i := 0; i < values.Len(); i++ {
+			s.Enum = append(s.Enum, string(values.Get(i).Name()))
+		}
+		return s
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return d.MessageSchema(fd.Message())
+	}
+	return &Schema{}
+}
@@ -0,0 +1,47 @@
+package openapi
+
+import (
+	"embed"
+	"html/template"
+	"io"
+)
+
+// SwaggerUIVersion 内嵌的 swagger-ui-dist 版本, 文件在 swagger-ui 目录, 许可证为 Apache-2.0
+const SwaggerUIVersion = "5.18.2"
+
+// SwaggerUIAssets swagger ui 页面引用的静态资源, 与页面在同一路径下
+var SwaggerUIAssets = []string{"swagger-ui.css", "swagger-ui-bundle.js"}
+
+//go:embed swagger-ui/swagger-ui.css swagger-ui/swagger-ui-bundle.js
+var swaggerUI embed.FS
+
+var swaggerTemplate = template.Must(template.New("swagger").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>{{.Title}}</title>
+  <link rel="stylesheet" href="{{.AssetsURL}}/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="{{.AssetsURL}}/swagger-ui-bundle.js"></script>
+<script>
+  window.onload = function () {
+    window.ui = SwaggerUIBundle({url: {{.SpecURL}}, dom_id: "#swagger-ui"});
+  };
+</script>
+</body>
+</html>
+`))
+
+// WriteSwaggerUI 写入 swagger ui 页面, specURL 为文档的地址, assetsURL 为 SwaggerUIAssets 所在的路径
+func WriteSwaggerUI(w io.Writer, title, specURL, assetsURL string) error {
+	return swaggerTemplate.Execute(w, struct {
+		Title, SpecURL, AssetsURL string
+	}{title, specURL, assetsURL})
+}
+
+// SwaggerUIAsset 内嵌的静态资源, name 为 SwaggerUIAssets 中的文件名
+func SwaggerUIAsset(name string) ([]byte, error) {
+	return swaggerUI.ReadFile("swagger-ui/" + name)
+}
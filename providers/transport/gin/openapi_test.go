@@ -0,0 +1,113 @@
+package gin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aka-yz/go-micro-core/configs/log"
+	"github.com/aka-yz/go-micro-core/providers/transport/gin/openapi"
+	"google.golang.org/grpc"
+)
+
+type EchoRequest struct {
+	Text  string            `json:"text"`
+	Times []int             `json:"times,omitempty"`
+	Extra map[string]string `json:"extra"`
+	Skip  string            `json:"-"`
+}
+
+type EchoReply struct {
+	Text string    `json:"text"`
+	At   time.Time `json:"at"`
+	Next *EchoReply
+}
+
+type Echo struct{}
+
+func (Echo) SayHello(ctx context.Context, req *EchoRequest) (*EchoReply, error) {
+	return &EchoReply{Text: req.Text}, nil
+}
+
+func TestOpenAPI(t *testing.T) {
+	log.InitLogger(&log.Option{DirPath: t.TempDir() + "/"})
+	h := NewHandler(WithSwaggerUI("/docs"))
+	h.RegisterService(Echo{})
+
+	sd := libraryDesc(t)
+	desc := &grpc.ServiceDesc{ServiceName: "gwtest.Library"}
+	for i := 0; i < sd.Methods().Len(); i++ {
+		desc.Methods = append(desc.Methods, grpc.MethodDesc{MethodName: string(sd.Methods().Get(i).Name())})
+	}
+	h.Gateway(nil).RegisterService(desc, nil)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/openapi.json", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("openapi: %d %s", w.Code, w.Body)
+	}
+	var doc openapi.Document
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	hello := doc.Paths["/Echo/say_hello"]["post"]
+	if hello == nil || hello.RequestBody.Content["application/json"].Schema.Ref != "#/components/schemas/gin.EchoRequest" {
+		t.Fatalf("say_hello: %+v", hello)
+	}
+	req := doc.Components.Schemas["gin.EchoRequest"]
+	if _, ok := req.Properties["-"]; ok || req.Properties["times"].Items.Type != "integer" || req.Properties["extra"].AdditionalProperties.Type != "string" {
+		t.Fatalf("EchoRequest: %+v", req)
+	}
+	reply := doc.Components.Schemas["gin.EchoReply"]
+	if reply.Properties["at"].Format != "date-time" || reply.Properties["Next"].Ref != "#/components/schemas/gin.EchoReply" {
+		t.Fatalf("EchoReply: %+v", reply)
+	}
+
+	get := doc.Paths["/v1/{name}"]["get"]
+	if get == nil || get.RequestBody != nil || len(get.Parameters) != 2 ||
+		get.Parameters[0].In != "path" || get.Parameters[1].Name != "version" || get.Parameters[1].Schema.Format != "int64" {
+		t.Fatalf("GetBook: %+v", get)
+	}
+	update := doc.Paths["/v1/{book.name}"]["patch"]
+	if update == nil || update.RequestBody.Content["application/json"].Schema.Ref != "#/components/schemas/gwtest.Book" ||
+		update.Responses["200"].Content["application/json"].Schema.Type != "string" {
+		t.Fatalf("UpdateBook: %+v", update)
+	}
+	if create := doc.Paths["/gwtest.Library/create_book"]["post"]; create == nil || create.OperationID != "gwtest_Library_CreateBook" {
+		t.Fatalf("CreateBook: %+v", create)
+	}
+	if tags := doc.Components.Schemas["gwtest.Book"].Properties["tags"]; tags.Type != "array" {
+		t.Fatalf("Book.tags: %+v", tags)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/docs", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `url: "/openapi.json"`) ||
+		!strings.Contains(w.Body.String(), `src="/docs/swagger-ui-bundle.js"`) || strings.Contains(w.Body.String(), "https://") {
+		t.Fatalf("swagger ui: %d %s", w.Code, w.Body)
+	}
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/docs/swagger-ui.css", nil))
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/css") || w.Body.Len() == 0 {
+		t.Fatalf("swagger ui css: %d %s", w.Code, w.Header())
+	}
+}
+
+func TestOpenAPIUnknownPathField(t *testing.T) {
+	sd := libraryDesc(t)
+	tpl, err := parseTemplate("/v1/{missing}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := &apiRoute{method: "GET", template: tpl, input: sd.Methods().Get(0).Input(), output: sd.Methods().Get(0).Output()}
+	op := &openapi.Operation{Responses: map[string]*openapi.Response{}}
+	api.describeProto(openapi.New(openapi.Info{}), op)
+	if len(op.Parameters) == 0 || op.Parameters[0].In != "path" || op.Parameters[0].Schema.Type != "string" {
+		t.Fatalf("parameters: %+v", op.Parameters)
+	}
+}
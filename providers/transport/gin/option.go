@@ -1,11 +1,20 @@
 package gin
 
+import "github.com/gin-gonic/gin"
+
 type Options struct {
 	Codec        Codec
 	ServiceName  string
 	ProtoName    string
 	Prefix       string
 	interceptors []Interceptor
+	// middlewares 在所有路由之前执行, 如 auth.GinMiddleware
+	middlewares []gin.HandlerFunc
+	// openAPIPath, swaggerPath 不为空时提供 OpenAPI 文档和 swagger ui
+	openAPIPath string
+	swaggerPath string
+	// maxBodySize Gateway 请求 body 的上限, 默认与 grpc 相同为 4MB
+	maxBodySize int
 }
 
 type Option func(*Options)
@@ -28,6 +37,22 @@ func WithCodec(codec Codec) Option {
 	}
 }
 
+// WithProblemErrors 默认 codec 的错误按 grpc code 返回 http status 和 problem json(errors.Problem),
+// 不设置时与之前相同, 返回 200 和 {"code", "message"}. 会替换 WithCodec 设置的 codec
+func WithProblemErrors() Option {
+	return func(o *Options) {
+		o.Codec = defaultCodec{problem: true}
+	}
+}
+
+// WithMaxBodySize Gateway 请求 body 的上限, 单位为字节, 超过时返回 ResourceExhausted.
+// 一般与 grpc server 相同: WithMaxBodySize(rpcServer.MaxRecvMsgSize())
+func WithMaxBodySize(n int) Option {
+	return func(o *Options) {
+		o.maxBodySize = n
+	}
+}
+
 func WithInterceptor(interceptors ...Interceptor) Option {
 	return func(o *Options) {
 		o.interceptors = interceptors
@@ -39,3 +64,27 @@ func WithPrefix(prefix string) Option {
 		o.Prefix = prefix
 	}
 }
+
+func WithMiddleware(middlewares ...gin.HandlerFunc) Option {
+	return func(o *Options) {
+		o.middlewares = append(o.middlewares, middlewares...)
+	}
+}
+
+// WithOpenAPI 在 path 提供注册接口的 OpenAPI 3 文档, 如 /openapi.json
+func WithOpenAPI(path string) Option {
+	return func(o *Options) {
+		o.openAPIPath = path
+	}
+}
+
+// WithSwaggerUI 在 path 提供 swagger ui 页面, 页面的静态资源内嵌在程序中, 在 path 下提供.
+// 没有设置 WithOpenAPI 时文档在 /openapi.json
+func WithSwaggerUI(path string) Option {
+	return func(o *Options) {
+		o.swaggerPath = path
+		if o.openAPIPath == "" {
+			o.openAPIPath = "/openapi.json"
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package grpc
+
+import (
+	"math/rand"
+	"net"
+	"strconv"
+
+	"github.com/aka-yz/go-micro-core/providers/transport/grpc/selector"
+	registry "github.com/aka-yz/go-micro-core/register"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/balancer/roundrobin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// 内置 balancer 名称, 通过 WithBalanceName 选择
+const (
+	BalancerRoundRobin = roundrobin.Name
+	BalancerRandom     = "random"
+	// BalancerSelector 由 selector.Selector 选择节点, registry resolver 的默认 balancer
+	BalancerSelector = "selector"
+)
+
+func init() {
+	balancer.Register(base.NewBalancerBuilder(BalancerRandom, &randomPickerBuilder{}, base.Config{HealthCheck: true}))
+	balancer.Register(&selectorBalancerBuilder{})
+}
+
+type randomPickerBuilder struct{}
+
+func (*randomPickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+
+	scs := make([]balancer.SubConn, 0, len(info.ReadySCs))
+	for sc := range info.ReadySCs {
+		scs = append(scs, sc)
+	}
+	return &randomPicker{subConns: scs}
+}
+
+type randomPicker struct {
+	subConns []balancer.SubConn
+}
+
+func (p *randomPicker) Pick(balancer.PickInfo) (balancer.PickResult, error) {
+	return balancer.PickResult{SubConn: p.subConns[rand.Intn(len(p.subConns))]}, nil
+}
+
+type selectorBalancerBuilder struct{}
+
+func (*selectorBalancerBuilder) Build(cc balancer.ClientConn, opts balancer.BuildOptions) balancer.Balancer {
+	pb := &selectorPickerBuilder{
+		service:  opts.Target.Endpoint,
+		selector: selector.NewSelector(),
+	}
+	return &selectorBalancer{
+		Balancer: base.NewBalancerBuilder(BalancerSelector, pb, base.Config{HealthCheck: true}).Build(cc, opts),
+		pb:       pb,
+	}
+}
+
+func (*selectorBalancerBuilder) Name() string {
+	return BalancerSelector
+}
+
+// selectorBalancer 从 resolver state 中取得 selector, 其余交给 base balancer
+type selectorBalancer struct {
+	balancer.Balancer
+	pb *selectorPickerBuilder
+}
+
+func (b *selectorBalancer) UpdateClientConnState(s balancer.ClientConnState) error {
+	// balancer 的方法由 grpc 串行调用, picker 也在这些调用中构建, 不需要加锁
+	if s.ResolverState.Attributes != nil {
+		if sel, ok := s.ResolverState.Attributes.Value(selectorKey{}).(selector.Selector); ok {
+			b.pb.selector = sel
+		}
+	}
+	return b.Balancer.UpdateClientConnState(s)
+}
+
+type selectorPickerBuilder struct {
+	service  string
+	selector selector.Selector
+}
+
+func (b *selectorPickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+
+	// 已就绪的连接按版本还原为服务列表, 作为 selector 的候选
+	p := &selectorPicker{
+		service:  b.service,
+		selector: b.selector,
+		subConns: make(map[string]balancer.SubConn, len(info.ReadySCs)),
+	}
+	versions := make(map[string]*registry.Service)
+	for sc, sci := range info.ReadySCs {
+		node := AddressNode(sci.Address)
+		if node == nil {
+			continue
+		}
+		version := AddressVersion(sci.Address)
+		service, ok := versions[version]
+		if !ok {
+			service = &registry.Service{Name: b.service, Version: version}
+			versions[version] = service
+			p.services = append(p.services, service)
+		}
+		service.Nodes = append(service.Nodes, node)
+		p.subConns[sci.Address.Addr] = sc
+	}
+	if len(p.services) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+	return p
+}
+
+type selectorPicker struct {
+	service  string
+	selector selector.Selector
+	services []*registry.Service
+	// subConns address -> 连接
+	subConns map[string]balancer.SubConn
+}
+
+func (p *selectorPicker) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
+	opts := []selector.SelectOption{selector.WithServices(p.services)}
+	if md, ok := metadata.FromOutgoingContext(info.Ctx); ok {
+		opts = append(opts, selector.WithMetadata(firstValues(md)))
+	}
+	opts = append(opts, selector.FromContext(info.Ctx)...)
+	next, err := p.selector.Select(p.service, opts...)
+	if err != nil {
+		return balancer.PickResult{}, status.Errorf(codes.Unavailable, "select %s: %v", p.service, err)
+	}
+
+	// 自定义 selector 可能返回未就绪的节点, 最多尝试与就绪连接数相同的次数
+	for i := 0; i < len(p.subConns); i++ {
+		node, err := next()
+		if err != nil {
+			return balancer.PickResult{}, status.Errorf(codes.Unavailable, "select %s: %v", p.service, err)
+		}
+
+		sc, ok := p.subConns[net.JoinHostPort(node.Address, strconv.Itoa(node.Port))]
+		if !ok {
+			continue
+		}
+		done := selector.Track(node)
+		return balancer.PickResult{
+			SubConn: sc,
+			Done: func(di balancer.DoneInfo) {
+				done()
+				p.selector.Mark(p.service, node, di.Err)
+			},
+		}, nil
+	}
+	return balancer.PickResult{}, status.Errorf(codes.Unavailable, "select %s: %v", p.service, selector.ErrNoneAvailable)
+}
+
+// firstValues 每个 key 只取第一个值, 供路由规则匹配
+func firstValues(md metadata.MD) map[string]string {
+	values := make(map[string]string, len(md))
+	for k, v := range md {
+		if len(v) > 0 {
+			values[k] = v[0]
+		}
+	}
+	return values
+}
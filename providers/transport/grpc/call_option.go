@@ -0,0 +1,60 @@
+package grpc
+
+import (
+	"context"
+
+	"github.com/aka-yz/go-micro-core/providers/transport/grpc/selector"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// selectCallOption 单次调用的 SelectOption, 由 selectorInterceptor 放入 context
+type selectCallOption struct {
+	grpc.EmptyCallOption
+	opts []selector.SelectOption
+}
+
+// WithSelectOption 为单次调用指定 filter, strategy 等, 只对 selector balancer 生效
+func WithSelectOption(opts ...selector.SelectOption) grpc.CallOption {
+	return selectCallOption{opts: opts}
+}
+
+// selectContext 把调用的 SelectOption 放入 context. hashHeader 不为空且调用没有指定
+// hash key 时, 使用 outgoing metadata 中该 header 的值
+func selectContext(ctx context.Context, opts []grpc.CallOption, hashHeader string) context.Context {
+	var sopts []selector.SelectOption
+	for _, o := range opts {
+		if so, ok := o.(selectCallOption); ok {
+			sopts = append(sopts, so.opts...)
+		}
+	}
+
+	if hashHeader != "" {
+		var so selector.SelectOptions
+		for _, o := range append(selector.FromContext(ctx), sopts...) {
+			o(&so)
+		}
+		if md, ok := metadata.FromOutgoingContext(ctx); ok && so.HashKey == "" {
+			if v := md.Get(hashHeader); len(v) > 0 {
+				sopts = append(sopts, selector.WithHashKey(v[0]))
+			}
+		}
+	}
+
+	if len(sopts) == 0 {
+		return ctx
+	}
+	return selector.NewContext(ctx, sopts...)
+}
+
+func selectorUnaryInterceptor(hashHeader string) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(selectContext(ctx, opts, hashHeader), method, req, reply, cc, opts...)
+	}
+}
+
+func selectorStreamInterceptor(hashHeader string) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(selectContext(ctx, opts, hashHeader), desc, cc, method, opts...)
+	}
+}
@@ -3,15 +3,16 @@ package grpc
 import (
 	"fmt"
 	"github.com/aka-yz/go-micro-core"
+	"github.com/aka-yz/go-micro-core/providers/transport/discovery"
 	"github.com/aka-yz/go-micro-core/providers/transport/grpc/interceptors"
 	"github.com/aka-yz/go-micro-core/providers/transport/grpc/selector"
+	"github.com/aka-yz/go-micro-core/providers/transport/tlsconfig"
 	registry "github.com/aka-yz/go-micro-core/register"
-	"github.com/aka-yz/go-micro-core/register/etcdv3"
 	middleware "github.com/grpc-ecosystem/go-grpc-middleware"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/naming"
+	"google.golang.org/grpc/credentials"
+	"log"
 	"sync"
-	"time"
 
 	"go.uber.org/config"
 )
@@ -19,40 +20,144 @@ import (
 type clientFactory struct{}
 
 func (n *clientFactory) NewProvider(conf config.Provider) go_micro_core.Provider {
-	if cfg := getRegistryConfig(conf); cfg != nil {
-		return go_micro_core.NewProvider(newRPCClient(cfg))
+	cfg, err := discovery.GetConfig(conf)
+	if err != nil {
+		log.Printf("rpcclient config error:%v", err)
+		return nil
+	}
+	if cfg != nil {
+		clientCfg, err := getClientConfig(conf)
+		if err != nil {
+			log.Printf("rpcclient config error:%v", err)
+			return nil
+		}
+		client, err := newRPCClient(cfg, clientCfg)
+		if err != nil {
+			log.Printf("rpcclient config error:%v", err)
+			return nil
+		}
+		return go_micro_core.NewProvider(client)
 	}
 	return nil
 }
 
-func newRPCClient(options *registryConfig) *RPCClient {
+func newRPCClient(options *discovery.Config, cfg *clientConfig) (_ *RPCClient, err error) {
 	if options == nil {
-		return nil
+		return nil, nil
 	}
 
-	register := etcdv3.NewRegistry(
-		registry.Addrs(options.Addrs...),
-		registry.Timeout(time.Second*time.Duration(options.RegistryTTL)),
-	)
+	register, err := discovery.NewRegistry(options)
+	if err != nil {
+		return nil, err
+	}
+	var reloaders []*tlsconfig.Reloader
+	defer func() {
+		if err != nil {
+			registry.Stop(register)
+			for _, r := range reloaders {
+				r.Close()
+			}
+		}
+	}()
+
+	selectorOptions := []selector.Option{
+		selector.Registry(register),
+		selector.SetStrategy(selector.Random),
+	}
+	if cfg.Strategy != "" {
+		strategy, err := selector.Named(cfg.Strategy)
+		if err != nil {
+			return nil, err
+		}
+		selectorOptions = append(selectorOptions, strategy)
+	}
+
+	if cfg.Health != nil {
+		selectorOptions = append(selectorOptions, selector.Health(cfg.Health.options()))
+	}
+	for name, svc := range cfg.Services {
+		if svc != nil && svc.Health != nil {
+			selectorOptions = append(selectorOptions, selector.ServiceHealth(name+serviceSuffix, svc.Health.options()))
+		}
+	}
+
+	router, stopRules, err := newRouter(options, cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil && stopRules != nil {
+			stopRules()
+		}
+	}()
+	if router != nil {
+		selectorOptions = append(selectorOptions, selector.SetRouter(router))
+	}
+
+	sel := selector.NewSelector(selectorOptions...)
+	if l := cfg.Locality; l != nil {
+		sel = selector.NewLocalitySelector(sel, l.zone, l.region, l.Threshold)
+	}
 
-	return NewClient(
-		WithSuffix("-rpc"),
-		WithSelector(selector.NewSelector(
-			selector.Registry(register),
-			selector.SetStrategy(selector.Random),
-		)),
+	clientOptions := []ClientOption{
+		WithSuffix(serviceSuffix),
+		WithSelector(sel),
 		WithInterceptor(
 			interceptors.UnaryClientInterceptor(),
 		),
-	)
+		WithStreamInterceptor(
+			interceptors.StreamClientInterceptor(),
+		),
+		WithConnOption(WithHashHeader(cfg.HashHeader)),
+	}
+	if cfg.TLS != nil {
+		r, err := tlsconfig.NewReloader(*cfg.TLS)
+		if err != nil {
+			return nil, fmt.Errorf("tls config error:%v", err)
+		}
+		reloaders = append(reloaders, r)
+		clientOptions = append(clientOptions, WithConnOption(WithCredentials(credentials.NewTLS(r.ClientConfig()))))
+	}
+	for name, svc := range cfg.Services {
+		if svc != nil && svc.TLS != nil {
+			r, err := tlsconfig.NewReloader(*svc.TLS)
+			if err != nil {
+				return nil, fmt.Errorf("service:%v tls config error:%v", name, err)
+			}
+			reloaders = append(reloaders, r)
+			clientOptions = append(clientOptions, WithServiceConnOption(name, WithCredentials(credentials.NewTLS(r.ClientConfig()))))
+		}
+	}
+	if cfg.Pool != nil {
+		clientOptions = append(clientOptions, WithConnOption(cfg.Pool.options()...))
+	}
+	clientOptions = append(clientOptions, WithServiceInterceptors(cfg.serviceInterceptors))
+	client := NewClient(clientOptions...)
+	client.registry = register
+	client.reloaders = reloaders
+	client.stopRules = stopRules
+	return client, nil
 }
 
 type RPCClient struct {
 	connMap map[string]*serviceConn
 	opts    ClientOptions
+	stopped bool
+	// registry, 证书的 reloaders 和路由规则的 etcd 监听由 newRPCClient 创建, Stop 时一起释放
+	registry  registry.Registry
+	reloaders []*tlsconfig.Reloader
+	stopRules func()
+	// dialing 正在创建连接池的 target, 同一个 target 只创建一次, 其他调用等待结果
+	dialing map[string]*dialCall
 	sync.Mutex
 }
 
+// dialCall 一次连接池的创建, done 关闭后 err 可读
+type dialCall struct {
+	done chan struct{}
+	err  error
+}
+
 func NewClient(opts ...ClientOption) *RPCClient {
 	var opt ClientOptions
 	for _, o := range opts {
@@ -62,25 +167,94 @@ func NewClient(opts ...ClientOption) *RPCClient {
 	return &RPCClient{
 		opts:    opt,
 		connMap: make(map[string]*serviceConn),
+		dialing: make(map[string]*dialCall),
 	}
 }
 
 func (c *RPCClient) GetConn(service string, opts ...ConnOption) (conn *grpc.ClientConn, err error) {
 	target := service + c.opts.suffix
+	connOptions := append(append(append([]ConnOption(nil), c.opts.connOptions...), c.opts.serviceConnOptions[service]...), opts...)
 	c.Lock()
-	defer c.Unlock()
+	if c.stopped {
+		c.Unlock()
+		return nil, ErrClientStopped
+	}
 	if sc, ok := c.connMap[target]; ok {
-		return sc.getConn(), nil
+		c.Unlock()
+		// 已有连接池时, 显式传入的 ConnOption 必须与创建时一致
+		if len(opts) > 0 {
+			if requested := newConnOptions(connOptions...); !requested.equal(&sc.requested) {
+				return nil, fmt.Errorf("service:%s %w", service, ErrConnOptionConflict)
+			}
+		}
+		return sc.getConn()
+	}
+	if call, ok := c.dialing[target]; ok {
+		c.Unlock()
+		<-call.done
+		if call.err != nil {
+			return nil, call.err
+		}
+		// 连接池已经创建, 重新获取时检查 ConnOption
+		return c.GetConn(service, opts...)
+	}
+	call := &dialCall{done: make(chan struct{})}
+	c.dialing[target] = call
+	c.Unlock()
+
+	// 不存在连接, 不持有 client 的锁创建, 避免阻塞其他服务
+	sc := NewServiceConn(target, connOptions...)
+	// 服务的拦截器在连接的拦截器之前
+	var unary []grpc.UnaryClientInterceptor
+	var stream []grpc.StreamClientInterceptor
+	if c.opts.serviceInterceptorsFunc != nil {
+		unary, stream = c.opts.serviceInterceptorsFunc(service)
 	}
+	unary = append(unary, c.opts.serviceInterceptors[service]...)
+	sc.opts.interceptors = append(unary, sc.opts.interceptors...)
+	sc.opts.streamInterceptors = append(stream, sc.opts.streamInterceptors...)
+	conn, err = sc.CreateConn(c.opts.selector, c.opts.interceptors, c.opts.streamInterceptors)
 
-	// 不存在连接
-	sc := NewServiceConn(target, opts...)
-	if conn, err = sc.CreateConn(c.opts.selector.Options().Registry, c.opts.interceptors); err == nil {
-		c.connMap[target] = sc
+	c.Lock()
+	delete(c.dialing, target)
+	if err == nil {
+		if c.stopped {
+			// 创建期间已经 Stop
+			sc.Close()
+			conn, err = nil, ErrClientStopped
+		} else {
+			c.connMap[target] = sc
+		}
 	}
+	c.Unlock()
+	call.err = err
+	close(call.done)
 	return
 }
 
+// Stop 关闭所有连接池, 之后 GetConn 返回 ErrClientStopped
+func (c *RPCClient) Stop() {
+	c.Lock()
+	defer c.Unlock()
+	c.stopped = true
+	for target, sc := range c.connMap {
+		sc.Close()
+		delete(c.connMap, target)
+	}
+	if c.registry != nil {
+		registry.Stop(c.registry)
+		c.registry = nil
+	}
+	for _, r := range c.reloaders {
+		r.Close()
+	}
+	c.reloaders = nil
+	if c.stopRules != nil {
+		c.stopRules()
+		c.stopRules = nil
+	}
+}
+
 func (c *RPCClient) AddInterceptorsTail(interceptors ...grpc.UnaryClientInterceptor) {
 	c.opts.interceptors = append(c.opts.interceptors, interceptors...)
 }
@@ -89,122 +263,147 @@ func (c *RPCClient) AddInterceptorsHead(interceptors ...grpc.UnaryClientIntercep
 	c.opts.interceptors = append(interceptors, c.opts.interceptors...)
 }
 
+func (c *RPCClient) AddStreamInterceptorsTail(interceptors ...grpc.StreamClientInterceptor) {
+	c.opts.streamInterceptors = append(c.opts.streamInterceptors, interceptors...)
+}
+
+func (c *RPCClient) AddStreamInterceptorsHead(interceptors ...grpc.StreamClientInterceptor) {
+	c.opts.streamInterceptors = append(interceptors, c.opts.streamInterceptors...)
+}
+
 type serviceConn struct {
-	conns  []*grpc.ClientConn
 	target string
 	opts   ConnOptions
+	// requested 创建时请求的 ConnOptions, 用于检查之后的 GetConn 是否冲突
+	requested   ConnOptions
+	dialOptions []grpc.DialOption
+
+	sync.Mutex
+	// conns 长度为 connNum, 为 nil 的连接在选中时创建
+	conns  []*pooledConn
+	next   int
+	closed bool
+	stop   chan struct{}
 }
 
 func NewServiceConn(target string, opts ...ConnOption) *serviceConn {
-	var opt ConnOptions
-	for _, o := range opts {
-		o(&opt)
-	}
+	opt := newConnOptions(opts...)
 	return &serviceConn{
-		target: target,
-		opts:   opt,
+		target:    target,
+		opts:      opt,
+		requested: opt,
+		conns:     make([]*pooledConn, opt.connNum),
+		stop:      make(chan struct{}),
 	}
 }
 
-func (c *serviceConn) CreateConn(registry registry.Registry, inters []grpc.UnaryClientInterceptor) (conn *grpc.ClientConn, err error) {
+// CreateConn 通过 selector 的 registry 解析 target, 默认由 selector 选择节点.
+// 只创建连接池的第一个连接, 其余的在选中时创建
+func (c *serviceConn) CreateConn(sel selector.Selector, inters []grpc.UnaryClientInterceptor, streamInters []grpc.StreamClientInterceptor) (conn *grpc.ClientConn, err error) {
 	c.opts.interceptors = append(c.opts.interceptors, inters...)
-
-	dialOptions := []grpc.DialOption{
-		grpc.WithInsecure(),
-		grpc.WithUnaryInterceptor(middleware.ChainUnaryClient(c.opts.interceptors...)),
+	c.opts.streamInterceptors = append(c.opts.streamInterceptors, streamInters...)
+
+	c.dialOptions = []grpc.DialOption{
+		// selectorInterceptor 在最前, 后续拦截器也能看到调用的 SelectOption
+		// deadline 在最后, 每次重试都传递当时剩余的时间
+		grpc.WithUnaryInterceptor(middleware.ChainUnaryClient(append(append(
+			[]grpc.UnaryClientInterceptor{selectorUnaryInterceptor(c.opts.hashHeader)},
+			c.opts.interceptors...),
+			interceptors.DeadlineUnaryClientInterceptor())...)),
+		grpc.WithStreamInterceptor(middleware.ChainStreamClient(append(append(
+			[]grpc.StreamClientInterceptor{selectorStreamInterceptor(c.opts.hashHeader)},
+			c.opts.streamInterceptors...),
+			interceptors.DeadlineStreamClientInterceptor())...)),
 	}
+	if c.opts.creds != nil {
+		c.dialOptions = append(c.dialOptions, grpc.WithTransportCredentials(c.opts.creds))
+	} else {
+		c.dialOptions = append(c.dialOptions, grpc.WithInsecure())
+	}
+
 	if c.opts.block {
-		dialOptions = append(dialOptions, grpc.WithBlock())
+		c.dialOptions = append(c.dialOptions, grpc.WithBlock())
 	}
 
 	if c.opts.timeout != 0 {
-		dialOptions = append(dialOptions, grpc.WithTimeout(c.opts.timeout))
+		c.dialOptions = append(c.dialOptions, grpc.WithTimeout(c.opts.timeout))
 	}
 
 	if c.opts.maxSize != 0 {
-		dialOptions = append(dialOptions, grpc.WithMaxMsgSize(c.opts.maxSize))
+		c.dialOptions = append(c.dialOptions, grpc.WithMaxMsgSize(c.opts.maxSize))
 	}
 
-	if c.opts.balanceName == "" {
-		dialOptions = append(dialOptions, grpc.WithBalancer(grpc.RoundRobin(&resolver{registry: registry})))
-	} else {
-		dialOptions = append(dialOptions, grpc.WithBalancerName(c.opts.balanceName))
+	balanceName := c.opts.balanceName
+	if balanceName == "" {
+		balanceName = BalancerSelector
 	}
+	c.dialOptions = append(c.dialOptions,
+		grpc.WithResolvers(NewResolverBuilder(sel.Options().Registry, sel)),
+		grpc.WithDefaultServiceConfig(fmt.Sprintf(`{"loadBalancingConfig":[{%q:{}}]}`, balanceName)),
+	)
 
-	conn, err = grpc.Dial(c.target, dialOptions...)
+	pc, err := c.dial()
 	if err != nil {
 		return
 	}
+	c.Lock()
+	c.conns[0] = pc
+	// 第一个连接已经返回, 轮询从下一个开始
+	c.next = 1
+	c.Unlock()
 
-	c.conns = append(c.conns, conn)
-	return
-}
-
-func (c *serviceConn) getConn() *grpc.ClientConn {
-	return c.conns[0]
-}
-
-type resolver struct {
-	registry registry.Registry
+	if c.opts.idleTimeout > 0 && len(c.conns) > 1 {
+		go c.reap()
+	}
+	return pc.ClientConn, nil
 }
 
-func (r *resolver) Resolve(target string) (naming.Watcher, error) {
-	w, err := r.registry.Watch(target)
+func (c *serviceConn) dial() (*pooledConn, error) {
+	pc := &pooledConn{}
+	conn, err := grpc.Dial(Scheme+":///"+c.target, append(c.dialOptions,
+		grpc.WithChainUnaryInterceptor(pc.unaryInterceptor),
+		grpc.WithChainStreamInterceptor(pc.streamInterceptor))...)
 	if err != nil {
 		return nil, err
 	}
-	return &watcher{
-		w:      w,
-		r:      r.registry,
-		target: target,
-	}, nil
+	pc.ClientConn = conn
+	pc.touch()
+	return pc, nil
 }
 
-type watcher struct {
-	isinitialized bool
-	target        string
-	w             registry.Watcher
-	r             registry.Registry
-}
+// getConn 按 policy 从连接池中选择连接, 选中的连接不存在时创建
+func (c *serviceConn) getConn() (*grpc.ClientConn, error) {
+	c.Lock()
+	defer c.Unlock()
+	if c.closed {
+		return nil, ErrClientStopped
+	}
 
-func (w *watcher) Next() (updates []*naming.Update, err error) {
-	if !w.isinitialized {
-		ss, err := w.r.GetService(w.target)
+	i := c.pick()
+	if c.conns[i] == nil {
+		pc, err := c.dial()
 		if err != nil {
 			return nil, err
 		}
-
-		for _, s := range ss {
-			updates = append(updates, w.update("create", s)...)
-		}
-		w.isinitialized = true
-		return updates, nil
+		c.conns[i] = pc
 	}
-
-	ret, err := w.w.Next()
-	if err != nil {
-		return
-	}
-
-	return w.update(ret.Action, ret.Service), nil
-}
-
-// Close closes the Watcher.
-func (w *watcher) Close() {
-	w.w.Stop()
+	c.conns[i].touch()
+	return c.conns[i].ClientConn, nil
 }
 
-func (w *watcher) update(action string, service *registry.Service) (updates []*naming.Update) {
-	var op naming.Operation
-	switch action {
-	case "create":
-		op = naming.Add
-	case "delete":
-		op = naming.Delete
+// Close 关闭连接池的所有连接
+func (c *serviceConn) Close() {
+	c.Lock()
+	defer c.Unlock()
+	if c.closed {
+		return
 	}
-
-	for _, node := range service.Nodes {
-		updates = append(updates, &naming.Update{Op: op, Addr: fmt.Sprintf("%s:%d", node.Address, node.Port)})
+	c.closed = true
+	close(c.stop)
+	for i, pc := range c.conns {
+		if pc != nil {
+			_ = pc.Close()
+			c.conns[i] = nil
+		}
 	}
-	return
 }
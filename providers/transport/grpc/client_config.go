@@ -0,0 +1,383 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aka-yz/go-micro-core/providers/option"
+	"github.com/aka-yz/go-micro-core/providers/transport/auth"
+	"github.com/aka-yz/go-micro-core/providers/transport/breaker"
+	"github.com/aka-yz/go-micro-core/providers/transport/discovery"
+	"github.com/aka-yz/go-micro-core/providers/transport/grpc/interceptors"
+	"github.com/aka-yz/go-micro-core/providers/transport/grpc/selector"
+	"github.com/aka-yz/go-micro-core/providers/transport/ratelimit"
+	"github.com/aka-yz/go-micro-core/providers/transport/tlsconfig"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.uber.org/config"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// serviceSuffix rpc 服务注册名的后缀, server 注册和 client 查找使用同一个
+const serviceSuffix = "-rpc"
+
+// rulesDialTimeout 连接路由规则 etcd 的超时
+var rulesDialTimeout = 5 * time.Second
+
+// clientConfig rpcclient 配置, 可以不配置
+type clientConfig struct {
+	// Strategy 节点选择策略: random(default), round_robin, weighted_random, weighted_round_robin,
+	// least_outstanding, p2c_ewma, ring_hash, maglev
+	Strategy string
+	// HashHeader ring_hash/maglev 的 hash key 取自该 grpc metadata
+	HashHeader string
+	// Locality 不为空时优先选择同 zone/region 的节点
+	Locality *localityConfig
+	// Health 节点摘除的阈值, Services 中可以按服务覆盖
+	Health *healthConfig
+	// Services 按服务(不带 -rpc 后缀)的配置
+	Services map[string]*serviceClientConfig
+	// RulesPrefix 不为空时从 etcd 加载路由规则并热更新,
+	// key 为 <prefix>/<服务注册名>, 如 /micro/routes/user-rpc
+	RulesPrefix string
+	// RulesAddrs 路由规则 etcd 的地址, 为空时使用 etcdv3 registry 的 addrs
+	RulesAddrs []string
+	// Breaker/RateLimit 所有服务默认的熔断和限流, Services 中可以按服务覆盖.
+	// 熔断按服务和方法区分, 限流按服务
+	Breaker   *option.BreakerConfig
+	RateLimit *option.RateLimitConfig
+	// Pool 每个服务的连接池
+	Pool *poolConfig
+	// TLS 所有服务默认的 tls 配置, Services 中可以按服务覆盖
+	TLS *tlsconfig.Config
+	// Auth 所有服务默认携带的凭证, Services 中可以按服务覆盖
+	Auth *option.CredentialsConfig
+
+	// 按服务缓存的熔断, 限流和重试额度, 连接重建后继续使用同一份状态
+	mu       sync.Mutex
+	breakers map[string]*breaker.Group
+	limiters map[string]*ratelimit.Limiter
+	budgets  map[string]*interceptors.RetryBudget
+}
+
+// poolConfig Policy 为 round_robin(default) 或 least_streams, IdleTimeout 单位为秒
+type poolConfig struct {
+	Size        int
+	Policy      string
+	IdleTimeout int
+}
+
+func (p *poolConfig) validate() error {
+	switch p.Policy {
+	case "", PoolRoundRobin, PoolLeastStreams:
+		return nil
+	}
+	return fmt.Errorf("unknown pool policy:%v", p.Policy)
+}
+
+func (p *poolConfig) options() []ConnOption {
+	return []ConnOption{
+		WithConnNum(int64(p.Size)),
+		WithPoolPolicy(p.Policy),
+		WithIdleTimeout(time.Second * time.Duration(p.IdleTimeout)),
+	}
+}
+
+type serviceClientConfig struct {
+	Health *healthConfig
+	// Route 版本分流规则, etcd 中有同一服务的规则时以 etcd 为准
+	Route *selector.Rule
+	// Timeout 调用方没有设置 deadline 时的默认超时(毫秒), Timeouts 按方法覆盖
+	Timeout  int
+	Timeouts map[string]int
+	// Retry/Hedge 只对其中配置的幂等方法生效, 同一个方法不要同时配置
+	Retry *retryConfig
+	Hedge *hedgeConfig
+
+	Breaker   *option.BreakerConfig
+	RateLimit *option.RateLimitConfig
+
+	TLS  *tlsconfig.Config
+	Auth *option.CredentialsConfig
+}
+
+// retryConfig 时间单位为毫秒, 0 使用默认值
+type retryConfig struct {
+	Methods        []string
+	MaxAttempts    int
+	InitialBackoff int
+	MaxBackoff     int
+	Jitter         float64
+	// Codes grpc code 名称, 如 Unavailable, 默认只有 Unavailable
+	Codes []string
+	// BudgetRatio 不为 0 时重试次数不超过请求数的该比例, 另外每秒允许 BudgetMinPerSecond 次
+	BudgetRatio        float64
+	BudgetMinPerSecond float64
+
+	codes []codes.Code
+}
+
+// hedgeConfig 时间单位为毫秒, 0 使用默认值
+type hedgeConfig struct {
+	Methods     []string
+	MaxAttempts int
+	Percentile  float64
+	Delay       int
+	MinDelay    int
+	Codes       []string
+
+	codes []codes.Code
+}
+
+type localityConfig struct {
+	// Threshold 本地可用容量低于该比例时溢出到其他 zone, 默认 0.5
+	Threshold float64
+
+	// zone/region 与服务注册使用相同的来源
+	zone, region string
+}
+
+// healthConfig 时间单位为秒, 0 使用默认值
+type healthConfig struct {
+	ConsecutiveErrors int
+	ErrorRate         float64
+	MinRequests       int
+	Interval          int
+	BaseEjection      int
+	MaxEjection       int
+}
+
+func (h *healthConfig) options() selector.HealthOptions {
+	return selector.HealthOptions{
+		ConsecutiveErrors: h.ConsecutiveErrors,
+		ErrorRate:         h.ErrorRate,
+		MinRequests:       h.MinRequests,
+		Interval:          time.Second * time.Duration(h.Interval),
+		BaseEjection:      time.Second * time.Duration(h.BaseEjection),
+		MaxEjection:       time.Second * time.Duration(h.MaxEjection),
+	}
+}
+
+func getClientConfig(conf config.Provider) (*clientConfig, error) {
+	var cfg clientConfig
+	if cv := conf.Get("rpcclient"); cv.HasValue() {
+		if err := cv.Populate(&cfg); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Locality != nil {
+		cfg.Locality.zone, cfg.Locality.region = discovery.Locality(conf)
+	}
+	if cfg.Pool != nil {
+		if err := cfg.Pool.validate(); err != nil {
+			return nil, err
+		}
+	}
+	for name, svc := range cfg.Services {
+		if svc == nil {
+			continue
+		}
+		if err := svc.parse(); err != nil {
+			return nil, fmt.Errorf("service:%v %v", name, err)
+		}
+	}
+	return &cfg, nil
+}
+
+// parse 解析重试和对冲的 grpc code 名称
+func (s *serviceClientConfig) parse() (err error) {
+	if r := s.Retry; r != nil {
+		if r.codes, err = parseCodes(r.Codes); err != nil {
+			return
+		}
+	}
+	if h := s.Hedge; h != nil {
+		h.codes, err = parseCodes(h.Codes)
+	}
+	return
+}
+
+// newRouter 从配置和 etcd 加载路由规则, 没有规则来源时返回 nil.
+// 配置的规则作为 base, etcd 的规则覆盖它, etcd 删除后恢复.
+// stop 不为空时停止监听 etcd 并关闭连接
+func newRouter(options *discovery.Config, cfg *clientConfig) (_ *selector.Router, stop func(), err error) {
+	router := selector.NewRouter()
+	var configured bool
+	for name, svc := range cfg.Services {
+		if svc == nil || svc.Route == nil {
+			continue
+		}
+		if err := router.SetBase(name+serviceSuffix, svc.Route); err != nil {
+			return nil, nil, fmt.Errorf("rpcclient route config error:%v", err)
+		}
+		configured = true
+	}
+
+	if cfg.RulesPrefix != "" {
+		addrs := cfg.RulesAddrs
+		if len(addrs) == 0 {
+			// 其他类型 registry 的 addrs 不是 etcd 地址
+			if !options.Etcd() {
+				return nil, nil, fmt.Errorf("rpcclient rulesprefix requires rulesaddrs with registry type:%v", options.Type)
+			}
+			addrs = options.Addrs
+		}
+		client, err := clientv3.New(clientv3.Config{Endpoints: addrs, DialTimeout: rulesDialTimeout})
+		if err != nil {
+			return nil, nil, fmt.Errorf("rpcclient rules etcd error:%v", err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		if err = selector.WatchRules(ctx, client, cfg.RulesPrefix, router); err != nil {
+			cancel()
+			client.Close()
+			return nil, nil, fmt.Errorf("rpcclient rules etcd error:%v", err)
+		}
+		stop = func() {
+			cancel()
+			client.Close()
+		}
+		configured = true
+	}
+
+	if !configured {
+		return nil, nil, nil
+	}
+	return router, stop, nil
+}
+
+// serviceInterceptors 服务的 client 拦截器: 默认超时, 限流, 熔断, 重试, 对冲, 凭证.
+// 熔断在重试之前, 打开时不再重试
+func (c *clientConfig) serviceInterceptors(service string) (unary []grpc.UnaryClientInterceptor, stream []grpc.StreamClientInterceptor) {
+	s := c.Services[service]
+	if s == nil {
+		s = &serviceClientConfig{}
+	}
+
+	if s.Timeout > 0 || len(s.Timeouts) > 0 {
+		timeouts := make(map[string]time.Duration, len(s.Timeouts))
+		for method, ms := range s.Timeouts {
+			timeouts[method] = time.Millisecond * time.Duration(ms)
+		}
+		unary = append(unary, interceptors.TimeoutUnaryClientInterceptor(time.Millisecond*time.Duration(s.Timeout), timeouts))
+	}
+
+	limit := c.RateLimit
+	if s.RateLimit != nil {
+		limit = s.RateLimit
+	}
+	if limit != nil && limit.Rate > 0 {
+		l := c.limiter(service, limit)
+		unary = append(unary, interceptors.RateLimitUnaryClientInterceptor(l, limit.Wait))
+		stream = append(stream, interceptors.RateLimitStreamClientInterceptor(l, limit.Wait))
+	}
+
+	b := c.Breaker
+	if s.Breaker != nil {
+		b = s.Breaker
+	}
+	if b != nil {
+		g := c.breaker(service, b)
+		unary = append(unary, interceptors.BreakerUnaryClientInterceptor(g))
+		stream = append(stream, interceptors.BreakerStreamClientInterceptor(g))
+	}
+
+	if r := s.Retry; r != nil {
+		policy := interceptors.RetryPolicy{
+			Methods:        r.Methods,
+			MaxAttempts:    r.MaxAttempts,
+			InitialBackoff: time.Millisecond * time.Duration(r.InitialBackoff),
+			MaxBackoff:     time.Millisecond * time.Duration(r.MaxBackoff),
+			Jitter:         r.Jitter,
+			Codes:          r.codes,
+		}
+		if r.BudgetRatio > 0 {
+			policy.Budget = c.budget(service, r)
+		}
+		unary = append(unary, interceptors.RetryUnaryClientInterceptor(policy))
+	}
+
+	if h := s.Hedge; h != nil {
+		unary = append(unary, interceptors.HedgeUnaryClientInterceptor(interceptors.HedgePolicy{
+			Methods:     h.Methods,
+			MaxAttempts: h.MaxAttempts,
+			Percentile:  h.Percentile,
+			Delay:       time.Millisecond * time.Duration(h.Delay),
+			MinDelay:    time.Millisecond * time.Duration(h.MinDelay),
+			Codes:       h.codes,
+		}))
+	}
+
+	// 凭证在重试和对冲之后, 每次请求使用新的签名 nonce
+	creds := c.Auth
+	if s.Auth != nil {
+		creds = s.Auth
+	}
+	if creds != nil {
+		signer := auth.NewSigner(*creds)
+		unary = append(unary, interceptors.AuthUnaryClientInterceptor(signer))
+		stream = append(stream, interceptors.AuthStreamClientInterceptor(signer))
+	}
+	return
+}
+
+func (c *clientConfig) breaker(service string, b *option.BreakerConfig) *breaker.Group {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if g, ok := c.breakers[service]; ok {
+		return g
+	}
+	if c.breakers == nil {
+		c.breakers = make(map[string]*breaker.Group)
+	}
+	g := breaker.NewGroup(breaker.ConfigOptions(b))
+	c.breakers[service] = g
+	return g
+}
+
+func (c *clientConfig) limiter(service string, limit *option.RateLimitConfig) *ratelimit.Limiter {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if l, ok := c.limiters[service]; ok {
+		return l
+	}
+	if c.limiters == nil {
+		c.limiters = make(map[string]*ratelimit.Limiter)
+	}
+	l := ratelimit.NewLimiter(service+serviceSuffix, limit.Rate, limit.Burst, ratelimit.MetricsHook)
+	c.limiters[service] = l
+	return l
+}
+
+func (c *clientConfig) budget(service string, r *retryConfig) *interceptors.RetryBudget {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if b, ok := c.budgets[service]; ok {
+		return b
+	}
+	if c.budgets == nil {
+		c.budgets = make(map[string]*interceptors.RetryBudget)
+	}
+	b := interceptors.NewRetryBudget(r.BudgetRatio, r.BudgetMinPerSecond)
+	c.budgets[service] = b
+	return b
+}
+
+// parseCodes 解析 grpc code 名称, 支持 Unavailable, UNAVAILABLE, DEADLINE_EXCEEDED 等写法
+func parseCodes(names []string) (cs []codes.Code, err error) {
+	byName := make(map[string]codes.Code)
+	for c := codes.OK; c <= codes.Unauthenticated; c++ {
+		byName[strings.ToLower(c.String())] = c
+	}
+
+	for _, name := range names {
+		c, ok := byName[strings.ToLower(strings.ReplaceAll(name, "_", ""))]
+		if !ok {
+			return nil, fmt.Errorf("unknown grpc code:%v", name)
+		}
+		cs = append(cs, c)
+	}
+	return
+}
@@ -0,0 +1,56 @@
+package grpc
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aka-yz/go-micro-core/providers/transport/discovery"
+	"github.com/aka-yz/go-micro-core/providers/transport/tlsconfig"
+	"go.uber.org/config"
+	"google.golang.org/grpc/codes"
+)
+
+func TestClientConfig(t *testing.T) {
+	conf, err := config.NewYAML(config.Source(strings.NewReader(`
+rpcclient:
+  services:
+    user:
+      retry: {methods: [Get], codes: [UNAVAILABLE, DeadlineExceeded]}
+`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := getClientConfig(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cs := cfg.Services["user"].Retry.codes; len(cs) != 2 || cs[0] != codes.Unavailable || cs[1] != codes.DeadlineExceeded {
+		t.Fatalf("retry codes:%v", cs)
+	}
+
+	for _, bad := range []string{
+		"services: {user: {retry: {codes: [Unknownish]}}}",
+		"services: {user: {hedge: {codes: [NOPE]}}}",
+		"services: [1, 2]",
+		"pool: {policy: random}",
+	} {
+		conf, err := config.NewYAML(config.Source(strings.NewReader("rpcclient:\n  " + bad)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := getClientConfig(conf); err == nil {
+			t.Errorf("%s should fail", bad)
+		}
+	}
+
+	if _, err := newRPCClient(&discovery.Config{Type: "static"}, &clientConfig{Strategy: "unknown"}); err == nil {
+		t.Error("unknown strategy should fail")
+	}
+	if _, err := newRPCClient(&discovery.Config{Type: "static"}, &clientConfig{TLS: &tlsconfig.Config{CA: "missing.pem"}}); err == nil {
+		t.Error("missing ca should fail")
+	}
+	// static 的 addrs 不是 etcd 地址, 路由规则需要单独配置 rulesaddrs
+	if _, err := newRPCClient(&discovery.Config{Type: "static", Addrs: []string{"127.0.0.1:2379"}}, &clientConfig{RulesPrefix: "/micro/routes"}); err == nil {
+		t.Error("rulesprefix without etcd should fail")
+	}
+}
@@ -3,6 +3,7 @@ package grpc
 import (
 	"github.com/aka-yz/go-micro-core/providers/transport/grpc/selector"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"time"
 )
 
@@ -10,8 +11,19 @@ type ClientOptions struct {
 	suffix       string
 	selector     selector.Selector
 	interceptors []grpc.UnaryClientInterceptor
+	// streamInterceptors 所有连接的 stream 拦截器
+	streamInterceptors []grpc.StreamClientInterceptor
+	connOptions        []ConnOption
+	// serviceInterceptors 按服务名(不带后缀)的拦截器
+	serviceInterceptors     map[string][]grpc.UnaryClientInterceptor
+	serviceInterceptorsFunc ServiceInterceptors
+	// serviceConnOptions 按服务名(不带后缀)的 ConnOption, 在 connOptions 之后
+	serviceConnOptions map[string][]ConnOption
 }
 
+// ServiceInterceptors 按服务名(不带后缀)构建拦截器, 每个服务创建连接时调用一次
+type ServiceInterceptors func(service string) ([]grpc.UnaryClientInterceptor, []grpc.StreamClientInterceptor)
+
 type ClientOption func(*ClientOptions)
 
 func WithSuffix(suffix string) ClientOption {
@@ -26,20 +38,71 @@ func WithInterceptor(interceptors ...grpc.UnaryClientInterceptor) ClientOption {
 	}
 }
 
+func WithStreamInterceptor(interceptors ...grpc.StreamClientInterceptor) ClientOption {
+	return func(o *ClientOptions) {
+		o.streamInterceptors = interceptors
+	}
+}
+
 func WithSelector(selector selector.Selector) ClientOption {
 	return func(o *ClientOptions) {
 		o.selector = selector
 	}
 }
 
+// WithServiceInterceptor 只对该服务(不带后缀)的连接生效的拦截器, 在其他拦截器之前执行
+func WithServiceInterceptor(service string, interceptors ...grpc.UnaryClientInterceptor) ClientOption {
+	return func(o *ClientOptions) {
+		if o.serviceInterceptors == nil {
+			o.serviceInterceptors = make(map[string][]grpc.UnaryClientInterceptor)
+		}
+		o.serviceInterceptors[service] = append(o.serviceInterceptors[service], interceptors...)
+	}
+}
+
+// WithServiceInterceptors 所有服务的连接都通过 f 构建拦截器, 在 WithServiceInterceptor 之前执行
+func WithServiceInterceptors(f ServiceInterceptors) ClientOption {
+	return func(o *ClientOptions) {
+		o.serviceInterceptorsFunc = f
+	}
+}
+
+// WithConnOption 所有连接的默认 ConnOption, GetConn 传入的 ConnOption 优先
+func WithConnOption(opts ...ConnOption) ClientOption {
+	return func(o *ClientOptions) {
+		o.connOptions = append(o.connOptions, opts...)
+	}
+}
+
+// WithServiceConnOption 只对该服务(不带后缀)生效的 ConnOption, GetConn 传入的 ConnOption 优先
+func WithServiceConnOption(service string, opts ...ConnOption) ClientOption {
+	return func(o *ClientOptions) {
+		if o.serviceConnOptions == nil {
+			o.serviceConnOptions = make(map[string][]ConnOption)
+		}
+		o.serviceConnOptions[service] = append(o.serviceConnOptions[service], opts...)
+	}
+}
+
 type ConnOptions struct {
 	block        bool
 	connNum      int64
 	balanceName  string
+	hashHeader   string
 	maxSize      int
 	timeout      time.Duration
 	dials        []grpc.DialOption
 	interceptors []grpc.UnaryClientInterceptor
+	// streamInterceptors 在 selector 之后, deadline 之前执行
+	streamInterceptors []grpc.StreamClientInterceptor
+	// policy 连接池选择连接的策略, 默认 round_robin
+	policy string
+	// idleTimeout 大于 0 时关闭空闲超过该时间的连接(保留一个), 需要时重新创建
+	idleTimeout time.Duration
+	// creds 为空时不加密
+	creds credentials.TransportCredentials
+	// key 标识拦截器等无法比较的选项, 见 WithConnKey
+	key string
 }
 
 type ConnOption func(*ConnOptions)
@@ -50,15 +113,24 @@ func WithBlock(block bool) ConnOption {
 	}
 }
 
+// WithConnNum 每个服务的连接数, 默认 1
 func WithConnNum(count int64) ConnOption {
 	return func(o *ConnOptions) {
 		o.connNum = count
 	}
 }
 
+// WithConnInterceptor 追加连接的拦截器, 多次调用按顺序执行
 func WithConnInterceptor(interceptors ...grpc.UnaryClientInterceptor) ConnOption {
 	return func(o *ConnOptions) {
-		o.interceptors = interceptors
+		o.interceptors = append(o.interceptors, interceptors...)
+	}
+}
+
+// WithConnStreamInterceptor 追加连接的 stream 拦截器, 多次调用按顺序执行
+func WithConnStreamInterceptor(interceptors ...grpc.StreamClientInterceptor) ConnOption {
+	return func(o *ConnOptions) {
+		o.streamInterceptors = append(o.streamInterceptors, interceptors...)
 	}
 }
 
@@ -79,3 +151,39 @@ func WithMaxSize(s int) ConnOption {
 		o.maxSize = s
 	}
 }
+
+// WithHashHeader ring_hash/maglev 策略使用该 grpc metadata 的值作为 hash key
+func WithHashHeader(header string) ConnOption {
+	return func(o *ConnOptions) {
+		o.hashHeader = header
+	}
+}
+
+// WithPoolPolicy 连接池选择连接的策略: PoolRoundRobin, PoolLeastStreams
+func WithPoolPolicy(policy string) ConnOption {
+	return func(o *ConnOptions) {
+		o.policy = policy
+	}
+}
+
+// WithIdleTimeout 关闭没有进行中调用且空闲超过 d 的连接, 第一个连接保留.
+// 回收后原连接不可用, 每次调用前通过 GetConn 获取连接, 不要长期持有
+func WithIdleTimeout(d time.Duration) ConnOption {
+	return func(o *ConnOptions) {
+		o.idleTimeout = d
+	}
+}
+
+// WithConnKey 标识传入的拦截器, 已有连接池时 key 相同才视为同一组拦截器
+func WithConnKey(key string) ConnOption {
+	return func(o *ConnOptions) {
+		o.key = key
+	}
+}
+
+// WithCredentials 连接的传输层凭证, 如 credentials.NewTLS
+func WithCredentials(creds credentials.TransportCredentials) ConnOption {
+	return func(o *ConnOptions) {
+		o.creds = creds
+	}
+}
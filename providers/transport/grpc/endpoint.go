@@ -0,0 +1,111 @@
+package grpc
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	registry "github.com/aka-yz/go-micro-core/register"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// 请求/响应 schema 的最大嵌套层数
+const maxValueDepth = 3
+
+// serviceEndpoints 从 grpc server 已注册的服务中提取 endpoint,
+// 请求/响应 schema 从 proto 描述中获取
+func serviceEndpoints(server *grpc.Server, port int) (endpoints []*registry.Endpoint) {
+	infos := server.GetServiceInfo()
+	names := make([]string, 0, len(infos))
+	for name := range infos {
+		// 跳过 reflection, health 等内置服务
+		if strings.HasPrefix(name, "grpc.") {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		var sd protoreflect.ServiceDescriptor
+		if d, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(name)); err == nil {
+			sd, _ = d.(protoreflect.ServiceDescriptor)
+		}
+
+		for _, m := range infos[name].Methods {
+			ep := &registry.Endpoint{
+				Name:     "/" + name + "/" + m.Name,
+				Protocol: registry.ProtocolGRPC,
+				Port:     port,
+			}
+			if stream := streamType(m); stream != "" {
+				ep.Metadata = map[string]string{"stream": stream}
+			}
+			if sd != nil {
+				if md := sd.Methods().ByName(protoreflect.Name(m.Name)); md != nil {
+					ep.Request = messageValue("request", md.Input(), 0)
+					ep.Response = messageValue("response", md.Output(), 0)
+				}
+			}
+			endpoints = append(endpoints, ep)
+		}
+	}
+	return
+}
+
+func streamType(m grpc.MethodInfo) string {
+	switch {
+	case m.IsClientStream && m.IsServerStream:
+		return "bidi"
+	case m.IsClientStream:
+		return "client"
+	case m.IsServerStream:
+		return "server"
+	}
+	return ""
+}
+
+func messageValue(name string, md protoreflect.MessageDescriptor, depth int) *registry.Value {
+	v := &registry.Value{Name: name, Type: string(md.FullName())}
+	if depth >= maxValueDepth {
+		return v
+	}
+
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		v.Values = append(v.Values, fieldValue(fields.Get(i), depth+1))
+	}
+	return v
+}
+
+func fieldValue(fd protoreflect.FieldDescriptor, depth int) *registry.Value {
+	name := string(fd.Name())
+	switch {
+	case fd.IsMap():
+		return &registry.Value{Name: name, Type: fmt.Sprintf("map<%s,%s>", kindName(fd.MapKey()), kindName(fd.MapValue()))}
+	case fd.Message() != nil:
+		v := messageValue(name, fd.Message(), depth)
+		if fd.IsList() {
+			v.Type = "[]" + v.Type
+		}
+		return v
+	}
+
+	t := kindName(fd)
+	if fd.IsList() {
+		t = "[]" + t
+	}
+	return &registry.Value{Name: name, Type: t}
+}
+
+func kindName(fd protoreflect.FieldDescriptor) string {
+	switch fd.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return string(fd.Message().FullName())
+	case protoreflect.EnumKind:
+		return string(fd.Enum().FullName())
+	}
+	return fd.Kind().String()
+}
@@ -0,0 +1,44 @@
+package grpc
+
+import (
+	"context"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// PeerIdentity 对端 tls 证书中的身份, mTLS 时为 client 证书
+type PeerIdentity struct {
+	CommonName string
+	DNSNames   []string
+	// URIs 如 spiffe://cluster.local/ns/default/sa/user
+	URIs   []string
+	Emails []string
+	IPs    []string
+}
+
+// PeerIdentityFromContext 返回 handler context 中对端证书的身份, 没有使用 tls 或对端没有证书时返回 false
+func PeerIdentityFromContext(ctx context.Context) (*PeerIdentity, bool) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.PeerCertificates) == 0 {
+		return nil, false
+	}
+
+	cert := info.State.PeerCertificates[0]
+	id := &PeerIdentity{
+		CommonName: cert.Subject.CommonName,
+		DNSNames:   cert.DNSNames,
+		Emails:     cert.EmailAddresses,
+	}
+	for _, u := range cert.URIs {
+		id.URIs = append(id.URIs, u.String())
+	}
+	for _, ip := range cert.IPAddresses {
+		id.IPs = append(id.IPs, ip.String())
+	}
+	return id, true
+}
@@ -0,0 +1,69 @@
+package interceptors
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/aka-yz/go-micro-core/providers/transport/auth"
+	errs "github.com/aka-yz/go-micro-core/providers/transport/errors"
+	"github.com/aka-yz/go-micro-core/providers/transport/ratelimit"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// RetryAfterHeader 拒绝时建议的重试秒数, 在 response header 中返回
+const RetryAfterHeader = "retry-after"
+
+// AdmissionUnaryServerInterceptor rejects the calls not admitted with ResourceExhausted,
+// the caller is the authenticated principal or the peer ip
+func AdmissionUnaryServerInterceptor(a *ratelimit.Admission) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		done, err := admit(ctx, a, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		defer done(true)
+		return handler(ctx, req)
+	}
+}
+
+// AdmissionStreamServerInterceptor is the stream version of AdmissionUnaryServerInterceptor,
+// the latency of streams does not adjust the adaptive limit
+func AdmissionStreamServerInterceptor(a *ratelimit.Admission) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		done, err := admit(ss.Context(), a, info.FullMethod)
+		if err != nil {
+			return err
+		}
+		defer done(false)
+		return handler(srv, ss)
+	}
+}
+
+func admit(ctx context.Context, a *ratelimit.Admission, method string) (func(bool), error) {
+	var caller string
+	if p, ok := auth.FromContext(ctx); ok {
+		caller = p.Subject
+	} else if p, ok := peer.FromContext(ctx); ok {
+		caller = p.Addr.String()
+		if host, _, err := net.SplitHostPort(caller); err == nil {
+			caller = host
+		}
+	}
+
+	done, err := a.Admit(method, caller)
+	if err != nil {
+		e := errs.New(codes.ResourceExhausted, "RATE_LIMITED", err.Error()).WithCause(err).WithRetryable(true)
+		var re *ratelimit.RejectError
+		if errors.As(err, &re) {
+			retryAfter := ratelimit.RetryAfterSeconds(re.RetryAfter)
+			_ = grpc.SetHeader(ctx, metadata.Pairs(RetryAfterHeader, retryAfter))
+			e = e.WithMetadata("reason", re.Reason, "retry_after", retryAfter)
+		}
+		return nil, e
+	}
+	return done, nil
+}
@@ -0,0 +1,91 @@
+package interceptors
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aka-yz/go-micro-core/providers/transport/auth"
+	errs "github.com/aka-yz/go-micro-core/providers/transport/errors"
+	middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+// AuthUnaryServerInterceptor authenticates and authorizes the calls by the full
+// method name, the principal is put into the context and auth.PrincipalHeader
+func AuthUnaryServerInterceptor(a *auth.Auth) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := authenticate(ctx, a, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// AuthStreamServerInterceptor is the stream version of AuthUnaryServerInterceptor
+func AuthStreamServerInterceptor(a *auth.Auth) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authenticate(ss.Context(), a, info.FullMethod)
+		if err != nil {
+			return err
+		}
+		ws := middleware.WrapServerStream(ss)
+		ws.WrappedContext = ctx
+		return handler(srv, ws)
+	}
+}
+
+func authenticate(ctx context.Context, a *auth.Auth, method string) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	md = md.Copy()
+	// 只信任认证之后写入的调用方
+	delete(md, auth.PrincipalHeader)
+
+	p, err := a.Authenticate(ctx, &auth.Request{
+		Target: method,
+		Signed: method,
+		Header: func(key string) string {
+			if values := md.Get(key); len(values) > 0 {
+				return values[0]
+			}
+			return ""
+		},
+	})
+	if err != nil {
+		if errors.Is(err, auth.ErrPermissionDenied) {
+			return nil, errs.New(codes.PermissionDenied, "PERMISSION_DENIED", err.Error()).WithCause(err)
+		}
+		return nil, errs.New(codes.Unauthenticated, "UNAUTHENTICATED", err.Error()).WithCause(err)
+	}
+
+	if p != nil {
+		md.Set(auth.PrincipalHeader, p.Subject)
+		ctx = auth.NewContext(ctx, p)
+	}
+	return metadata.NewIncomingContext(ctx, md), nil
+}
+
+// AuthUnaryClientInterceptor adds the credentials of the signer to the calls
+func AuthUnaryClientInterceptor(s *auth.Signer) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(withCredentials(ctx, s, method), method, req, reply, cc, opts...)
+	}
+}
+
+// AuthStreamClientInterceptor is the stream version of AuthUnaryClientInterceptor
+func AuthStreamClientInterceptor(s *auth.Signer) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(withCredentials(ctx, s, method), desc, cc, method, opts...)
+	}
+}
+
+// withCredentials grpc 的签名不包含消息, 签名方法名, 时间和 nonce, server 拒绝重复的 nonce
+func withCredentials(ctx context.Context, s *auth.Signer, method string) context.Context {
+	var kv []string
+	for k, v := range s.Headers(method, nil) {
+		kv = append(kv, k, v)
+	}
+	return metadata.AppendToOutgoingContext(ctx, kv...)
+}
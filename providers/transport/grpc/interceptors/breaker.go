@@ -0,0 +1,53 @@
+package interceptors
+
+import (
+	"context"
+	"time"
+
+	"github.com/aka-yz/go-micro-core/providers/transport/breaker"
+	"github.com/aka-yz/go-micro-core/providers/transport/grpc/selector"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// BreakerUnaryClientInterceptor rejects the calls with Unavailable when the breaker
+// of the target and method is open, failures are classified by selector.IsFailure
+func BreakerUnaryClientInterceptor(g *breaker.Group) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		b := g.Get(breakerName(cc, method))
+		done, err := b.Allow()
+		if err != nil {
+			return status.Errorf(codes.Unavailable, "%s: %v", b.Name(), err)
+		}
+
+		start := time.Now()
+		err = invoker(ctx, method, req, reply, cc, opts...)
+		done(selector.IsFailure(err), time.Since(start))
+		return err
+	}
+}
+
+// BreakerStreamClientInterceptor is the stream version of BreakerUnaryClientInterceptor,
+// the result is recorded when the stream ends, streams are never slow calls
+func BreakerStreamClientInterceptor(g *breaker.Group) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		b := g.Get(breakerName(cc, method))
+		done, err := b.Allow()
+		if err != nil {
+			return nil, status.Errorf(codes.Unavailable, "%s: %v", b.Name(), err)
+		}
+
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			done(selector.IsFailure(err), 0)
+			return nil, err
+		}
+		return OnStreamDone(ctx, desc, cs, func(err error) { done(selector.IsFailure(err), 0) }), nil
+	}
+}
+
+// breakerName 熔断按 target 和方法区分, 如 registry:///user-rpc/pkg.User/Get
+func breakerName(cc *grpc.ClientConn, method string) string {
+	return cc.Target() + method
+}
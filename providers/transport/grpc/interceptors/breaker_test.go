@@ -0,0 +1,103 @@
+package interceptors
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aka-yz/go-micro-core/providers/transport/breaker"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeStream RecvMsg 返回 recv 的结果, recv 为空时阻塞到 ctx 结束
+type fakeStream struct {
+	grpc.ClientStream
+	ctx  context.Context
+	recv func() error
+}
+
+func (s *fakeStream) SendMsg(m interface{}) error { return nil }
+func (s *fakeStream) CloseSend() error            { return nil }
+
+func (s *fakeStream) RecvMsg(m interface{}) error {
+	if s.recv != nil {
+		return s.recv()
+	}
+	<-s.ctx.Done()
+	return status.FromContextError(s.ctx.Err()).Err()
+}
+
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time { return c.now }
+
+func TestBreakerStream(t *testing.T) {
+	cc, err := grpc.Dial("passthrough:///breaker", grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cc.Close()
+
+	c := &clock{now: time.Now()}
+	changes := make(chan breaker.State, 10)
+	g := breaker.NewGroup(breaker.Options{
+		MinRequests:      1,
+		OpenTimeout:      time.Second,
+		HalfOpenRequests: 1,
+		Hooks:            []breaker.Hook{func(name string, from, to breaker.State) { changes <- to }},
+		Now:              c.Now,
+	})
+	unary := BreakerUnaryClientInterceptor(g)
+	stream := BreakerStreamClientInterceptor(g)
+	streamer := func(recv func() error) grpc.Streamer {
+		return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			return &fakeStream{ctx: ctx, recv: recv}, nil
+		}
+	}
+	// halfOpen 失败一次打开熔断, 超时后进入半开
+	halfOpen := func() {
+		_ = unary(context.Background(), "/test.Svc/Put", nil, nil, cc,
+			func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+				return status.Error(codes.Unavailable, "down")
+			})
+		c.now = c.now.Add(time.Second)
+		if state := g.Get(breakerName(cc, "/test.Svc/Put")).State(); state != breaker.HalfOpen {
+			t.Fatalf("unexpected state %v", state)
+		}
+		<-changes
+		<-changes
+	}
+
+	// 客户端流收到响应即结束, 探测成功后关闭
+	halfOpen()
+	desc := &grpc.StreamDesc{ClientStreams: true}
+	cs, err := stream(context.Background(), desc, cc, "/test.Svc/Put", streamer(func() error { return nil }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = cs.SendMsg(nil); err == nil {
+		err = cs.RecvMsg(nil)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state := <-changes; state != breaker.Closed {
+		t.Fatalf("client stream: unexpected state %v", state)
+	}
+
+	// 半开时取消的流释放探测名额
+	halfOpen()
+	ctx, cancel := context.WithCancel(context.Background())
+	desc = &grpc.StreamDesc{ServerStreams: true}
+	if _, err = stream(ctx, desc, cc, "/test.Svc/Put", streamer(nil)); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if state := <-changes; state != breaker.Closed {
+		t.Fatalf("cancelled stream: unexpected state %v", state)
+	}
+}
@@ -0,0 +1,109 @@
+package interceptors
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// TimeoutHeader 请求剩余的超时时间(毫秒), 由 client 写入 metadata,
+// 经过不传递 grpc-timeout 的代理或 http 转发后, server 仍然可以得到 deadline
+const TimeoutHeader = "x-timeout-ms"
+
+// TimeoutUnaryClientInterceptor sets the default deadline of the methods when the
+// context has none. timeouts are keyed by full method or method name.
+func TimeoutUnaryClientInterceptor(timeout time.Duration, timeouts map[string]time.Duration) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if _, ok := ctx.Deadline(); !ok {
+			d, ok := timeouts[method]
+			if !ok {
+				d, ok = timeouts[getMethod(method)]
+			}
+			if !ok {
+				d = timeout
+			}
+			if d > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, d)
+				defer cancel()
+			}
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// DeadlineUnaryClientInterceptor propagates the remaining deadline to the server by TimeoutHeader
+func DeadlineUnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(withTimeoutHeader(ctx), method, req, reply, cc, opts...)
+	}
+}
+
+// DeadlineStreamClientInterceptor is the stream version of DeadlineUnaryClientInterceptor
+func DeadlineStreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(withTimeoutHeader(ctx), desc, cc, method, opts...)
+	}
+}
+
+func withTimeoutHeader(ctx context.Context) context.Context {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return ctx
+	}
+	ms := time.Until(deadline).Milliseconds()
+	if ms < 0 {
+		ms = 0
+	}
+	// 覆盖上游传入的值
+	md, _ := metadata.FromOutgoingContext(ctx)
+	md = md.Copy()
+	md.Set(TimeoutHeader, strconv.FormatInt(ms, 10))
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// DeadlineUnaryServerInterceptor applies the deadline of TimeoutHeader when it is
+// earlier than the deadline of the context
+func DeadlineUnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, cancel := headerDeadline(ctx)
+		defer cancel()
+		return handler(ctx, req)
+	}
+}
+
+// DeadlineStreamServerInterceptor is the stream version of DeadlineUnaryServerInterceptor
+func DeadlineStreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, cancel := headerDeadline(ss.Context())
+		defer cancel()
+		ws := middleware.WrapServerStream(ss)
+		ws.WrappedContext = ctx
+		return handler(srv, ws)
+	}
+}
+
+func headerDeadline(ctx context.Context) (context.Context, context.CancelFunc) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ctx, func() {}
+	}
+	values := md.Get(TimeoutHeader)
+	if len(values) == 0 {
+		return ctx, func() {}
+	}
+	ms, err := strconv.ParseInt(values[0], 10, 64)
+	if err != nil || ms < 0 {
+		return ctx, func() {}
+	}
+
+	deadline := time.Now().Add(time.Duration(ms) * time.Millisecond)
+	if d, ok := ctx.Deadline(); !ok || deadline.Before(d) {
+		return context.WithDeadline(ctx, deadline)
+	}
+	return ctx, func() {}
+}
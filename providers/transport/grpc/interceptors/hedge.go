@@ -0,0 +1,189 @@
+package interceptors
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// 对冲请求的默认值
+var (
+	DefaultHedgeAttempts   = 2
+	DefaultHedgePercentile = 95.0
+	DefaultHedgeDelay      = 100 * time.Millisecond
+	DefaultHedgeMinDelay   = 5 * time.Millisecond
+
+	// hedgeSamples 每个方法保留的延迟样本数, hedgeMinSamples 样本数不足时使用 Delay
+	hedgeSamples    = 1000
+	hedgeMinSamples = 20
+)
+
+// HedgePolicy sends another attempt when the previous ones have not returned
+// within the latency percentile of the method, the first response wins
+type HedgePolicy struct {
+	// Methods 幂等的方法, 格式见 methodMatcher
+	Methods []string
+	// MaxAttempts 包含第一次请求的最大请求次数
+	MaxAttempts int
+	// Percentile 按该延迟分位数发出下一次请求
+	Percentile float64
+	// Delay 样本数不足时的等待时间, MinDelay 等待时间的下限
+	Delay    time.Duration
+	MinDelay time.Duration
+	// Codes 返回这些 code 时立即发出下一次请求, 其他错误直接返回
+	Codes []codes.Code
+}
+
+func (p HedgePolicy) withDefaults() HedgePolicy {
+	if p.MaxAttempts <= 1 {
+		p.MaxAttempts = DefaultHedgeAttempts
+	}
+	if p.Percentile <= 0 || p.Percentile >= 100 {
+		p.Percentile = DefaultHedgePercentile
+	}
+	if p.Delay <= 0 {
+		p.Delay = DefaultHedgeDelay
+	}
+	if p.MinDelay <= 0 {
+		p.MinDelay = DefaultHedgeMinDelay
+	}
+	if len(p.Codes) == 0 {
+		p.Codes = DefaultRetryCodes
+	}
+	return p
+}
+
+func (p HedgePolicy) retryable(err error) bool {
+	code := status.Code(err)
+	for _, c := range p.Codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// latencies 一个方法最近的成功请求延迟
+type latencies struct {
+	sync.Mutex
+	samples []time.Duration
+	next    int
+	// delay 缓存的分位数, 每 dirty 个新样本重新计算
+	delay time.Duration
+	dirty int
+}
+
+func (l *latencies) add(d time.Duration) {
+	l.Lock()
+	defer l.Unlock()
+	if len(l.samples) < hedgeSamples {
+		l.samples = append(l.samples, d)
+	} else {
+		l.samples[l.next] = d
+		l.next = (l.next + 1) % hedgeSamples
+	}
+	l.dirty++
+}
+
+func (l *latencies) percentile(p HedgePolicy) time.Duration {
+	l.Lock()
+	defer l.Unlock()
+	if len(l.samples) < hedgeMinSamples {
+		return p.Delay
+	}
+	if l.delay == 0 || l.dirty >= hedgeMinSamples {
+		sorted := append([]time.Duration(nil), l.samples...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		l.delay = sorted[int(float64(len(sorted)-1)*p.Percentile/100)]
+		l.dirty = 0
+	}
+	if l.delay < p.MinDelay {
+		return p.MinDelay
+	}
+	return l.delay
+}
+
+type hedgeResult struct {
+	reply   interface{}
+	err     error
+	elapsed time.Duration
+}
+
+// HedgeUnaryClientInterceptor sends hedged requests for the methods of the policy,
+// the reply must be a proto message
+func HedgeUnaryClientInterceptor(policy HedgePolicy) grpc.UnaryClientInterceptor {
+	p := policy.withDefaults()
+	methods := newMethodMatcher(p.Methods)
+	var stats sync.Map // method -> *latencies
+
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		msg, ok := reply.(proto.Message)
+		if !methods.match(method) || !ok {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+		v, _ := stats.LoadOrStore(method, &latencies{})
+		lat := v.(*latencies)
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		results := make(chan hedgeResult, p.MaxAttempts)
+		sent, done := 0, 0
+		send := func() {
+			r := msg.ProtoReflect().New().Interface()
+			start := time.Now()
+			sent++
+			go func() {
+				err := invoker(ctx, method, req, r, cc, opts...)
+				results <- hedgeResult{reply: r, err: err, elapsed: time.Since(start)}
+			}()
+		}
+		// finish 取消还在进行的请求并等待它们返回, 返回后不再有请求使用 req 和 cc
+		finish := func(err error) error {
+			cancel()
+			for ; done < sent; done++ {
+				<-results
+			}
+			return err
+		}
+
+		send()
+		var attempts []Attempt
+		timer := time.NewTimer(lat.percentile(p))
+		defer timer.Stop()
+		for {
+			select {
+			case <-timer.C:
+				if sent < p.MaxAttempts {
+					send()
+					timer.Reset(lat.percentile(p))
+				}
+			case r := <-results:
+				done++
+				if r.err == nil {
+					lat.add(r.elapsed)
+					proto.Reset(msg)
+					proto.Merge(msg, r.reply.(proto.Message))
+					return finish(nil)
+				}
+
+				attempts = append(attempts, Attempt{Elapsed: r.elapsed, Err: r.err})
+				if !p.retryable(r.err) || ctx.Err() != nil {
+					return finish(r.err)
+				}
+				// 可以重试的错误立即发出下一次请求
+				if sent < p.MaxAttempts {
+					send()
+				} else if done == sent {
+					return &AttemptsError{Method: method, Attempts: attempts}
+				}
+			}
+		}
+	}
+}
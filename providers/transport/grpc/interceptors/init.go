@@ -3,11 +3,12 @@ package interceptors
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"github.com/aka-yz/go-micro-core/configs/log"
+	errs "github.com/aka-yz/go-micro-core/providers/transport/errors"
 	"github.com/aka-yz/go-micro-core/providers/transport/gin"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	"runtime"
 	"strings"
@@ -33,7 +34,7 @@ func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
 		defer func() {
 			if pErr := recover(); pErr != nil {
 				printStack(ctx, req, pErr)
-				err = errors.New("grpc server panic")
+				err = errs.New(codes.Internal, "PANIC", "grpc server panic")
 			}
 		}()
 
@@ -0,0 +1,27 @@
+package interceptors
+
+import "strings"
+
+// methodMatcher 匹配 grpc 方法, 支持 "*", "/pkg.Svc/*", "/pkg.Svc/Method" 和方法名 "Method"
+type methodMatcher map[string]bool
+
+func newMethodMatcher(methods []string) methodMatcher {
+	m := make(methodMatcher, len(methods))
+	for _, method := range methods {
+		m[method] = true
+	}
+	return m
+}
+
+func (m methodMatcher) match(method string) bool {
+	if len(m) == 0 {
+		return false
+	}
+	if m["*"] || m[method] || m[getMethod(method)] {
+		return true
+	}
+	if i := strings.LastIndex(method, "/"); i > 0 {
+		return m[method[:i+1]+"*"]
+	}
+	return false
+}
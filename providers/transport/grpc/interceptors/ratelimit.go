@@ -0,0 +1,48 @@
+package interceptors
+
+import (
+	"context"
+
+	"github.com/aka-yz/go-micro-core/providers/transport/ratelimit"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// RateLimitUnaryClientInterceptor limits the calls by the token bucket, with wait it
+// waits for a token within the deadline, otherwise it rejects with ResourceExhausted
+func RateLimitUnaryClientInterceptor(l *ratelimit.Limiter, wait bool) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if err := limit(ctx, l, wait); err != nil {
+			return err
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// RateLimitStreamClientInterceptor is the stream version of RateLimitUnaryClientInterceptor
+func RateLimitStreamClientInterceptor(l *ratelimit.Limiter, wait bool) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if err := limit(ctx, l, wait); err != nil {
+			return nil, err
+		}
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
+
+func limit(ctx context.Context, l *ratelimit.Limiter, wait bool) error {
+	if !wait {
+		if ok, retryAfter := l.Take(); !ok {
+			return status.Errorf(codes.ResourceExhausted, "%s: %v, retry after %v", l.Name(), ratelimit.ErrLimited, retryAfter)
+		}
+		return nil
+	}
+
+	if err := l.Wait(ctx); err != nil {
+		if err == ratelimit.ErrLimited {
+			return status.Errorf(codes.ResourceExhausted, "%s: %v", l.Name(), err)
+		}
+		return status.FromContextError(err).Err()
+	}
+	return nil
+}
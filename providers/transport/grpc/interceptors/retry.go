@@ -0,0 +1,214 @@
+package interceptors
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// 重试的默认值
+var (
+	DefaultRetryAttempts       = 3
+	DefaultRetryInitialBackoff = 50 * time.Millisecond
+	DefaultRetryMaxBackoff     = time.Second
+	DefaultRetryJitter         = 0.2
+	DefaultRetryCodes          = []codes.Code{codes.Unavailable}
+)
+
+// RetryPolicy retries the idempotent methods with exponential backoff
+type RetryPolicy struct {
+	// Methods 幂等的方法, 只有这些方法会重试, 格式见 methodMatcher
+	Methods []string
+	// MaxAttempts 包含第一次请求的最大请求次数
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Jitter backoff 随机浮动的比例, 0-1
+	Jitter float64
+	// Codes 可以重试的 grpc code
+	Codes []codes.Code
+	// Budget 不为空时限制重试占请求的比例, 避免故障时重试放大流量
+	Budget *RetryBudget
+}
+
+// Attempt is one attempt of a retried or hedged call
+type Attempt struct {
+	Elapsed time.Duration
+	Err     error
+}
+
+// AttemptsError is returned when all the attempts failed, it keeps the grpc
+// status of the last attempt so status.Code still works
+type AttemptsError struct {
+	Method   string
+	Attempts []Attempt
+}
+
+func (e *AttemptsError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "method:%s failed after %d attempts", e.Method, len(e.Attempts))
+	for i, a := range e.Attempts {
+		fmt.Fprintf(&b, "; attempt %d elapsed:%v err:%v", i+1, a.Elapsed, a.Err)
+	}
+	return b.String()
+}
+
+func (e *AttemptsError) GRPCStatus() *status.Status {
+	last := status.Convert(e.Attempts[len(e.Attempts)-1].Err)
+	return status.New(last.Code(), e.Error())
+}
+
+// Unwrap returns the error of the last attempt
+func (e *AttemptsError) Unwrap() error {
+	return e.Attempts[len(e.Attempts)-1].Err
+}
+
+// RetryBudget allows retries up to Ratio of the requests plus MinPerSecond
+type RetryBudget struct {
+	Ratio        float64
+	MinPerSecond float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func NewRetryBudget(ratio, minPerSecond float64) *RetryBudget {
+	return &RetryBudget{Ratio: ratio, MinPerSecond: minPerSecond}
+}
+
+// max 最多积累的重试次数
+func (b *RetryBudget) max() float64 {
+	max := b.MinPerSecond * 10
+	if max < 10 {
+		max = 10
+	}
+	return max
+}
+
+func (b *RetryBudget) refill(now time.Time) {
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.MinPerSecond
+	}
+	b.last = now
+	if max := b.max(); b.tokens > max {
+		b.tokens = max
+	}
+}
+
+// deposit 每个请求增加 Ratio 次重试额度
+func (b *RetryBudget) deposit() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill(time.Now())
+	b.tokens += b.Ratio
+	if max := b.max(); b.tokens > max {
+		b.tokens = max
+	}
+}
+
+// withdraw 额度足够时扣除一次重试
+func (b *RetryBudget) withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill(time.Now())
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = DefaultRetryAttempts
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = DefaultRetryInitialBackoff
+	}
+	if p.MaxBackoff < p.InitialBackoff {
+		p.MaxBackoff = DefaultRetryMaxBackoff
+		if p.MaxBackoff < p.InitialBackoff {
+			p.MaxBackoff = p.InitialBackoff
+		}
+	}
+	if p.Jitter <= 0 || p.Jitter > 1 {
+		p.Jitter = DefaultRetryJitter
+	}
+	if len(p.Codes) == 0 {
+		p.Codes = DefaultRetryCodes
+	}
+	return p
+}
+
+func (p RetryPolicy) retryable(err error) bool {
+	code := status.Code(err)
+	for _, c := range p.Codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff 第 n 次重试前的等待时间, n 从 1 开始
+func (p RetryPolicy) backoff(n int) time.Duration {
+	d := p.InitialBackoff
+	for i := 1; i < n && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	return time.Duration(float64(d) * (1 + p.Jitter*(rand.Float64()*2-1)))
+}
+
+// RetryUnaryClientInterceptor retries the methods of the policy
+func RetryUnaryClientInterceptor(policy RetryPolicy) grpc.UnaryClientInterceptor {
+	p := policy.withDefaults()
+	methods := newMethodMatcher(p.Methods)
+
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if !methods.match(method) {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+		if p.Budget != nil {
+			p.Budget.deposit()
+		}
+
+		var attempts []Attempt
+		for n := 1; ; n++ {
+			start := time.Now()
+			err := invoker(ctx, method, req, reply, cc, opts...)
+			if err == nil {
+				return nil
+			}
+			attempts = append(attempts, Attempt{Elapsed: time.Since(start), Err: err})
+
+			if !p.retryable(err) || ctx.Err() != nil {
+				return err
+			}
+			if n >= p.MaxAttempts || (p.Budget != nil && !p.Budget.withdraw()) {
+				return &AttemptsError{Method: method, Attempts: attempts}
+			}
+
+			// 剩余时间不够等待时不再重试
+			wait := p.backoff(n)
+			if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= wait {
+				return &AttemptsError{Method: method, Attempts: attempts}
+			}
+			select {
+			case <-ctx.Done():
+				return &AttemptsError{Method: method, Attempts: attempts}
+			case <-time.After(wait):
+			}
+		}
+	}
+}
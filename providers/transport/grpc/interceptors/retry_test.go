@@ -0,0 +1,156 @@
+package interceptors
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func failingInvoker(calls *int32, fails int32, code codes.Code) grpc.UnaryInvoker {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		if atomic.AddInt32(calls, 1) <= fails {
+			return status.Error(code, "failed")
+		}
+		return nil
+	}
+}
+
+func TestRetry(t *testing.T) {
+	retry := RetryUnaryClientInterceptor(RetryPolicy{
+		Methods:        []string{"/test.Svc/Get"},
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+	})
+	ctx := context.Background()
+
+	var calls int32
+	if err := retry(ctx, "/test.Svc/Get", nil, nil, nil, failingInvoker(&calls, 2, codes.Unavailable)); err != nil || calls != 3 {
+		t.Fatalf("unexpected err:%v calls:%d", err, calls)
+	}
+
+	// 非幂等方法不重试
+	calls = 0
+	if err := retry(ctx, "/test.Svc/Create", nil, nil, nil, failingInvoker(&calls, 2, codes.Unavailable)); err == nil || calls != 1 {
+		t.Fatalf("unexpected err:%v calls:%d", err, calls)
+	}
+
+	// 不可重试的 code 不重试
+	calls = 0
+	if err := retry(ctx, "/test.Svc/Get", nil, nil, nil, failingInvoker(&calls, 2, codes.InvalidArgument)); status.Code(err) != codes.InvalidArgument || calls != 1 {
+		t.Fatalf("unexpected err:%v calls:%d", err, calls)
+	}
+
+	// 重试用完后返回每次请求的记录
+	calls = 0
+	err := retry(ctx, "/test.Svc/Get", nil, nil, nil, failingInvoker(&calls, 5, codes.Unavailable))
+	var ae *AttemptsError
+	if !errors.As(err, &ae) || len(ae.Attempts) != 3 || status.Code(err) != codes.Unavailable {
+		t.Fatalf("unexpected err:%v", err)
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	retry := RetryUnaryClientInterceptor(RetryPolicy{
+		Methods:        []string{"*"},
+		InitialBackoff: time.Millisecond,
+		Budget:         &RetryBudget{Ratio: 0.1},
+	})
+
+	// 每个请求增加 0.1 次额度, 30 个请求最多重试 3 次
+	var calls int32
+	for i := 0; i < 30; i++ {
+		_ = retry(context.Background(), "/test.Svc/Get", nil, nil, nil, failingInvoker(&calls, 1000, codes.Unavailable))
+	}
+	if calls < 30 || calls > 33 {
+		t.Fatalf("retry budget exceeded, calls:%d", calls)
+	}
+}
+
+func TestHedge(t *testing.T) {
+	hedge := HedgeUnaryClientInterceptor(HedgePolicy{
+		Methods: []string{"Get"},
+		Delay:   10 * time.Millisecond,
+	})
+
+	var calls int32
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		n := atomic.AddInt32(&calls, 1)
+		if n == 1 {
+			// 第一次请求很慢, 对冲的请求先返回
+			select {
+			case <-ctx.Done():
+				return status.FromContextError(ctx.Err()).Err()
+			case <-time.After(time.Second):
+			}
+		}
+		reply.(*wrapperspb.StringValue).Value = "attempt-" + strconv.Itoa(int(n))
+		return nil
+	}
+
+	reply := &wrapperspb.StringValue{}
+	start := time.Now()
+	if err := hedge(context.Background(), "/test.Svc/Get", nil, reply, nil, invoker); err != nil {
+		t.Fatal(err)
+	}
+	if reply.Value != "attempt-2" || time.Since(start) > 500*time.Millisecond {
+		t.Fatalf("unexpected reply %v elapsed %v", reply.Value, time.Since(start))
+	}
+}
+
+func TestHedgeNonRetryable(t *testing.T) {
+	hedge := HedgeUnaryClientInterceptor(HedgePolicy{
+		Methods: []string{"Get"},
+		Delay:   time.Millisecond,
+	})
+
+	// 对冲的请求返回不可重试的错误时, 第一次请求被取消, 返回前已经结束
+	var calls, inflight int32
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		atomic.AddInt32(&inflight, 1)
+		defer atomic.AddInt32(&inflight, -1)
+		if atomic.AddInt32(&calls, 1) == 2 {
+			return status.Error(codes.InvalidArgument, "bad")
+		}
+		<-ctx.Done()
+		return status.FromContextError(ctx.Err()).Err()
+	}
+
+	err := hedge(context.Background(), "/test.Svc/Get", nil, &wrapperspb.StringValue{}, nil, invoker)
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("unexpected err:%v", err)
+	}
+	if n := atomic.LoadInt32(&inflight); n != 0 {
+		t.Fatalf("%d attempts still in flight", n)
+	}
+}
+
+func TestDeadline(t *testing.T) {
+	timeout := TimeoutUnaryClientInterceptor(time.Second, map[string]time.Duration{"Get": 100 * time.Millisecond})
+	propagate := DeadlineUnaryClientInterceptor()
+
+	var header string
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		header = md.Get(TimeoutHeader)[0]
+		return nil
+	}
+	err := timeout(context.Background(), "/test.Svc/Get", nil, nil, nil,
+		func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			return propagate(ctx, method, req, reply, cc, invoker)
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ms, _ := strconv.Atoi(header); ms <= 0 || ms > 100 {
+		t.Fatalf("unexpected timeout header %q", header)
+	}
+}
@@ -0,0 +1,172 @@
+package interceptors
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/aka-yz/go-micro-core/configs/log"
+	errs "github.com/aka-yz/go-micro-core/providers/transport/errors"
+	"github.com/aka-yz/go-micro-core/providers/transport/gin"
+	middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+// streamStats 流的消息数和字节数, 字节数只统计 proto 消息
+type streamStats struct {
+	sent, recv           int
+	sentBytes, recvBytes int
+}
+
+func (s *streamStats) onSend(m interface{}) {
+	s.sent++
+	s.sentBytes += messageSize(m)
+}
+
+func (s *streamStats) onRecv(m interface{}) {
+	s.recv++
+	s.recvBytes += messageSize(m)
+}
+
+func messageSize(m interface{}) int {
+	if pm, ok := m.(proto.Message); ok {
+		return proto.Size(pm)
+	}
+	return 0
+}
+
+// StreamClientInterceptor logs the stream when it ends, with the message counts and bytes
+func StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		now := time.Now()
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			log.Errorf(ctx, "stream method:%s err:%v elapsed:%v", getMethod(method), err, time.Since(now))
+			return nil, err
+		}
+		ls := &loggingClientStream{ClientStream: cs}
+		return OnStreamDone(ctx, desc, ls, func(err error) {
+			ls.Lock()
+			stats := ls.stats
+			ls.Unlock()
+			streamLog(ctx, method, stats, err, time.Since(now))
+		}), nil
+	}
+}
+
+// loggingClientStream 统计消息数, 流结束时由 OnStreamDone 输出一次日志
+type loggingClientStream struct {
+	grpc.ClientStream
+
+	// SendMsg 和 RecvMsg 可以在不同的 goroutine 中调用
+	sync.Mutex
+	stats streamStats
+}
+
+func (s *loggingClientStream) SendMsg(m interface{}) error {
+	err := s.ClientStream.SendMsg(m)
+	if err == nil {
+		s.Lock()
+		s.stats.onSend(m)
+		s.Unlock()
+	}
+	return err
+}
+
+func (s *loggingClientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err == nil {
+		s.Lock()
+		s.stats.onRecv(m)
+		s.Unlock()
+	}
+	return err
+}
+
+// StreamServerInterceptor recovers the panics and logs the stream with the message counts and bytes
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		ctx := ss.Context()
+		defer func() {
+			if pErr := recover(); pErr != nil {
+				printStack(ctx, info.FullMethod, pErr)
+				err = errs.New(codes.Internal, "PANIC", "grpc server panic")
+			}
+		}()
+
+		now := time.Now()
+		ls := &loggingServerStream{ServerStream: ss}
+		err = handler(srv, ls)
+
+		ls.Lock()
+		stats := ls.stats
+		ls.Unlock()
+		streamLog(ctx, info.FullMethod, stats, err, time.Since(now))
+		return err
+	}
+}
+
+type loggingServerStream struct {
+	grpc.ServerStream
+
+	sync.Mutex
+	stats streamStats
+}
+
+func (s *loggingServerStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.Lock()
+		s.stats.onSend(m)
+		s.Unlock()
+	}
+	return err
+}
+
+func (s *loggingServerStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.Lock()
+		s.stats.onRecv(m)
+		s.Unlock()
+	}
+	return err
+}
+
+// streamLog 输出流的日志, 测试时替换
+var streamLog = logStream
+
+func logStream(ctx context.Context, method string, stats streamStats, err error, elapsed time.Duration) {
+	if err == nil {
+		log.Infof(ctx, "stream method:%s sent:%d(%dB) recv:%d(%dB) err:%v elapsed:%v", getMethod(method),
+			stats.sent, stats.sentBytes, stats.recv, stats.recvBytes, err, elapsed)
+	} else {
+		log.Errorf(ctx, "stream method:%s sent:%d(%dB) recv:%d(%dB) err:%v elapsed:%v", getMethod(method),
+			stats.sent, stats.sentBytes, stats.recv, stats.recvBytes, err, elapsed)
+	}
+}
+
+func GinStreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		md := gin.MetadataFromContext(ctx)
+		if md != nil {
+			ctx = metadata.NewOutgoingContext(ctx, metadata.MD(md))
+		}
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
+
+func GinStreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		md, ok := metadata.FromIncomingContext(ss.Context())
+		if !ok {
+			return handler(srv, ss)
+		}
+		ws := middleware.WrapServerStream(ss)
+		ws.WrappedContext = gin.NewContextFromMetadata(ss.Context(), gin.Metadata(md))
+		return handler(srv, ws)
+	}
+}
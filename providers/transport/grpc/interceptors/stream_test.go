@@ -0,0 +1,98 @@
+package interceptors
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type streamLogEntry struct {
+	stats streamStats
+	err   error
+}
+
+func TestStreamClientInterceptor(t *testing.T) {
+	logs := make(chan streamLogEntry, 10)
+	streamLog = func(ctx context.Context, method string, stats streamStats, err error, elapsed time.Duration) {
+		logs <- streamLogEntry{stats: stats, err: err}
+	}
+	defer func() { streamLog = logStream }()
+
+	intercept := StreamClientInterceptor()
+	// open recv 依次返回 replies 个响应, 之后返回 io.EOF; replies 小于 0 时阻塞到 ctx 结束
+	open := func(ctx context.Context, desc *grpc.StreamDesc, replies int) grpc.ClientStream {
+		var recv func() error
+		if replies >= 0 {
+			recv = func() error {
+				if replies == 0 {
+					return io.EOF
+				}
+				replies--
+				return nil
+			}
+		}
+		cs, err := intercept(ctx, desc, nil, "/test.Svc/Stream",
+			func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+				return &fakeStream{ctx: ctx, recv: recv}, nil
+			})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cs
+	}
+	msg := wrapperspb.String("hello")
+	expect := func(name string, sent, recv int, code codes.Code) {
+		e := <-logs
+		if e.stats.sent != sent || e.stats.recv != recv || status.Code(e.err) != code {
+			t.Fatalf("%s: unexpected log %+v %v", name, e.stats, e.err)
+		}
+		select {
+		case e = <-logs:
+			t.Fatalf("%s: logged twice %+v", name, e)
+		default:
+		}
+	}
+
+	// 客户端流收到唯一的响应即结束
+	cs := open(context.Background(), &grpc.StreamDesc{ClientStreams: true}, 1)
+	cs.SendMsg(msg)
+	cs.SendMsg(msg)
+	cs.CloseSend()
+	if err := cs.RecvMsg(msg); err != nil {
+		t.Fatal(err)
+	}
+	expect("client stream", 2, 1, codes.OK)
+
+	// 服务端流在 io.EOF 时结束
+	cs = open(context.Background(), &grpc.StreamDesc{ServerStreams: true}, 2)
+	cs.SendMsg(msg)
+	for cs.RecvMsg(msg) == nil {
+	}
+	cs.RecvMsg(msg)
+	expect("server stream", 1, 2, codes.OK)
+
+	// 双向流
+	cs = open(context.Background(), &grpc.StreamDesc{ClientStreams: true, ServerStreams: true}, 3)
+	for i := 0; i < 3; i++ {
+		cs.SendMsg(msg)
+		cs.RecvMsg(msg)
+	}
+	cs.CloseSend()
+	if err := cs.RecvMsg(msg); err != io.EOF {
+		t.Fatalf("unexpected err %v", err)
+	}
+	expect("bidi stream", 3, 3, codes.OK)
+
+	// 取消的流没有调用 RecvMsg 也会结束
+	ctx, cancel := context.WithCancel(context.Background())
+	cs = open(ctx, &grpc.StreamDesc{ServerStreams: true}, -1)
+	cs.SendMsg(msg)
+	cancel()
+	expect("cancelled stream", 1, 0, codes.Canceled)
+}
@@ -0,0 +1,54 @@
+package interceptors
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// OnStreamDone wraps the client stream, done is called once when the stream ends:
+// RecvMsg returns an error (io.EOF is reported as nil), the response of a stream without
+// ServerStreams is received, or ctx is done before that
+func OnStreamDone(ctx context.Context, desc *grpc.StreamDesc, cs grpc.ClientStream, done func(err error)) grpc.ClientStream {
+	s := &doneStream{ClientStream: cs, desc: desc, done: done, finished: make(chan struct{})}
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.finish(status.FromContextError(ctx.Err()).Err())
+		case <-s.finished:
+		}
+	}()
+	return s
+}
+
+type doneStream struct {
+	grpc.ClientStream
+	desc     *grpc.StreamDesc
+	done     func(err error)
+	once     sync.Once
+	finished chan struct{}
+}
+
+func (s *doneStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	switch {
+	case err == io.EOF:
+		s.finish(nil)
+	case err != nil:
+		s.finish(err)
+	case !s.desc.ServerStreams:
+		// 客户端流和 unary 一样只有一个响应
+		s.finish(nil)
+	}
+	return err
+}
+
+func (s *doneStream) finish(err error) {
+	s.once.Do(func() {
+		close(s.finished)
+		s.done(err)
+	})
+}
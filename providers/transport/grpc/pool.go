@@ -0,0 +1,143 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/aka-yz/go-micro-core/providers/transport/grpc/interceptors"
+	"google.golang.org/grpc"
+)
+
+// 连接池选择连接的策略, 通过 WithPoolPolicy 设置
+const (
+	PoolRoundRobin   = "round_robin"
+	PoolLeastStreams = "least_streams"
+)
+
+var (
+	// ErrConnOptionConflict GetConn 传入的 ConnOption 与已创建的连接池不一致
+	ErrConnOptionConflict = errors.New("conn options conflict with the existing pool")
+	// ErrClientStopped RPCClient 已经 Stop
+	ErrClientStopped = errors.New("rpc client stopped")
+)
+
+func newConnOptions(opts ...ConnOption) ConnOptions {
+	var opt ConnOptions
+	for _, o := range opts {
+		o(&opt)
+	}
+	if opt.connNum < 1 {
+		opt.connNum = 1
+	}
+	return opt
+}
+
+// equal 比较连接相关的选项. 拦截器无法比较, 由 WithConnKey 的 key 标识,
+// 没有 key 时只有双方都没有拦截器才相等
+func (o *ConnOptions) equal(other *ConnOptions) bool {
+	if o.block != other.block || o.connNum != other.connNum || o.balanceName != other.balanceName ||
+		o.hashHeader != other.hashHeader || o.maxSize != other.maxSize || o.timeout != other.timeout ||
+		o.policy != other.policy || o.idleTimeout != other.idleTimeout || o.creds != other.creds || o.key != other.key {
+		return false
+	}
+	return o.key != "" || (!o.hasInterceptors() && !other.hasInterceptors())
+}
+
+func (o *ConnOptions) hasInterceptors() bool {
+	return len(o.interceptors) > 0 || len(o.streamInterceptors) > 0
+}
+
+// pooledConn 连接池中的连接, 记录进行中的调用数和最近使用时间
+type pooledConn struct {
+	*grpc.ClientConn
+	active   int64
+	lastUsed int64
+}
+
+func (pc *pooledConn) touch() {
+	atomic.StoreInt64(&pc.lastUsed, time.Now().UnixNano())
+}
+
+func (pc *pooledConn) unaryInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	atomic.AddInt64(&pc.active, 1)
+	defer func() {
+		atomic.AddInt64(&pc.active, -1)
+		pc.touch()
+	}()
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
+
+// streamInterceptor stream 结束或 ctx 结束时减少 active
+func (pc *pooledConn) streamInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	atomic.AddInt64(&pc.active, 1)
+	cs, err := streamer(ctx, desc, cc, method, opts...)
+	if err != nil {
+		pc.done()
+		return nil, err
+	}
+	return interceptors.OnStreamDone(ctx, desc, cs, func(error) { pc.done() }), nil
+}
+
+func (pc *pooledConn) done() {
+	atomic.AddInt64(&pc.active, -1)
+	pc.touch()
+}
+
+// pick 选择连接的下标, 调用方持有锁
+func (c *serviceConn) pick() int {
+	if c.opts.policy != PoolLeastStreams {
+		i := c.next % len(c.conns)
+		c.next++
+		return i
+	}
+
+	// 已有连接都在使用时优先创建新连接
+	best, empty := -1, -1
+	for i, pc := range c.conns {
+		if pc == nil {
+			if empty < 0 {
+				empty = i
+			}
+			continue
+		}
+		if best < 0 || atomic.LoadInt64(&pc.active) < atomic.LoadInt64(&c.conns[best].active) {
+			best = i
+		}
+	}
+	if best < 0 || (empty >= 0 && atomic.LoadInt64(&c.conns[best].active) > 0) {
+		return empty
+	}
+	return best
+}
+
+// reap 定期关闭空闲的连接
+func (c *serviceConn) reap() {
+	ticker := time.NewTicker(c.opts.idleTimeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stop:
+			return
+		case now := <-ticker.C:
+			c.reapIdle(now)
+		}
+	}
+}
+
+// reapIdle 关闭空闲超过 idleTimeout 且没有进行中调用的连接, 保留第一个连接
+func (c *serviceConn) reapIdle(now time.Time) {
+	c.Lock()
+	defer c.Unlock()
+	for i := 1; i < len(c.conns); i++ {
+		pc := c.conns[i]
+		if pc == nil || atomic.LoadInt64(&pc.active) > 0 {
+			continue
+		}
+		if now.Sub(time.Unix(0, atomic.LoadInt64(&pc.lastUsed))) > c.opts.idleTimeout {
+			_ = pc.Close()
+			c.conns[i] = nil
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package grpc
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aka-yz/go-micro-core/providers/transport/grpc/selector"
+	"github.com/aka-yz/go-micro-core/register/static"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+)
+
+func TestPool(t *testing.T) {
+	r, _ := static.NewRegistry(static.Services(map[string][]string{}))
+	c := NewClient(
+		WithSuffix(serviceSuffix),
+		WithSelector(selector.NewSelector(selector.Registry(r))),
+		WithConnOption(WithConnNum(3), WithIdleTimeout(20*time.Millisecond)),
+	)
+
+	// 轮询时按需创建连接, 第四次回到第一个连接
+	var conns []*grpc.ClientConn
+	for i := 0; i < 4; i++ {
+		conn, err := c.GetConn("test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		conns = append(conns, conn)
+	}
+	if conns[0] != conns[3] || conns[0] == conns[1] || conns[1] == conns[2] {
+		t.Fatalf("unexpected conns %v", conns)
+	}
+
+	if _, err := c.GetConn("test", WithConnNum(2)); !errors.Is(err, ErrConnOptionConflict) {
+		t.Fatalf("unexpected err %v", err)
+	}
+	// 拦截器没有 key 时无法比较, 视为冲突
+	if _, err := c.GetConn("test", WithConnNum(3), WithConnInterceptor(nil)); !errors.Is(err, ErrConnOptionConflict) {
+		t.Fatalf("unexpected err %v", err)
+	}
+	if _, err := c.GetConn("test", WithConnNum(3)); err != nil {
+		t.Fatal(err)
+	}
+
+	// 没有进行中调用的空闲连接被关闭, 第一个连接保留
+	c.connMap["test"+serviceSuffix].reapIdle(time.Now().Add(time.Hour))
+	for i, conn := range conns {
+		if closed := conn.GetState() == connectivity.Shutdown; closed != (i == 1 || i == 2) {
+			t.Fatalf("conn %d unexpected state %v", i, conn.GetState())
+		}
+	}
+
+	c.Stop()
+	if conns[0].GetState() != connectivity.Shutdown {
+		t.Fatal("conn not closed")
+	}
+	if _, err := c.GetConn("test"); err != ErrClientStopped {
+		t.Fatalf("unexpected err %v", err)
+	}
+}
+
+func TestPoolConcurrentCreate(t *testing.T) {
+	r, _ := static.NewRegistry(static.Services(map[string][]string{}))
+	c := NewClient(WithSuffix(serviceSuffix), WithSelector(selector.NewSelector(selector.Registry(r))))
+	defer c.Stop()
+
+	// 同一个服务并发获取只创建一个连接池
+	conns := make(chan *grpc.ClientConn, 10)
+	var wg sync.WaitGroup
+	for i := 0; i < cap(conns); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn, err := c.GetConn("test")
+			if err != nil {
+				t.Error(err)
+			}
+			conns <- conn
+		}()
+	}
+	wg.Wait()
+	close(conns)
+	first := <-conns
+	for conn := range conns {
+		if conn != first {
+			t.Fatal("conn created more than once")
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package grpc
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aka-yz/go-micro-core/providers/transport/grpc/selector"
+	registry "github.com/aka-yz/go-micro-core/register"
+	"google.golang.org/grpc/attributes"
+	"google.golang.org/grpc/resolver"
+)
+
+// Scheme registry resolver 的 scheme, target 格式为 registry:///service-rpc
+const Scheme = "registry"
+
+// watch 失败后重试的等待时间
+var resolveRetryInterval = time.Second
+
+type nodeKey struct{}
+type versionKey struct{}
+type selectorKey struct{}
+
+// AddressNode 返回 resolver 写入 address attributes 的节点
+func AddressNode(addr resolver.Address) *registry.Node {
+	if addr.Attributes == nil {
+		return nil
+	}
+	node, _ := addr.Attributes.Value(nodeKey{}).(*registry.Node)
+	return node
+}
+
+// AddressVersion 返回 resolver 写入 address attributes 的服务版本
+func AddressVersion(addr resolver.Address) string {
+	if addr.Attributes == nil {
+		return ""
+	}
+	version, _ := addr.Attributes.Value(versionKey{}).(string)
+	return version
+}
+
+type resolverBuilder struct {
+	registry registry.Registry
+	selector selector.Selector
+}
+
+// NewResolverBuilder 基于 registry 的 resolver, 通过 grpc.WithResolvers 按连接使用,
+// 不同 RPCClient 的 registry 互不影响. selector 不为空时通过 resolver state 传给 selector balancer
+func NewResolverBuilder(r registry.Registry, s selector.Selector) resolver.Builder {
+	return &resolverBuilder{registry: r, selector: s}
+}
+
+func (b *resolverBuilder) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &registryResolver{
+		service:  target.Endpoint,
+		registry: b.registry,
+		selector: b.selector,
+		cc:       cc,
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+	go r.run()
+	return r, nil
+}
+
+func (b *resolverBuilder) Scheme() string {
+	return Scheme
+}
+
+type registryResolver struct {
+	service  string
+	registry registry.Registry
+	selector selector.Selector
+	cc       resolver.ClientConn
+	ctx      context.Context
+	cancel   context.CancelFunc
+
+	sync.Mutex
+	services []*registry.Service
+	// watcher 当前的 watcher, Close 时停止, 不依赖 registry 对 WatchContext 的支持
+	watcher registry.Watcher
+}
+
+func (r *registryResolver) run() {
+	for {
+		err := r.watch()
+		if r.ctx.Err() != nil {
+			return
+		}
+		r.cc.ReportError(err)
+
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-time.After(resolveRetryInterval):
+		}
+	}
+}
+
+// watch 先 watch 再读取全量, 两者之间的事件重复应用也不影响结果
+func (r *registryResolver) watch() error {
+	w, err := r.registry.Watch(r.service, registry.WatchContext(r.ctx))
+	if err != nil {
+		return err
+	}
+	defer w.Stop()
+
+	r.Lock()
+	r.watcher = w
+	r.Unlock()
+	if r.ctx.Err() != nil {
+		return r.ctx.Err()
+	}
+
+	services, err := r.registry.GetService(r.service)
+	if err != nil && err != registry.ErrNotFound {
+		return err
+	}
+	r.Lock()
+	r.services = services
+	r.Unlock()
+	r.update()
+
+	for {
+		res, err := w.Next()
+		if err != nil {
+			return err
+		}
+		if res.Service == nil || res.Service.Name != r.service {
+			continue
+		}
+
+		r.Lock()
+		switch res.Action {
+		case registry.Create, registry.Update:
+			r.services = registry.Merge(r.services, []*registry.Service{res.Service})
+		case registry.Delete:
+			r.services = registry.Remove(r.services, []*registry.Service{res.Service})
+		}
+		r.Unlock()
+		r.update()
+	}
+}
+
+func (r *registryResolver) update() {
+	r.Lock()
+	addrs := make([]resolver.Address, 0)
+	for _, s := range r.services {
+		for _, node := range s.Nodes {
+			addrs = append(addrs, resolver.Address{
+				Addr:       net.JoinHostPort(node.Address, strconv.Itoa(node.Port)),
+				Attributes: attributes.New(nodeKey{}, node, versionKey{}, s.Version),
+			})
+		}
+	}
+	r.Unlock()
+
+	state := resolver.State{Addresses: addrs}
+	if r.selector != nil {
+		state.Attributes = attributes.New(selectorKey{}, r.selector)
+	}
+	r.cc.UpdateState(state)
+}
+
+// ResolveNow 状态由 watch 推送, 无需主动解析
+func (r *registryResolver) ResolveNow(resolver.ResolveNowOptions) {}
+
+func (r *registryResolver) Close() {
+	r.cancel()
+
+	r.Lock()
+	if r.watcher != nil {
+		r.watcher.Stop()
+	}
+	r.Unlock()
+}
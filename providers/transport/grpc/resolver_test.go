@@ -0,0 +1,102 @@
+package grpc
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aka-yz/go-micro-core/providers/transport/grpc/selector"
+	registry "github.com/aka-yz/go-micro-core/register"
+	"github.com/aka-yz/go-micro-core/register/static"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// markSelector 记录 Mark 的调用
+type markSelector struct {
+	selector.Selector
+	sync.Mutex
+	marks int
+}
+
+func (s *markSelector) Mark(service string, node *registry.Node, err error) {
+	s.Lock()
+	s.marks++
+	s.Unlock()
+}
+
+func startHealthServer(t *testing.T, st healthpb.HealthCheckResponse_ServingStatus) (*grpc.Server, *registry.Node) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs := health.NewServer()
+	hs.SetServingStatus("", st)
+	server := grpc.NewServer()
+	healthpb.RegisterHealthServer(server, hs)
+	go server.Serve(lis)
+
+	host, port, _ := net.SplitHostPort(lis.Addr().String())
+	p, _ := strconv.Atoi(port)
+	return server, &registry.Node{Id: lis.Addr().String(), Address: host, Port: p}
+}
+
+func TestRegistryResolver(t *testing.T) {
+	s1, n1 := startHealthServer(t, healthpb.HealthCheckResponse_SERVING)
+	defer s1.Stop()
+	s2, n2 := startHealthServer(t, healthpb.HealthCheckResponse_NOT_SERVING)
+	defer s2.Stop()
+
+	r, _ := static.NewRegistry(static.Services(map[string][]string{}))
+	sel := &markSelector{Selector: selector.NewSelector(selector.Registry(r))}
+	conn, err := NewServiceConn("test-rpc").CreateConn(sel, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// 注册之后 resolver 通过 watch 得到节点
+	if err = r.Register(&registry.Service{Name: "test-rpc", Version: "v1", Nodes: []*registry.Node{n1}}); err != nil {
+		t.Fatal(err)
+	}
+	if err = r.Register(&registry.Service{Name: "test-rpc", Version: "v2", Nodes: []*registry.Node{n2}}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client := healthpb.NewHealthClient(conn)
+
+	for version, want := range map[string]healthpb.HealthCheckResponse_ServingStatus{
+		"v1": healthpb.HealthCheckResponse_SERVING,
+		"v2": healthpb.HealthCheckResponse_NOT_SERVING,
+	} {
+		// 等待两个节点都就绪, 之后每次调用都应该按版本路由
+		var ok int
+		for i := 0; i < 20; i++ {
+			resp, err := client.Check(ctx, &healthpb.HealthCheckRequest{},
+				grpc.WaitForReady(true), WithSelectOption(selector.WithFilter(selector.FilterVersion(version))))
+			if err != nil {
+				time.Sleep(50 * time.Millisecond)
+				continue
+			}
+			if resp.Status != want {
+				t.Fatalf("version %s: unexpected status %v", version, resp.Status)
+			}
+			ok++
+		}
+		if ok == 0 {
+			t.Fatalf("version %s: no successful call", version)
+		}
+	}
+
+	sel.Lock()
+	defer sel.Unlock()
+	if sel.marks == 0 {
+		t.Fatal("selector not marked")
+	}
+}
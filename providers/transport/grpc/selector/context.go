@@ -0,0 +1,17 @@
+package selector
+
+import "context"
+
+type selectOptionsKey struct{}
+
+// NewContext 把单次调用的 SelectOption 放入 context, 由 grpc balancer 在选择节点时使用
+func NewContext(ctx context.Context, opts ...SelectOption) context.Context {
+	return context.WithValue(ctx, selectOptionsKey{}, append(FromContext(ctx), opts...))
+}
+
+// FromContext 返回 context 中的 SelectOption
+func FromContext(ctx context.Context) []SelectOption {
+	opts, _ := ctx.Value(selectOptionsKey{}).([]SelectOption)
+	// 返回副本, 避免 append 修改父 context 中的 slice
+	return append([]SelectOption(nil), opts...)
+}
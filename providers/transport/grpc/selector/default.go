@@ -1,11 +1,16 @@
 package selector
 
 import (
+	"sync"
+	"time"
+
 	registry "github.com/aka-yz/go-micro-core/register"
 )
 
 type defaultSelector struct {
 	so Options
+	// health service name -> *serviceHealth
+	health sync.Map
 }
 
 func (r *defaultSelector) Init(opts ...Option) error {
@@ -22,6 +27,7 @@ func (r *defaultSelector) Options() Options {
 func (r *defaultSelector) Select(service string, opts ...SelectOption) (Next, error) {
 	sopts := SelectOptions{
 		Strategy: r.so.Strategy,
+		Hash:     r.so.Hash,
 	}
 
 	for _, opt := range opts {
@@ -29,9 +35,22 @@ func (r *defaultSelector) Select(service string, opts ...SelectOption) (Next, er
 	}
 
 	// get the service
-	services, err := r.so.Registry.GetService(service)
-	if err != nil {
-		return nil, err
+	services := sopts.Services
+	if services == nil {
+		var err error
+		if services, err = r.so.Registry.GetService(service); err != nil {
+			return nil, err
+		}
+	}
+
+	// remove the ejected nodes
+	if v, ok := r.health.Load(service); ok {
+		services = v.(*serviceHealth).filter(services, time.Now())
+	}
+
+	// route by the rules
+	if r.so.Router != nil {
+		services = r.so.Router.route(service, services, sopts.Metadata)
 	}
 
 	// apply the filters
@@ -44,15 +63,38 @@ func (r *defaultSelector) Select(service string, opts ...SelectOption) (Next, er
 		return nil, ErrNoneAvailable
 	}
 
+	if sopts.Hash != nil && sopts.HashKey != "" {
+		return sopts.Hash(sopts.HashKey, services), nil
+	}
 	return sopts.Strategy(services), nil
 }
 
 func (r *defaultSelector) Mark(service string, node *registry.Node, err error) {
-	return
+	if node == nil {
+		return
+	}
+
+	v, _ := r.health.LoadOrStore(service, &serviceHealth{nodes: make(map[string]*nodeHealth)})
+	v.(*serviceHealth).mark(node.Id, err, r.healthOptions(service), time.Now())
 }
 
 func (r *defaultSelector) Reset(service string) {
-	return
+	r.health.Delete(service)
+}
+
+func (r *defaultSelector) Health(service string) map[string]NodeHealth {
+	v, ok := r.health.Load(service)
+	if !ok {
+		return map[string]NodeHealth{}
+	}
+	return v.(*serviceHealth).health(time.Now())
+}
+
+func (r *defaultSelector) healthOptions(service string) HealthOptions {
+	if h, ok := r.so.ServiceHealth[service]; ok {
+		return h.withDefaults()
+	}
+	return r.so.Health.withDefaults()
 }
 
 func (r *defaultSelector) Close() error {
@@ -0,0 +1,190 @@
+package selector
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	registry "github.com/aka-yz/go-micro-core/register"
+)
+
+var (
+	// ringReplicas 每个节点在 ring 上的虚拟节点数(按权重缩放)
+	ringReplicas = 100
+	// maglevSize maglev 查找表大小, 必须是质数且远大于节点数
+	maglevSize uint64 = 65537
+	// 最多缓存的 ring/table 数, 超过后全部重建
+	maxHashTables = 64
+)
+
+// hashTables 节点列表 -> ring/table, 节点不变时复用
+type hashTables struct {
+	sync.Mutex
+	tables map[string]interface{}
+}
+
+func (h *hashTables) get(nodes []*registry.Node, build func([]*registry.Node) interface{}) interface{} {
+	key := nodesKey(nodes)
+
+	h.Lock()
+	defer h.Unlock()
+	if t, ok := h.tables[key]; ok {
+		return t
+	}
+	if len(h.tables) >= maxHashTables {
+		h.tables = make(map[string]interface{})
+	}
+	t := build(nodes)
+	h.tables[key] = t
+	return t
+}
+
+var (
+	rings   = &hashTables{tables: make(map[string]interface{})}
+	maglevs = &hashTables{tables: make(map[string]interface{})}
+)
+
+type ring struct {
+	hashes []uint64
+	nodes  []*registry.Node
+}
+
+func buildRing(nodes []*registry.Node) interface{} {
+	r := &ring{}
+	for _, node := range nodes {
+		replicas := ringReplicas * nodeWeight(node) / DefaultWeight
+		if replicas < 1 {
+			replicas = 1
+		}
+		for i := 0; i < replicas; i++ {
+			r.hashes = append(r.hashes, hash64(node.Id+"-"+strconv.Itoa(i)))
+			r.nodes = append(r.nodes, node)
+		}
+	}
+	sort.Sort(r)
+	return r
+}
+
+func (r *ring) Len() int           { return len(r.hashes) }
+func (r *ring) Less(i, j int) bool { return r.hashes[i] < r.hashes[j] }
+func (r *ring) Swap(i, j int) {
+	r.hashes[i], r.hashes[j] = r.hashes[j], r.hashes[i]
+	r.nodes[i], r.nodes[j] = r.nodes[j], r.nodes[i]
+}
+
+// RingHash is a consistent hashing strategy (ketama), nodes are weighted by
+// their weight metadata. Subsequent calls of Next walk the ring to the next node.
+func RingHash(key string, services []*registry.Service) Next {
+	nodes := sortedNodes(services)
+	if len(nodes) == 0 {
+		return func() (*registry.Node, error) {
+			return nil, ErrNoneAvailable
+		}
+	}
+
+	r := rings.get(nodes, buildRing).(*ring)
+	h := hash64(key)
+	i := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= h })
+
+	seen := make(map[string]bool)
+	return func() (*registry.Node, error) {
+		for n := 0; n < len(r.nodes); n++ {
+			node := r.nodes[i%len(r.nodes)]
+			i++
+			if !seen[node.Id] {
+				seen[node.Id] = true
+				return node, nil
+			}
+		}
+		return nil, ErrNoneAvailable
+	}
+}
+
+func buildMaglev(nodes []*registry.Node) interface{} {
+	offsets := make([]uint64, len(nodes))
+	skips := make([]uint64, len(nodes))
+	for i, node := range nodes {
+		offsets[i] = hash64(node.Id) % maglevSize
+		skips[i] = hash64(node.Id+"-skip")%(maglevSize-1) + 1
+	}
+
+	table := make([]int, maglevSize)
+	for i := range table {
+		table[i] = -1
+	}
+	next := make([]uint64, len(nodes))
+	for filled := uint64(0); ; {
+		for i := range nodes {
+			c := (offsets[i] + next[i]*skips[i]) % maglevSize
+			for table[c] >= 0 {
+				next[i]++
+				c = (offsets[i] + next[i]*skips[i]) % maglevSize
+			}
+			table[c] = i
+			next[i]++
+			if filled++; filled == maglevSize {
+				return table
+			}
+		}
+	}
+}
+
+// Maglev is a consistent hashing strategy with a maglev lookup table, it spreads
+// keys more evenly than RingHash. Subsequent calls of Next return the following nodes.
+func Maglev(key string, services []*registry.Service) Next {
+	nodes := sortedNodes(services)
+	if len(nodes) == 0 {
+		return func() (*registry.Node, error) {
+			return nil, ErrNoneAvailable
+		}
+	}
+
+	table := maglevs.get(nodes, buildMaglev).([]int)
+	i := table[hash64(key)%maglevSize]
+
+	var n int
+	return func() (*registry.Node, error) {
+		if n >= len(nodes) {
+			return nil, ErrNoneAvailable
+		}
+		node := nodes[(i+n)%len(nodes)]
+		n++
+		return node, nil
+	}
+}
+
+// sortedNodes 节点按 id 排序, 保证相同节点集合得到相同的 ring/table
+func sortedNodes(services []*registry.Service) []*registry.Node {
+	nodes := flatten(services)
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Id < nodes[j].Id
+	})
+	return nodes
+}
+
+func nodesKey(nodes []*registry.Node) string {
+	var b strings.Builder
+	for _, node := range nodes {
+		b.WriteString(node.Id)
+		b.WriteByte('=')
+		b.WriteString(strconv.Itoa(nodeWeight(node)))
+		b.WriteByte(',')
+	}
+	return b.String()
+}
+
+func hash64(s string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(s))
+
+	// fnv 对相近的字符串区分度不够, 再做一次 splitmix64 混合
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
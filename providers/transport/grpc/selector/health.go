@@ -0,0 +1,226 @@
+package selector
+
+import (
+	"sync"
+	"time"
+
+	registry "github.com/aka-yz/go-micro-core/register"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// 健康统计的默认值
+var (
+	DefaultMinRequests  = 10
+	DefaultInterval     = 10 * time.Second
+	DefaultBaseEjection = 30 * time.Second
+	DefaultMaxEjection  = 5 * time.Minute
+
+	// healthIdle 超过该时间没有更新的节点状态会被清理
+	healthIdle = 10 * time.Minute
+)
+
+// HealthOptions are the outlier ejection thresholds of a service,
+// a zero threshold disables the check
+type HealthOptions struct {
+	// ConsecutiveErrors 连续失败次数达到后摘除节点
+	ConsecutiveErrors int
+	// ErrorRate 统计窗口内失败率达到后摘除节点, 请求数不少于 MinRequests 才生效
+	ErrorRate   float64
+	MinRequests int
+	// Interval 失败率的统计窗口
+	Interval time.Duration
+	// BaseEjection 第一次摘除的时长, 之后每次翻倍, 不超过 MaxEjection
+	BaseEjection time.Duration
+	MaxEjection  time.Duration
+	// IsFailure 判断 Mark 的 error 是否算作节点失败, 默认只有连接和服务端故障类的 grpc code
+	IsFailure func(error) bool
+}
+
+// NodeHealth is the health state of a node
+type NodeHealth struct {
+	// Requests/Failures 当前统计窗口内的请求和失败数
+	Requests          int
+	Failures          int
+	ConsecutiveErrors int
+	Ejected           bool
+	EjectedUntil      time.Time
+	// Ejections 连续被摘除的次数, 恢复后成功一次清零
+	Ejections int
+}
+
+// HealthReporter is implemented by selectors which track node health
+type HealthReporter interface {
+	// Health returns the health of the nodes of the service by node id
+	Health(service string) map[string]NodeHealth
+}
+
+type nodeHealth struct {
+	NodeHealth
+	windowStart time.Time
+	// probing 摘除到期后恢复流量, 成功前再失败一次立即重新摘除
+	probing bool
+	updated time.Time
+}
+
+type serviceHealth struct {
+	sync.Mutex
+	nodes     map[string]*nodeHealth
+	lastSweep time.Time
+}
+
+func (o HealthOptions) withDefaults() HealthOptions {
+	if o.MinRequests <= 0 {
+		o.MinRequests = DefaultMinRequests
+	}
+	if o.Interval <= 0 {
+		o.Interval = DefaultInterval
+	}
+	if o.BaseEjection <= 0 {
+		o.BaseEjection = DefaultBaseEjection
+	}
+	if o.MaxEjection < o.BaseEjection {
+		o.MaxEjection = DefaultMaxEjection
+		if o.MaxEjection < o.BaseEjection {
+			o.MaxEjection = o.BaseEjection
+		}
+	}
+	if o.IsFailure == nil {
+		o.IsFailure = IsFailure
+	}
+	return o
+}
+
+func (o HealthOptions) enabled() bool {
+	return o.ConsecutiveErrors > 0 || o.ErrorRate > 0
+}
+
+// IsFailure 连接和服务端故障类的 grpc code 算作失败, 业务错误不算.
+// 节点摘除和熔断使用同一个判断
+func IsFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Internal, codes.Unknown, codes.DataLoss:
+		return true
+	}
+	return false
+}
+
+// mark 记录一次请求的结果, 超过阈值时摘除节点
+func (s *serviceHealth) mark(id string, err error, o HealthOptions, now time.Time) {
+	s.Lock()
+	defer s.Unlock()
+	s.sweep(now)
+
+	h, ok := s.nodes[id]
+	if !ok {
+		h = &nodeHealth{windowStart: now}
+		s.nodes[id] = h
+	}
+	h.updated = now
+	if now.Sub(h.windowStart) > o.Interval {
+		h.windowStart, h.Requests, h.Failures = now, 0, 0
+	}
+	h.Requests++
+
+	if !o.IsFailure(err) {
+		h.ConsecutiveErrors = 0
+		if h.probing && !now.Before(h.EjectedUntil) {
+			h.probing, h.Ejections = false, 0
+		}
+		return
+	}
+
+	h.Failures++
+	h.ConsecutiveErrors++
+	// 摘除期间返回的请求只计数
+	if !o.enabled() || now.Before(h.EjectedUntil) {
+		return
+	}
+	if h.probing ||
+		(o.ConsecutiveErrors > 0 && h.ConsecutiveErrors >= o.ConsecutiveErrors) ||
+		(o.ErrorRate > 0 && h.Requests >= o.MinRequests && float64(h.Failures)/float64(h.Requests) >= o.ErrorRate) {
+		h.eject(o, now)
+	}
+}
+
+func (h *nodeHealth) eject(o HealthOptions, now time.Time) {
+	d := o.BaseEjection
+	for i := 0; i < h.Ejections && d < o.MaxEjection; i++ {
+		d *= 2
+	}
+	if d > o.MaxEjection {
+		d = o.MaxEjection
+	}
+
+	h.Ejections++
+	h.EjectedUntil = now.Add(d)
+	h.probing = true
+	h.windowStart, h.Requests, h.Failures, h.ConsecutiveErrors = now, 0, 0, 0
+}
+
+// filter 去掉被摘除的节点, 全部被摘除时返回原列表
+func (s *serviceHealth) filter(services []*registry.Service, now time.Time) []*registry.Service {
+	s.Lock()
+	defer s.Unlock()
+
+	var ejected bool
+	for _, service := range services {
+		for _, node := range service.Nodes {
+			if h, ok := s.nodes[node.Id]; ok && now.Before(h.EjectedUntil) {
+				ejected = true
+			}
+		}
+	}
+	if !ejected {
+		return services
+	}
+
+	var healthy []*registry.Service
+	for _, service := range services {
+		var nodes []*registry.Node
+		for _, node := range service.Nodes {
+			if h, ok := s.nodes[node.Id]; !ok || !now.Before(h.EjectedUntil) {
+				nodes = append(nodes, node)
+			}
+		}
+		if len(nodes) > 0 {
+			serv := new(registry.Service)
+			*serv = *service
+			serv.Nodes = nodes
+			healthy = append(healthy, serv)
+		}
+	}
+	if len(healthy) == 0 {
+		return services
+	}
+	return healthy
+}
+
+func (s *serviceHealth) health(now time.Time) map[string]NodeHealth {
+	s.Lock()
+	defer s.Unlock()
+
+	nodes := make(map[string]NodeHealth, len(s.nodes))
+	for id, h := range s.nodes {
+		nh := h.NodeHealth
+		nh.Ejected = now.Before(h.EjectedUntil)
+		nodes[id] = nh
+	}
+	return nodes
+}
+
+// sweep 清理已下线节点的状态
+func (s *serviceHealth) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+	for id, h := range s.nodes {
+		if now.Sub(h.updated) > healthIdle && !now.Before(h.EjectedUntil) {
+			delete(s.nodes, id)
+		}
+	}
+}
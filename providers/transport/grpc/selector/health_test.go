@@ -0,0 +1,73 @@
+package selector
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestHealthEjection(t *testing.T) {
+	s := NewSelector(Health(HealthOptions{ConsecutiveErrors: 3}))
+	services := testServices("health", 100, 100)
+	bad := services[0].Nodes[0]
+
+	unavailable := status.Error(codes.Unavailable, "unavailable")
+	// 业务错误不算节点失败
+	for i := 0; i < 5; i++ {
+		s.Mark("health", bad, status.Error(codes.NotFound, "not found"))
+	}
+	for i := 0; i < 3; i++ {
+		s.Mark("health", bad, unavailable)
+	}
+
+	health := s.(HealthReporter).Health("health")
+	if !health[bad.Id].Ejected || health[bad.Id].Ejections != 1 {
+		t.Fatalf("unexpected health %+v", health[bad.Id])
+	}
+	for i := 0; i < 10; i++ {
+		next, err := s.Select("health", WithServices(services))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if node, _ := next(); node.Id == bad.Id {
+			t.Fatal("ejected node selected")
+		}
+	}
+
+	s.Reset("health")
+	if len(s.(HealthReporter).Health("health")) != 0 {
+		t.Fatal("health not reset")
+	}
+}
+
+func TestHealthBackoff(t *testing.T) {
+	o := HealthOptions{ErrorRate: 0.5, MinRequests: 2, BaseEjection: time.Second, MaxEjection: 3 * time.Second}.withDefaults()
+	s := &serviceHealth{nodes: make(map[string]*nodeHealth)}
+	now := time.Now()
+	err := errors.New("connection refused")
+
+	s.mark("n", nil, o, now)
+	s.mark("n", err, o, now)
+	if until := s.nodes["n"].EjectedUntil; !until.Equal(now.Add(time.Second)) {
+		t.Fatalf("unexpected ejection %v", until.Sub(now))
+	}
+
+	// 恢复后第一次失败立即重新摘除, 时长翻倍, 不超过最大值
+	for i, d := range []time.Duration{2 * time.Second, 3 * time.Second} {
+		now = s.nodes["n"].EjectedUntil
+		s.mark("n", err, o, now)
+		if until := s.nodes["n"].EjectedUntil; !until.Equal(now.Add(d)) {
+			t.Fatalf("ejection %d: unexpected duration %v", i, until.Sub(now))
+		}
+	}
+
+	// 恢复后成功一次清零
+	now = s.nodes["n"].EjectedUntil
+	s.mark("n", nil, o, now)
+	if h := s.nodes["n"]; h.probing || h.Ejections != 0 {
+		t.Fatalf("unexpected health %+v", h.NodeHealth)
+	}
+}
@@ -0,0 +1,104 @@
+package selector
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	registry "github.com/aka-yz/go-micro-core/register"
+)
+
+var (
+	// ewmaDecay 延迟 EWMA 的衰减时间
+	ewmaDecay = 10 * time.Second
+	// loadIdle 超过该时间没有请求的节点负载会被清理
+	loadIdle = 10 * time.Minute
+)
+
+// nodeLoad 节点的在途请求数和延迟 EWMA
+type nodeLoad struct {
+	inflight int64
+
+	sync.Mutex
+	ewma  float64
+	stamp time.Time
+}
+
+var (
+	// loads node id -> *nodeLoad
+	loads     sync.Map
+	lastSweep int64
+)
+
+// Track marks the start of a request to the node, the returned func must be
+// called once the request finishes. LeastOutstanding and P2C rely on it.
+func Track(node *registry.Node) func() {
+	sweep()
+
+	l := loadOf(node)
+	atomic.AddInt64(&l.inflight, 1)
+	start := time.Now()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			atomic.AddInt64(&l.inflight, -1)
+			l.observe(time.Since(start))
+		})
+	}
+}
+
+func loadOf(node *registry.Node) *nodeLoad {
+	if v, ok := loads.Load(node.Id); ok {
+		return v.(*nodeLoad)
+	}
+	v, _ := loads.LoadOrStore(node.Id, &nodeLoad{})
+	return v.(*nodeLoad)
+}
+
+func (l *nodeLoad) outstanding() int64 {
+	return atomic.LoadInt64(&l.inflight)
+}
+
+func (l *nodeLoad) observe(rtt time.Duration) {
+	l.Lock()
+	defer l.Unlock()
+
+	now := time.Now()
+	if l.stamp.IsZero() {
+		l.ewma = float64(rtt)
+	} else {
+		w := math.Exp(-float64(now.Sub(l.stamp)) / float64(ewmaDecay))
+		l.ewma = l.ewma*w + float64(rtt)*(1-w)
+	}
+	l.stamp = now
+}
+
+// score 越小越好, 没有延迟数据的节点优先
+func (l *nodeLoad) score() float64 {
+	l.Lock()
+	ewma := l.ewma
+	l.Unlock()
+	return (ewma + 1) * float64(l.outstanding()+1)
+}
+
+// sweep 清理已下线节点的负载数据
+func sweep() {
+	now := time.Now()
+	last := atomic.LoadInt64(&lastSweep)
+	if now.UnixNano()-last < int64(loadIdle) || !atomic.CompareAndSwapInt64(&lastSweep, last, now.UnixNano()) {
+		return
+	}
+
+	loads.Range(func(key, value interface{}) bool {
+		l := value.(*nodeLoad)
+		l.Lock()
+		idle := !l.stamp.IsZero() && now.Sub(l.stamp) > loadIdle
+		l.Unlock()
+		if idle && l.outstanding() == 0 {
+			loads.Delete(key)
+		}
+		return true
+	})
+}
@@ -0,0 +1,171 @@
+package selector
+
+import (
+	"sync"
+	"sync/atomic"
+
+	registry "github.com/aka-yz/go-micro-core/register"
+)
+
+// DefaultLocalityThreshold 本地可用容量低于平均值的该比例时溢出
+const DefaultLocalityThreshold = 0.5
+
+// LocalityStats 按位置统计的选择次数
+type LocalityStats struct {
+	// Local 选中同 zone 节点的次数
+	Local uint64
+	// CrossZone 选中同 region 其他 zone 节点的次数
+	CrossZone uint64
+	// CrossRegion 选中其他 region(或没有位置信息)节点的次数
+	CrossRegion uint64
+}
+
+// LocalitySelector prefers nodes in the local zone, then the local region
+type LocalitySelector interface {
+	Selector
+	// Stats returns the selection counts by service
+	Stats() map[string]LocalityStats
+}
+
+type localitySelector struct {
+	Selector
+	zone      string
+	region    string
+	threshold float64
+
+	// stats service name -> *localityCounter
+	stats sync.Map
+}
+
+type localityCounter struct {
+	local, crossZone, crossRegion uint64
+}
+
+// NewLocalitySelector wraps s to prefer nodes of the zone, and spills to the region
+// and then all nodes when the healthy capacity of the local zone is below threshold.
+// The capacity is the share of the local nodes in the candidates multiplied by the
+// number of zones, i.e. 1 means the local zone has an average number of healthy nodes.
+func NewLocalitySelector(s Selector, zone, region string, threshold float64) LocalitySelector {
+	if threshold <= 0 {
+		threshold = DefaultLocalityThreshold
+	}
+	return &localitySelector{
+		Selector:  s,
+		zone:      zone,
+		region:    region,
+		threshold: threshold,
+	}
+}
+
+func (l *localitySelector) Select(service string, opts ...SelectOption) (Next, error) {
+	if l.zone == "" && l.region == "" {
+		return l.Selector.Select(service, opts...)
+	}
+
+	// 在调用方的 filter 之后按位置过滤
+	next, err := l.Selector.Select(service, append(opts, WithFilter(l.filter))...)
+	if err != nil {
+		return nil, err
+	}
+
+	v, _ := l.stats.LoadOrStore(service, &localityCounter{})
+	counter := v.(*localityCounter)
+	return func() (*registry.Node, error) {
+		node, err := next()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case l.zone != "" && l.sameZone(node):
+			atomic.AddUint64(&counter.local, 1)
+		case l.region != "" && l.sameRegion(node):
+			atomic.AddUint64(&counter.crossZone, 1)
+		default:
+			atomic.AddUint64(&counter.crossRegion, 1)
+		}
+		return node, nil
+	}, nil
+}
+
+// filter 依次尝试同 zone, 同 region 的节点, 容量不足时返回全部节点
+func (l *localitySelector) filter(services []*registry.Service) []*registry.Service {
+	if l.zone != "" {
+		if ss, ok := l.prefer(services, registry.ZoneKey, l.sameZone); ok {
+			return ss
+		}
+	}
+	if l.region != "" {
+		if ss, ok := l.prefer(services, registry.RegionKey, l.sameRegion); ok {
+			return ss
+		}
+	}
+	return services
+}
+
+func (l *localitySelector) prefer(services []*registry.Service, key string, local func(*registry.Node) bool) ([]*registry.Service, bool) {
+	var total, count int
+	groups := make(map[string]bool)
+	var preferred []*registry.Service
+	for _, service := range services {
+		var nodes []*registry.Node
+		for _, node := range service.Nodes {
+			total++
+			groups[nodeMetadata(node, key)] = true
+			if local(node) {
+				nodes = append(nodes, node)
+			}
+		}
+		if len(nodes) > 0 {
+			count += len(nodes)
+			s := new(registry.Service)
+			*s = *service
+			s.Nodes = nodes
+			preferred = append(preferred, s)
+		}
+	}
+
+	if count == 0 || float64(count*len(groups))/float64(total) < l.threshold {
+		return nil, false
+	}
+	return preferred, true
+}
+
+func (l *localitySelector) sameZone(node *registry.Node) bool {
+	return nodeMetadata(node, registry.ZoneKey) == l.zone
+}
+
+func (l *localitySelector) sameRegion(node *registry.Node) bool {
+	return nodeMetadata(node, registry.RegionKey) == l.region
+}
+
+func (l *localitySelector) Stats() map[string]LocalityStats {
+	stats := make(map[string]LocalityStats)
+	l.stats.Range(func(key, value interface{}) bool {
+		c := value.(*localityCounter)
+		stats[key.(string)] = LocalityStats{
+			Local:       atomic.LoadUint64(&c.local),
+			CrossZone:   atomic.LoadUint64(&c.crossZone),
+			CrossRegion: atomic.LoadUint64(&c.crossRegion),
+		}
+		return true
+	})
+	return stats
+}
+
+func (l *localitySelector) Health(service string) map[string]NodeHealth {
+	if h, ok := l.Selector.(HealthReporter); ok {
+		return h.Health(service)
+	}
+	return map[string]NodeHealth{}
+}
+
+func (l *localitySelector) String() string {
+	return "locality"
+}
+
+func nodeMetadata(node *registry.Node, key string) string {
+	if node.Metadata == nil {
+		return ""
+	}
+	return node.Metadata[key]
+}
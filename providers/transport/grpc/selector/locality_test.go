@@ -0,0 +1,57 @@
+package selector
+
+import (
+	"fmt"
+	"testing"
+
+	registry "github.com/aka-yz/go-micro-core/register"
+)
+
+func localityServices(zones ...string) []*registry.Service {
+	service := &registry.Service{Name: "locality", Version: "v1"}
+	for i, zone := range zones {
+		service.Nodes = append(service.Nodes, &registry.Node{
+			Id:       fmt.Sprintf("node-%d", i),
+			Metadata: map[string]string{registry.ZoneKey: zone, registry.RegionKey: "r1"},
+		})
+	}
+	return []*registry.Service{service}
+}
+
+func TestLocalitySelector(t *testing.T) {
+	s := NewLocalitySelector(NewSelector(), "z1", "r1", 0.5)
+
+	// 本地 zone 容量充足, 只选本地节点
+	services := localityServices("z1", "z1", "z2", "z2")
+	for i := 0; i < 20; i++ {
+		next, err := s.Select("locality", WithServices(services))
+		if err != nil {
+			t.Fatal(err)
+		}
+		node, _ := next()
+		if node.Metadata[registry.ZoneKey] != "z1" {
+			t.Fatalf("unexpected zone %v", node.Metadata)
+		}
+	}
+
+	// 本地只剩 1/5 的节点, 低于阈值, 溢出到同 region
+	services = localityServices("z1", "z2", "z2", "z2", "z2")
+	var cross bool
+	for i := 0; i < 50; i++ {
+		next, err := s.Select("locality", WithServices(services))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if node, _ := next(); node.Metadata[registry.ZoneKey] == "z2" {
+			cross = true
+		}
+	}
+	if !cross {
+		t.Fatal("expected spill to other zones")
+	}
+
+	stats := s.Stats()["locality"]
+	if stats.Local < 20 || stats.CrossZone == 0 || stats.CrossRegion != 0 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
@@ -8,6 +8,13 @@ import (
 type Options struct {
 	Registry registry.Registry
 	Strategy Strategy
+	// Hash 不为空且请求有 hash key 时使用
+	Hash HashStrategy
+	// Health 节点摘除的阈值, ServiceHealth 按服务覆盖
+	Health        HealthOptions
+	ServiceHealth map[string]HealthOptions
+	// Router 按规则在版本间分流
+	Router *Router
 
 	Context context.Context
 }
@@ -15,6 +22,12 @@ type Options struct {
 type SelectOptions struct {
 	Filters  []Filter
 	Strategy Strategy
+	// Services 指定候选服务, 不再从 registry 获取
+	Services []*registry.Service
+	Hash     HashStrategy
+	HashKey  string
+	// Metadata 请求的 metadata, key 为小写, 用于路由规则的匹配
+	Metadata map[string]string
 
 	Context context.Context
 }
@@ -39,6 +52,37 @@ func SetStrategy(fn Strategy) Option {
 	}
 }
 
+// SetHashStrategy sets the default hash strategy for the selector
+func SetHashStrategy(fn HashStrategy) Option {
+	return func(o *Options) {
+		o.Hash = fn
+	}
+}
+
+// Health sets the default outlier ejection thresholds
+func Health(h HealthOptions) Option {
+	return func(o *Options) {
+		o.Health = h
+	}
+}
+
+// ServiceHealth sets the outlier ejection thresholds of the service
+func ServiceHealth(service string, h HealthOptions) Option {
+	return func(o *Options) {
+		if o.ServiceHealth == nil {
+			o.ServiceHealth = make(map[string]HealthOptions)
+		}
+		o.ServiceHealth[service] = h
+	}
+}
+
+// SetRouter sets the routing rules of the selector
+func SetRouter(r *Router) Option {
+	return func(o *Options) {
+		o.Router = r
+	}
+}
+
 // WithFilter adds a filter function to the list of filters
 // used during the Select call.
 func WithFilter(fn ...Filter) SelectOption {
@@ -53,3 +97,31 @@ func WithStrategy(fn Strategy) SelectOption {
 		o.Strategy = fn
 	}
 }
+
+// WithServices selects from the given services instead of the registry
+func WithServices(services []*registry.Service) SelectOption {
+	return func(o *SelectOptions) {
+		o.Services = services
+	}
+}
+
+// WithHashStrategy sets the hash strategy
+func WithHashStrategy(fn HashStrategy) SelectOption {
+	return func(o *SelectOptions) {
+		o.Hash = fn
+	}
+}
+
+// WithHashKey sets the key of the hash strategy, e.g. user id for sticky routing
+func WithHashKey(key string) SelectOption {
+	return func(o *SelectOptions) {
+		o.HashKey = key
+	}
+}
+
+// WithMetadata sets the request metadata matched by the routing rules
+func WithMetadata(md map[string]string) SelectOption {
+	return func(o *SelectOptions) {
+		o.Metadata = md
+	}
+}
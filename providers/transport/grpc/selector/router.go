@@ -0,0 +1,189 @@
+package selector
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	registry "github.com/aka-yz/go-micro-core/register"
+)
+
+// Rule is the routing rule of a service. Matches are checked in order against
+// the request metadata, otherwise a version is chosen by the route weights.
+type Rule struct {
+	Matches []Match `json:"matches,omitempty"`
+	Routes  []Route `json:"routes,omitempty"`
+}
+
+// Match routes the request to Version when all the headers are equal
+type Match struct {
+	Headers map[string]string `json:"headers"`
+	Version string            `json:"version"`
+}
+
+// Route is a weighted version of a traffic split
+type Route struct {
+	Version string `json:"version"`
+	Weight  int    `json:"weight"`
+}
+
+// Validate checks the weights of the rule
+func (rule *Rule) Validate() error {
+	if len(rule.Matches) == 0 && len(rule.Routes) == 0 {
+		return errors.New("empty rule")
+	}
+	var total int
+	for _, r := range rule.Routes {
+		if r.Weight < 0 {
+			return fmt.Errorf("route version:%v negative weight:%v", r.Version, r.Weight)
+		}
+		total += r.Weight
+	}
+	if len(rule.Routes) > 0 && total == 0 {
+		return errors.New("routes total weight is 0")
+	}
+	return nil
+}
+
+// version 选择请求的版本, 只考虑当前有节点的版本, 没有可用版本时返回 false
+func (rule *Rule) version(services []*registry.Service, md map[string]string) (string, bool) {
+	present := make(map[string]bool, len(services))
+	for _, service := range services {
+		present[service.Version] = true
+	}
+
+	for _, m := range rule.Matches {
+		if present[m.Version] && m.match(md) {
+			return m.Version, true
+		}
+	}
+
+	var total int
+	for _, r := range rule.Routes {
+		if present[r.Version] {
+			total += r.Weight
+		}
+	}
+	if total == 0 {
+		return "", false
+	}
+
+	n := rand.Intn(total)
+	for _, r := range rule.Routes {
+		if !present[r.Version] {
+			continue
+		}
+		if n < r.Weight {
+			return r.Version, true
+		}
+		n -= r.Weight
+	}
+	return "", false
+}
+
+func (m *Match) match(md map[string]string) bool {
+	if len(m.Headers) == 0 {
+		return false
+	}
+	for k, v := range m.Headers {
+		if md[strings.ToLower(k)] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Router holds the routing rules by service, rules can be updated at any time
+type Router struct {
+	mu sync.Mutex
+	// rules map[string]*Rule, 整体替换, 读不加锁
+	rules atomic.Value
+	// base SetBase 设置的规则 (如本地配置), Reset 后恢复
+	base map[string]*Rule
+}
+
+func NewRouter() *Router {
+	r := &Router{base: make(map[string]*Rule)}
+	r.rules.Store(map[string]*Rule{})
+	return r
+}
+
+// Set sets the rule of the service
+func (r *Router) Set(service string, rule *Rule) error {
+	if err := rule.Validate(); err != nil {
+		return fmt.Errorf("service:%v rule error:%v", service, err)
+	}
+
+	r.update(func(rules map[string]*Rule) {
+		rules[service] = rule
+	})
+	return nil
+}
+
+// SetBase sets the base rule of the service, it is used when no other rule is set
+// or after Reset
+func (r *Router) SetBase(service string, rule *Rule) error {
+	if err := rule.Validate(); err != nil {
+		return fmt.Errorf("service:%v rule error:%v", service, err)
+	}
+
+	r.update(func(rules map[string]*Rule) {
+		r.base[service] = rule
+		rules[service] = rule
+	})
+	return nil
+}
+
+// Reset removes the rule set by Set, the base rule of the service is restored
+func (r *Router) Reset(service string) {
+	r.update(func(rules map[string]*Rule) {
+		if rule, ok := r.base[service]; ok {
+			rules[service] = rule
+		} else {
+			delete(rules, service)
+		}
+	})
+}
+
+// Delete removes the rule of the service, including the base rule
+func (r *Router) Delete(service string) {
+	r.update(func(rules map[string]*Rule) {
+		delete(r.base, service)
+		delete(rules, service)
+	})
+}
+
+// Rule returns the rule of the service
+func (r *Router) Rule(service string) (*Rule, bool) {
+	rule, ok := r.rules.Load().(map[string]*Rule)[service]
+	return rule, ok
+}
+
+func (r *Router) update(fn func(map[string]*Rule)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	old := r.rules.Load().(map[string]*Rule)
+	rules := make(map[string]*Rule, len(old)+1)
+	for k, v := range old {
+		rules[k] = v
+	}
+	fn(rules)
+	r.rules.Store(rules)
+}
+
+// route 只保留规则选中版本的服务, 没有规则或选中的版本没有节点时不过滤
+func (r *Router) route(service string, services []*registry.Service, md map[string]string) []*registry.Service {
+	rule, ok := r.Rule(service)
+	if !ok {
+		return services
+	}
+	version, ok := rule.version(services, md)
+	if !ok {
+		return services
+	}
+	return FilterVersion(version)(services)
+}
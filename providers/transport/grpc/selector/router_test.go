@@ -0,0 +1,81 @@
+package selector
+
+import (
+	"testing"
+
+	registry "github.com/aka-yz/go-micro-core/register"
+)
+
+func versionServices(versions ...string) []*registry.Service {
+	var services []*registry.Service
+	for i, v := range versions {
+		services = append(services, &registry.Service{
+			Name:    "router",
+			Version: v,
+			Nodes:   []*registry.Node{{Id: v, Port: 8000 + i}},
+		})
+	}
+	return services
+}
+
+func TestRouter(t *testing.T) {
+	r := NewRouter()
+	if err := r.Set("router", &Rule{Routes: []Route{{Version: "v1", Weight: 0}}}); err == nil {
+		t.Fatal("expected weight error")
+	}
+	err := r.Set("router", &Rule{
+		Matches: []Match{{Headers: map[string]string{"sid-canary": "true"}, Version: "v3"}},
+		Routes:  []Route{{Version: "v1", Weight: 95}, {Version: "v3", Weight: 5}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewSelector(SetRouter(r))
+	services := versionServices("v1", "v3")
+	counts := make(map[string]int)
+	for i := 0; i < 2000; i++ {
+		next, err := s.Select("router", WithServices(services))
+		if err != nil {
+			t.Fatal(err)
+		}
+		node, _ := next()
+		counts[node.Id]++
+	}
+	if counts["v3"] < 40 || counts["v3"] > 200 {
+		t.Fatalf("unexpected split %v", counts)
+	}
+
+	// header 覆盖权重
+	for i := 0; i < 20; i++ {
+		next, _ := s.Select("router", WithServices(services), WithMetadata(map[string]string{"sid-canary": "true"}))
+		if node, _ := next(); node.Id != "v3" {
+			t.Fatalf("canary routed to %v", node.Id)
+		}
+	}
+
+	// 选中的版本没有节点时不过滤
+	next, err := s.Select("router", WithServices(versionServices("v2")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if node, _ := next(); node.Id != "v2" {
+		t.Fatalf("unexpected node %v", node.Id)
+	}
+
+	r.Delete("router")
+	if _, ok := r.Rule("router"); ok {
+		t.Fatal("rule not deleted")
+	}
+
+	// Reset 恢复 base 规则
+	base := &Rule{Routes: []Route{{Version: "v1", Weight: 100}}}
+	if err = r.SetBase("router", base); err != nil {
+		t.Fatal(err)
+	}
+	r.Set("router", &Rule{Routes: []Route{{Version: "v3", Weight: 100}}})
+	r.Reset("router")
+	if rule, _ := r.Rule("router"); rule != base {
+		t.Fatalf("base rule not restored: %+v", rule)
+	}
+}
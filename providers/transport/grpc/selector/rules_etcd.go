@@ -0,0 +1,109 @@
+package selector
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strings"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// 规则 watch 断开后重新 watch 的等待时间
+var rulesRewatchInterval = time.Second
+
+type etcdRules struct {
+	client *clientv3.Client
+	prefix string
+	router *Router
+	// services 从 etcd 加载的服务, 重新加载时删除已不存在的规则
+	services map[string]bool
+}
+
+// WatchRules loads the routing rules under prefix from etcd into the router, and keeps
+// them updated until ctx is done. Keys are <prefix>/<service> with a json Rule value.
+// Rules in etcd override the base rules of the router, deleting the key restores them.
+func WatchRules(ctx context.Context, client *clientv3.Client, prefix string, r *Router) error {
+	e := &etcdRules{
+		client:   client,
+		prefix:   strings.TrimSuffix(prefix, "/") + "/",
+		router:   r,
+		services: make(map[string]bool),
+	}
+
+	rev, err := e.load(ctx)
+	if err != nil {
+		return err
+	}
+	go e.watch(ctx, rev)
+	return nil
+}
+
+func (e *etcdRules) load(ctx context.Context) (int64, error) {
+	resp, err := e.client.Get(ctx, e.prefix, clientv3.WithPrefix())
+	if err != nil {
+		return 0, err
+	}
+
+	services := make(map[string]bool, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		services[e.set(string(kv.Key), kv.Value)] = true
+	}
+	for service := range e.services {
+		if !services[service] {
+			e.router.Reset(service)
+		}
+	}
+	e.services = services
+	return resp.Header.Revision, nil
+}
+
+func (e *etcdRules) watch(ctx context.Context, rev int64) {
+	for {
+		wc := e.client.Watch(clientv3.WithRequireLeader(ctx), e.prefix, clientv3.WithPrefix(), clientv3.WithRev(rev+1))
+		for resp := range wc {
+			if resp.CompactRevision > rev || resp.Err() != nil {
+				break
+			}
+			for _, event := range resp.Events {
+				rev = event.Kv.ModRevision
+				key := string(event.Kv.Key)
+				switch event.Type {
+				case clientv3.EventTypePut:
+					e.services[e.set(key, event.Kv.Value)] = true
+				case clientv3.EventTypeDelete:
+					service := strings.TrimPrefix(key, e.prefix)
+					delete(e.services, service)
+					e.router.Reset(service)
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(rulesRewatchInterval):
+		}
+
+		// 断线或 compaction 后全量同步
+		if r, err := e.load(ctx); err == nil {
+			rev = r
+		}
+	}
+}
+
+// set 更新服务的规则, 规则错误时保留旧规则
+func (e *etcdRules) set(key string, value []byte) string {
+	service := strings.TrimPrefix(key, e.prefix)
+
+	var rule Rule
+	if err := json.Unmarshal(value, &rule); err != nil {
+		log.Printf("selector: invalid rule key:%v error:%v", key, err)
+		return service
+	}
+	if err := e.router.Set(service, &rule); err != nil {
+		log.Printf("selector: invalid rule key:%v error:%v", key, err)
+	}
+	return service
+}
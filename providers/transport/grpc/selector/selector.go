@@ -34,6 +34,10 @@ type Filter func([]*registry.Service) []*registry.Service
 // Strategy is a selection strategy e.g random, round robin
 type Strategy func([]*registry.Service) Next
 
+// HashStrategy is a consistent hashing strategy e.g ring hash, maglev,
+// the key comes from the select options of the request
+type HashStrategy func(key string, services []*registry.Service) Next
+
 var (
 	DefaultSelector = newDefaultSelector()
 
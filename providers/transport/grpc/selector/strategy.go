@@ -1,14 +1,24 @@
 package selector
 
 import (
-	registry "github.com/aka-yz/go-micro-core/register"
+	"fmt"
 	"math/rand"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	registry "github.com/aka-yz/go-micro-core/register"
 )
 
 // Select strategy .....
 
+// WeightKey 节点权重的 metadata key
+const WeightKey = "weight"
+
+// DefaultWeight 没有设置或设置错误时的节点权重
+const DefaultWeight = 100
+
 func init() {
 	rand.Seed(time.Now().UnixNano())
 }
@@ -31,27 +41,219 @@ func Random(services []*registry.Service) Next {
 	}
 }
 
-// RoundRobin is a roundrobin strategy algorithm for node selection
+// RoundRobin is a roundrobin strategy algorithm for node selection,
+// the position is kept only within the returned Next, see NewRoundRobin
 func RoundRobin(services []*registry.Service) Next {
-	var nodes []*registry.Node
+	nodes := flatten(services)
 
-	for _, service := range services {
-		nodes = append(nodes, service.Nodes...)
+	var i = uint64(rand.Int())
+	return roundRobin(nodes, &i)
+}
+
+// NewRoundRobin returns a round robin strategy which keeps the position of each
+// service across Select calls, every selector should have its own instance
+func NewRoundRobin() Strategy {
+	// counters service name -> 轮询计数
+	var counters sync.Map
+	return func(services []*registry.Service) Next {
+		nodes := flatten(services)
+
+		counter := new(uint64)
+		if len(services) > 0 {
+			v, _ := counters.LoadOrStore(services[0].Name, counter)
+			counter = v.(*uint64)
+		}
+		return roundRobin(nodes, counter)
+	}
+}
+
+func roundRobin(nodes []*registry.Node, counter *uint64) Next {
+	return func() (*registry.Node, error) {
+		if len(nodes) == 0 {
+			return nil, ErrNoneAvailable
+		}
+
+		i := atomic.AddUint64(counter, 1)
+		return nodes[i%uint64(len(nodes))], nil
 	}
+}
 
-	var i = rand.Int()
-	var mtx sync.Mutex
+// WeightedRandom selects nodes randomly in proportion to their weight metadata
+func WeightedRandom(services []*registry.Service) Next {
+	nodes := flatten(services)
 
+	weights := make([]int, len(nodes))
+	var total int
+	for i, node := range nodes {
+		total += nodeWeight(node)
+		weights[i] = total
+	}
+
+	return func() (*registry.Node, error) {
+		if len(nodes) == 0 {
+			return nil, ErrNoneAvailable
+		}
+
+		r := rand.Intn(total)
+		for i, w := range weights {
+			if r < w {
+				return nodes[i], nil
+			}
+		}
+		return nodes[len(nodes)-1], nil
+	}
+}
+
+// wrrState 平滑加权轮询的当前权重, node id -> current weight
+type wrrState struct {
+	sync.Mutex
+	current map[string]int
+}
+
+// NewWeightedRoundRobin returns a smooth weighted round robin (as nginx) strategy
+// by weight metadata, every selector should have its own instance
+func NewWeightedRoundRobin() Strategy {
+	// states service name -> *wrrState
+	var states sync.Map
+	return func(services []*registry.Service) Next {
+		state := &wrrState{current: make(map[string]int)}
+		if len(services) > 0 {
+			v, _ := states.LoadOrStore(services[0].Name, state)
+			state = v.(*wrrState)
+		}
+		return weightedRoundRobin(flatten(services), state)
+	}
+}
+
+func weightedRoundRobin(nodes []*registry.Node, state *wrrState) Next {
 	return func() (*registry.Node, error) {
 		if len(nodes) == 0 {
 			return nil, ErrNoneAvailable
 		}
 
-		mtx.Lock()
-		node := nodes[i%len(nodes)]
-		i++
-		mtx.Unlock()
+		state.Lock()
+		defer state.Unlock()
 
-		return node, nil
+		// 节点列表变化后丢弃已下线节点的状态
+		if len(state.current) > len(nodes) {
+			current := make(map[string]int, len(nodes))
+			for _, node := range nodes {
+				current[node.Id] = state.current[node.Id]
+			}
+			state.current = current
+		}
+
+		var best *registry.Node
+		var total int
+		for _, node := range nodes {
+			w := nodeWeight(node)
+			total += w
+			state.current[node.Id] += w
+			if best == nil || state.current[node.Id] > state.current[best.Id] {
+				best = node
+			}
+		}
+		state.current[best.Id] -= total
+		return best, nil
+	}
+}
+
+// LeastOutstanding selects the node with the fewest in-flight requests, see Track
+func LeastOutstanding(services []*registry.Service) Next {
+	nodes := flatten(services)
+
+	return func() (*registry.Node, error) {
+		if len(nodes) == 0 {
+			return nil, ErrNoneAvailable
+		}
+
+		// 从随机位置开始, 请求数相同的节点之间随机
+		offset := rand.Intn(len(nodes))
+		var best *registry.Node
+		var min int64
+		for i := range nodes {
+			node := nodes[(offset+i)%len(nodes)]
+			if n := loadOf(node).outstanding(); best == nil || n < min {
+				best, min = node, n
+			}
+		}
+		return best, nil
+	}
+}
+
+// P2C picks two random nodes and selects the one with the lower
+// EWMA latency weighted by its in-flight requests, see Track
+func P2C(services []*registry.Service) Next {
+	nodes := flatten(services)
+
+	return func() (*registry.Node, error) {
+		switch len(nodes) {
+		case 0:
+			return nil, ErrNoneAvailable
+		case 1:
+			return nodes[0], nil
+		}
+
+		i := rand.Intn(len(nodes))
+		j := rand.Intn(len(nodes) - 1)
+		if j >= i {
+			j++
+		}
+		a, b := nodes[i], nodes[j]
+		if loadOf(b).score() < loadOf(a).score() {
+			return b, nil
+		}
+		return a, nil
+	}
+}
+
+func stateless(s Strategy) func() Strategy {
+	return func() Strategy { return s }
+}
+
+// 可以在 yaml 中按名称选择的策略, 有状态的策略每次 Named 创建新的实例
+var (
+	strategies = map[string]func() Strategy{
+		"random":               stateless(Random),
+		"round_robin":          NewRoundRobin,
+		"weighted_random":      stateless(WeightedRandom),
+		"weighted_round_robin": NewWeightedRoundRobin,
+		"least_outstanding":    stateless(LeastOutstanding),
+		"p2c_ewma":             stateless(P2C),
+	}
+	hashStrategies = map[string]HashStrategy{
+		"ring_hash": RingHash,
+		"maglev":    Maglev,
+	}
+)
+
+// Named returns the option which sets the strategy by name, hash strategies
+// fall back to the default strategy when the request has no hash key
+func Named(name string) (Option, error) {
+	if s, ok := strategies[name]; ok {
+		return SetStrategy(s()), nil
+	}
+	if h, ok := hashStrategies[name]; ok {
+		return SetHashStrategy(h), nil
+	}
+	return nil, fmt.Errorf("selector strategy:%v not found", name)
+}
+
+func flatten(services []*registry.Service) []*registry.Node {
+	var nodes []*registry.Node
+	for _, service := range services {
+		nodes = append(nodes, service.Nodes...)
+	}
+	return nodes
+}
+
+func nodeWeight(node *registry.Node) int {
+	if node.Metadata == nil {
+		return DefaultWeight
+	}
+	w, err := strconv.Atoi(node.Metadata[WeightKey])
+	if err != nil || w <= 0 {
+		return DefaultWeight
 	}
+	return w
 }
@@ -0,0 +1,109 @@
+package selector
+
+import (
+	"fmt"
+	"testing"
+
+	registry "github.com/aka-yz/go-micro-core/register"
+)
+
+func testServices(name string, weights ...int) []*registry.Service {
+	service := &registry.Service{Name: name, Version: "v1"}
+	for i, w := range weights {
+		service.Nodes = append(service.Nodes, &registry.Node{
+			Id:       fmt.Sprintf("%s-%d", name, i),
+			Address:  "127.0.0.1",
+			Port:     8000 + i,
+			Metadata: map[string]string{WeightKey: fmt.Sprint(w)},
+		})
+	}
+	return []*registry.Service{service}
+}
+
+func count(t *testing.T, strategy Strategy, services []*registry.Service, n int) map[string]int {
+	counts := make(map[string]int)
+	for i := 0; i < n; i++ {
+		// 每次调用都重新构建 Next, 和 balancer 的用法一致
+		node, err := strategy(services)()
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts[node.Id]++
+	}
+	return counts
+}
+
+func TestRoundRobin(t *testing.T) {
+	services := testServices("rr", 1, 1, 1)
+	rr := NewRoundRobin()
+	counts := count(t, rr, services, 30)
+	for _, node := range services[0].Nodes {
+		if counts[node.Id] != 10 {
+			t.Fatalf("unexpected counts %v", counts)
+		}
+	}
+
+	// 不同的实例(不同的 client)不共享同名服务的计数
+	other := testServices("rr", 1, 1)
+	if counts := count(t, NewRoundRobin(), other, 4); counts["rr-0"] != 2 || counts["rr-1"] != 2 {
+		t.Fatalf("unexpected counts %v", counts)
+	}
+	if counts = count(t, rr, services, 3); len(counts) != 3 {
+		t.Fatalf("unexpected counts %v", counts)
+	}
+}
+
+func TestWeightedRoundRobin(t *testing.T) {
+	services := testServices("wrr", 100, 300)
+	counts := count(t, NewWeightedRoundRobin(), services, 40)
+	if counts["wrr-0"] != 10 || counts["wrr-1"] != 30 {
+		t.Fatalf("unexpected counts %v", counts)
+	}
+}
+
+func TestLeastOutstanding(t *testing.T) {
+	services := testServices("lo", 1, 1)
+	done := Track(services[0].Nodes[0])
+	defer done()
+
+	counts := count(t, LeastOutstanding, services, 10)
+	if counts["lo-1"] != 10 {
+		t.Fatalf("unexpected counts %v", counts)
+	}
+}
+
+func TestHash(t *testing.T) {
+	for name, hash := range map[string]HashStrategy{"ring_hash": RingHash, "maglev": Maglev} {
+		services := testServices(name, 100, 100, 100, 100)
+		less := testServices(name, 100, 100, 100)
+
+		var moved int
+		for i := 0; i < 100; i++ {
+			key := fmt.Sprint("user-", i)
+			a, _ := hash(key, services)()
+			b, _ := hash(key, services)()
+			if a.Id != b.Id {
+				t.Fatalf("%s: key %s not sticky", name, key)
+			}
+			// 去掉一个节点后, 其余节点上的 key 不应该迁移
+			c, _ := hash(key, less)()
+			if a.Id != name+"-3" && a.Id != c.Id {
+				moved++
+			}
+		}
+		if moved > 0 {
+			t.Fatalf("%s: %d keys moved", name, moved)
+		}
+	}
+}
+
+func TestNamed(t *testing.T) {
+	for name := range strategies {
+		if _, err := Named(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := Named("unknown"); err == nil {
+		t.Fatal("expected error")
+	}
+}
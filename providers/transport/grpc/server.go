@@ -1,32 +1,56 @@
 package grpc
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
 	go_micro_core "github.com/aka-yz/go-micro-core"
+	"github.com/aka-yz/go-micro-core/providers/transport/auth"
+	"github.com/aka-yz/go-micro-core/providers/transport/discovery"
 	grpc_interceptors "github.com/aka-yz/go-micro-core/providers/transport/grpc/interceptors"
+	"github.com/aka-yz/go-micro-core/providers/transport/ratelimit"
+	"github.com/aka-yz/go-micro-core/providers/transport/tlsconfig"
 	registry "github.com/aka-yz/go-micro-core/register"
-	"github.com/aka-yz/go-micro-core/register/etcdv3"
 	"github.com/aka-yz/go-micro-core/utils/json"
 	netutils "github.com/aka-yz/go-micro-core/utils/net"
 	middleware "github.com/grpc-ecosystem/go-grpc-middleware"
 	recovery "github.com/grpc-ecosystem/go-grpc-middleware/recovery"
 	"go.uber.org/config"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/reflection"
 	"log"
 	"net"
 	"os"
-	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type serverFactory struct{}
 
 func (s *serverFactory) NewProvider(conf config.Provider) go_micro_core.Provider {
-	if cfg := getServerConfig(conf); cfg != nil {
-		return go_micro_core.NewProvider(
-			reflectRPCServer(newRPCServer(cfg)))
+	cfg, err := getServerConfig(conf)
+	if err != nil {
+		log.Printf("rpcserver config error:%v", err)
+		return nil
+	}
+	if cfg != nil {
+		s, err := newRPCServer(cfg)
+		if err != nil {
+			log.Printf("rpcserver config error:%v", err)
+			if cfg.Auth != nil {
+				cfg.Auth.Close()
+			}
+			return nil
+		}
+		if cfg.Reflection {
+			s = reflectRPCServer(s)
+		}
+		return go_micro_core.NewProvider(s)
 	}
 	return nil
 }
@@ -36,81 +60,133 @@ func reflectRPCServer(s *RPCServer) *RPCServer {
 	return s
 }
 
-func newRPCServer(cfg *serverConfig) *RPCServer {
+func newRPCServer(cfg *serverConfig) (*RPCServer, error) {
 	interceptors := []grpc.UnaryServerInterceptor{
+		grpc_interceptors.DeadlineUnaryServerInterceptor(),
 		grpc_interceptors.UnaryServerInterceptor(),
 		recovery.UnaryServerInterceptor(),
 	}
 
-	if cfg.Metadata == "gin" {
-		interceptors = append(interceptors, grpc_interceptors.GinUnaryServerInterceptor())
+	streamInterceptors := []grpc.StreamServerInterceptor{
+		grpc_interceptors.DeadlineStreamServerInterceptor(),
+		// StreamServerInterceptor 已经处理 panic
+		grpc_interceptors.StreamServerInterceptor(),
+	}
+
+	if cfg.Auth != nil {
+		interceptors = append(interceptors, grpc_interceptors.AuthUnaryServerInterceptor(cfg.Auth))
+		streamInterceptors = append(streamInterceptors, grpc_interceptors.AuthStreamServerInterceptor(cfg.Auth))
+	}
+
+	if cfg.Admission != nil {
+		admission := ratelimit.NewAdmission(*cfg.Admission)
+		interceptors = append(interceptors, grpc_interceptors.AdmissionUnaryServerInterceptor(admission))
+		streamInterceptors = append(streamInterceptors, grpc_interceptors.AdmissionStreamServerInterceptor(admission))
+	}
+
+	// 按名称启用的拦截器(包括 gin metadata)在认证之后, 认证的调用方随 metadata 传递给下游
+	unary, stream, err := namedServerInterceptors(cfg.Interceptors)
+	if err != nil {
+		return nil, err
+	}
+	interceptors = append(interceptors, unary...)
+	streamInterceptors = append(streamInterceptors, stream...)
+
+	// 证书在 registry 之前加载, 出错时不需要释放 registry
+	var reloader *tlsconfig.Reloader
+	var tlsConfig *tls.Config
+	var creds credentials.TransportCredentials
+	if cfg.TLS != nil {
+		if reloader, err = tlsconfig.NewReloader(*cfg.TLS); err != nil {
+			return nil, fmt.Errorf("tls config error:%v", err)
+		}
+		if tlsConfig, err = reloader.ServerConfig(); err != nil {
+			reloader.Close()
+			return nil, fmt.Errorf("tls config error:%v", err)
+		}
+		creds = credentials.NewTLS(tlsConfig)
 	}
 
 	var register registry.Registry
 	if cfg.Registry != nil {
-		register = etcdv3.NewRegistry(
-			registry.Addrs(cfg.Registry.Addrs...),
-			registry.Timeout(time.Second*time.Duration(cfg.Registry.RegistryTTL)),
-		)
+		var err error
+		if register, err = discovery.NewRegistry(cfg.Registry); err != nil {
+			if reloader != nil {
+				reloader.Close()
+			}
+			return nil, err
+		}
 	}
 
-	server := NewServer(
+	options := []ServerOption{
 		Addr(cfg.Addr),
+		Listen(cfg.Listen...),
+		Advertise(cfg.Advertise),
+		Interfaces(cfg.Interfaces...),
 		Service(cfg.Service),
 		Registry(register),
-		GRPCServerOption(
-			grpc.UnaryInterceptor(middleware.ChainUnaryServer(interceptors...)),
-		),
-	)
-
-	return server
-}
-
-type serverConfig struct {
-	Addr     string
-	Metadata string
-	Registry *registryConfig
-	Service  *registry.Service
-}
-
-func getServerConfig(conf config.Provider) *serverConfig {
-	var cv config.Value
-	if cv = conf.Get("rpcserver"); !cv.HasValue() {
-		return nil
+		UnaryInterceptor(interceptors...),
+		StreamInterceptor(streamInterceptors...),
+	}
+	if cfg.Options != nil {
+		options = append(options, MaxRecvMsgSize(cfg.Options.MaxRecvMsgSize), GRPCServerOption(cfg.Options.serverOptions()...))
+	}
+	if sd := cfg.Shutdown; sd != nil {
+		options = append(options,
+			DrainDelay(time.Second*time.Duration(sd.Delay)),
+			ShutdownTimeout(time.Second*time.Duration(sd.Timeout)))
 	}
 
-	addrMap := make(map[string]string)
-	if err := cv.Populate(&addrMap); err != nil {
-		return nil
+	if creds != nil {
+		options = append(options, Credentials(creds))
 	}
 
-	var cfg serverConfig
-	cfg.Addr = port(addrMap["addr"])
-	cfg.Metadata = addrMap["metadata"]
-	cfg.Registry = getRegistryConfig(conf)
-	cfg.Service = getRegistryService(conf, "-rpc")
-	return &cfg
+	s := NewServer(options...)
+	s.ownRegistry = true
+	s.reloader = reloader
+	s.tlsConfig = tlsConfig
+	s.auth = cfg.Auth
+	return s, nil
 }
 
-func port(addr string) string {
-	port := os.Getenv("PORT_" + addr)
-	if port != "" {
-		return ":" + port
-	}
+// DefaultShutdownTimeout GracefulStop 默认的最长等待时间
+const DefaultShutdownTimeout = time.Second * 30
 
-	port = os.Getenv("PORT")
-	if port != "" {
-		return ":" + port
-	}
+// DefaultMaxRecvMsgSize 与 grpc 默认的接收消息上限相同
+const DefaultMaxRecvMsgSize = 1024 * 1024 * 4
 
-	return addr
-}
+// healthMethodPrefix 健康检查服务的方法前缀
+var healthMethodPrefix = "/" + healthpb.Health_ServiceDesc.ServiceName + "/"
 
 // RPCServer 启动服务
 // 注册registry
 type RPCServer struct {
 	*grpc.Server
-	opts ServerOptions
+	opts   ServerOptions
+	health *health.Server
+	// inflight 正在处理的请求数, 包括流
+	inflight int64
+	// listeners Start 时创建的监听
+	listeners []net.Listener
+	// external 不为空时由其他 server 在该地址上通过 ServeHTTP 提供服务
+	external net.Addr
+	// ownRegistry registry 由 newRPCServer 创建, Stop 时一起释放
+	ownRegistry bool
+	// reloader 不为空时 Stop 后不再重新加载证书
+	reloader *tlsconfig.Reloader
+	// auth 与 http server 共用, Stop 时释放
+	auth *auth.Auth
+	// tlsConfig rpcserver.tls 的配置, ServeExternal 时由外部的 server 终止 tls
+	tlsConfig *tls.Config
+	// endpoints 注册时加入的其他协议的 endpoint, 见 AddEndpoints
+	endpoints []func(port int) []*registry.Endpoint
+
+	// stop 注销前关闭, 之后不再注册
+	stop     chan struct{}
+	stopOnce sync.Once
+	// registered 最近一次注册的 service, 由 opts.service 复制, 不修改共享的配置
+	mu         sync.Mutex
+	registered *registry.Service
 }
 
 func NewServer(opts ...ServerOption) *RPCServer {
@@ -119,58 +195,262 @@ func NewServer(opts ...ServerOption) *RPCServer {
 		o(&opt)
 	}
 
+	if opt.shutdownTimeout <= 0 {
+		opt.shutdownTimeout = DefaultShutdownTimeout
+	}
+	if opt.maxRecvMsgSize <= 0 {
+		opt.maxRecvMsgSize = DefaultMaxRecvMsgSize
+	}
+
 	rs := &RPCServer{
 		opts:   opt,
-		Server: grpc.NewServer(opt.serverOptions...),
+		health: health.NewServer(),
+		stop:   make(chan struct{}),
 	}
 
-	//hs := health.NewServer()
-	//proto.RegisterHealthServer(rs.Server, hs)
+	serverOptions := append([]grpc.ServerOption{grpc.MaxRecvMsgSize(opt.maxRecvMsgSize)}, opt.serverOptions...)
+	if opt.creds != nil {
+		serverOptions = append(serverOptions, grpc.Creds(opt.creds))
+	}
+	// 计数在最前, 统计退出时被中断的请求
+	serverOptions = append(serverOptions,
+		grpc.ChainUnaryInterceptor(append([]grpc.UnaryServerInterceptor{rs.countUnary}, opt.interceptors...)...),
+		grpc.ChainStreamInterceptor(append([]grpc.StreamServerInterceptor{rs.countStream}, opt.streamInterceptors...)...))
+
+	rs.Server = grpc.NewServer(serverOptions...)
+	healthpb.RegisterHealthServer(rs.Server, rs.health)
 	return rs
 }
 
-// Start 启动服务
+// UnaryInterceptor 与 server 相同的 unary 拦截器链, 用于进程内的调用, 如 gin 的 Gateway
+func (s *RPCServer) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return middleware.ChainUnaryServer(append([]grpc.UnaryServerInterceptor{s.countUnary}, s.opts.interceptors...)...)
+}
+
+// MaxRecvMsgSize 接收消息的上限, 与 gin.WithMaxBodySize 一起限制 Gateway 请求 body 的大小
+func (s *RPCServer) MaxRecvMsgSize() int {
+	return s.opts.maxRecvMsgSize
+}
+
+// TLSConfig rpcserver.tls 的 server 配置, 没有配置 tls 时为 nil
+func (s *RPCServer) TLSConfig() *tls.Config {
+	return s.tlsConfig
+}
+
+// Health 健康检查服务, 可以设置每个服务的状态, 退出时全部置为 NOT_SERVING
+func (s *RPCServer) Health() *health.Server {
+	return s.health
+}
+
+func (s *RPCServer) countUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	atomic.AddInt64(&s.inflight, 1)
+	defer atomic.AddInt64(&s.inflight, -1)
+	return handler(ctx, req)
+}
+
+func (s *RPCServer) countStream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	// 健康检查的 Watch 会一直持续到退出, 不计入正在处理的请求
+	if strings.HasPrefix(info.FullMethod, healthMethodPrefix) {
+		return handler(srv, ss)
+	}
+	atomic.AddInt64(&s.inflight, 1)
+	defer atomic.AddInt64(&s.inflight, -1)
+	return handler(srv, ss)
+}
+
+// ServeExternal Start 时不监听, 由 addr 上的其他 server(如单端口的 mux)通过 ServeHTTP
+// 提供服务, 注册时使用 addr 的端口. 需要在 Start 之前调用
+func (s *RPCServer) ServeExternal(addr net.Addr) {
+	s.external = addr
+}
+
+// AddEndpoints 注册时加入 f 返回的 endpoint, 如 mux 端口上 http 的路由, 同一端口只注册一次.
+// 需要在 Start 之前调用
+func (s *RPCServer) AddEndpoints(f func(port int) []*registry.Endpoint) {
+	s.endpoints = append(s.endpoints, f)
+}
+
+// Start 监听 addr 和 listens 中的地址, 注册 advertise 地址
 func (s *RPCServer) Start() {
-	ip, ls, err := netutils.ListenAddr(s.opts.addr, func(addr string) (net.Listener, error) {
-		return net.Listen("tcp", s.opts.addr)
-	})
-	if err != nil {
-		panic(err)
+	if s.external != nil {
+		log.Println("RPCServer served on:", s.external.Network(), s.external)
+		go s.register()
+		return
 	}
 
-	s.opts.addr = ip + s.opts.addr
-	log.Println("RPCServer listen on:", s.opts.addr)
-	go s.Serve(ls)
+	addrs := s.opts.listens
+	if s.opts.addr != "" || len(addrs) == 0 {
+		addrs = append([]string{s.opts.addr}, addrs...)
+	}
+	for _, addr := range addrs {
+		ls, err := listen(addr)
+		if err != nil {
+			panic(fmt.Errorf("RPCServer listen on:%v error:%v", addr, err))
+		}
+		s.listeners = append(s.listeners, ls)
+		log.Println("RPCServer listen on:", ls.Addr().Network(), ls.Addr())
+		go s.Serve(ls)
+	}
 	go s.register()
 }
 
+func listen(addr string) (net.Listener, error) {
+	network, address := netutils.ParseAddr(addr)
+	if network == "unix" {
+		// 删除上次没有正常退出留下的 socket 文件
+		if fi, err := os.Stat(address); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			_ = os.Remove(address)
+		}
+		return net.Listen(network, address)
+	}
+	return netutils.Listen(address, func(addr string) (net.Listener, error) {
+		return net.Listen(network, addr)
+	})
+}
+
+// Addrs 监听的地址, Start 之后有效
+func (s *RPCServer) Addrs() []net.Addr {
+	if s.external != nil {
+		return []net.Addr{s.external}
+	}
+	addrs := make([]net.Addr, 0, len(s.listeners))
+	for _, ls := range s.listeners {
+		addrs = append(addrs, ls.Addr())
+	}
+	return addrs
+}
+
+// advertiseAddr 注册的 host 和 port, 只有 unix socket 且没有配置 advertise 时不注册
+func (s *RPCServer) advertiseAddr() (string, int, error) {
+	return netutils.AdvertiseAddr(s.opts.advertise, s.opts.interfaces, s.Addrs()...)
+}
+
 func (s *RPCServer) register() {
 	if s.opts.registry == nil {
 		return
 	}
-	addr := strings.Split(s.opts.addr, ":")
-	if len(addr) != 2 {
-		panic(fmt.Errorf("error register addr:%v", addr))
+	host, port, err := s.advertiseAddr()
+	if err != nil {
+		log.Printf("RPCServer register skipped, advertise address error:%v", err)
+		return
 	}
-	port, _ := strconv.Atoi(addr[1])
-	s.opts.service.Nodes[0].Address = addr[0]
-	s.opts.service.Nodes[0].Port = port
+	base := registry.CopyService(s.opts.service)
+	base.Nodes[0].Address = host
+	base.Nodes[0].Port = port
 
 	for {
-		if err := s.opts.registry.Register(s.opts.service); err == nil {
-			log.Println("RPC Server register:", json.MustString(s.opts.service))
+		select {
+		case <-s.stop:
+			return
+		default:
+		}
+		service := registry.CopyService(base)
+		service.Endpoints = serviceEndpoints(s.Server, port)
+		for _, f := range s.endpoints {
+			service.Endpoints = append(service.Endpoints, f(port)...)
+		}
+		s.mu.Lock()
+		s.registered = service
+		s.mu.Unlock()
+		// Register 可能阻塞, 不持锁调用, 返回后再检查是否已经注销
+		err := s.opts.registry.Register(service)
+		select {
+		case <-s.stop:
+			// 注册可能晚于 Stop 中的注销生效, 再注销一次
+			if err == nil {
+				s.opts.registry.Deregister(service)
+			}
+			return
+		default:
+		}
+		if err == nil {
+			log.Println("RPC Server register:", json.MustString(service))
 		}
 
-		time.Sleep(time.Second * 15)
+		select {
+		case <-s.stop:
+			return
+		case <-time.After(time.Second * 15):
+		}
 	}
 }
 
+// Stop 先注销并等待 drainDelay, 健康检查置为 NOT_SERVING 后 GracefulStop,
+// 超过 shutdownTimeout 时 Stop 中断剩余的请求
 func (s *RPCServer) Stop() {
-	s.Server.GracefulStop()
+	s.stopOnce.Do(s.shutdown)
+}
+
+func (s *RPCServer) shutdown() {
+	s.deregister()
+	if s.opts.drainDelay > 0 {
+		log.Printf("RPCServer draining for %v", s.opts.drainDelay)
+		time.Sleep(s.opts.drainDelay)
+	}
+	s.health.Shutdown()
+
+	done, cut := make(chan struct{}), make(chan struct{})
+	go func() {
+		if s.external != nil {
+			// ServeHTTP 的连接不支持 GracefulStop 的 Drain, 等待请求结束后 Stop
+			s.waitInflight(cut)
+			s.Server.Stop()
+		} else {
+			s.Server.GracefulStop()
+		}
+		close(done)
+	}()
+
+	timer := time.NewTimer(s.opts.shutdownTimeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+		log.Println("RPCServer graceful stopped")
+	case <-timer.C:
+		log.Printf("RPCServer graceful stop timeout after %v, %d in-flight rpcs cut",
+			s.opts.shutdownTimeout, atomic.LoadInt64(&s.inflight))
+		close(cut)
+		s.Server.Stop()
+		<-done
+	}
+	if s.ownRegistry {
+		registry.Stop(s.opts.registry)
+	}
+	if s.reloader != nil {
+		s.reloader.Close()
+	}
+	if s.auth != nil {
+		s.auth.Close()
+	}
+}
+
+// waitInflight 等待正在处理的请求结束, 超时关闭 cut 时不再等待
+func (s *RPCServer) waitInflight(cut <-chan struct{}) {
+	ticker := time.NewTicker(time.Millisecond * 50)
+	defer ticker.Stop()
+	for atomic.LoadInt64(&s.inflight) > 0 {
+		select {
+		case <-ticker.C:
+		case <-cut:
+			return
+		}
+	}
+}
+
+func (s *RPCServer) deregister() {
+	// 先关闭 stop, register 在 Register 返回后能看到并补一次注销
+	close(s.stop)
 	if s.opts.registry == nil {
 		return
 	}
-	if err := s.opts.registry.Deregister(s.opts.service); err != nil {
-		log.Printf("Deregister failed service:%v error:%v", json.MustString(s.opts.service), err)
+	s.mu.Lock()
+	service := s.registered
+	s.mu.Unlock()
+	if service == nil {
+		// 还没有注册过
+		return
+	}
+	if err := s.opts.registry.Deregister(service); err != nil {
+		log.Printf("Deregister failed service:%v error:%v", json.MustString(service), err)
 	}
 }
@@ -0,0 +1,263 @@
+package grpc
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aka-yz/go-micro-core/providers/transport/auth"
+	"github.com/aka-yz/go-micro-core/providers/transport/discovery"
+	"github.com/aka-yz/go-micro-core/providers/transport/grpc/interceptors"
+	"github.com/aka-yz/go-micro-core/providers/transport/ratelimit"
+	"github.com/aka-yz/go-micro-core/providers/transport/tlsconfig"
+	registry "github.com/aka-yz/go-micro-core/register"
+	"go.uber.org/config"
+	"google.golang.org/grpc"
+	// 注册 gzip, 客户端使用 grpc.UseCompressor("gzip") 时响应同样使用 gzip
+	_ "google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/keepalive"
+)
+
+// serverConfig rpcserver 配置
+type serverConfig struct {
+	Addr string
+	// Listen addr 之外的监听地址, 支持 ipv6 和 unix socket, 如 "[::]:9001", "unix:///tmp/user.sock"
+	Listen []string
+	// Advertise 注册的地址, host 或 host:port, 为空时从 Interfaces(默认所有网卡)中选择本机 ip
+	Advertise  string
+	Interfaces []string
+	Metadata   string
+	// TLS 不为空时使用 tls, ClientAuth 开启 mTLS
+	TLS *tlsconfig.Config
+	// Auth 来自 auth 配置, 与 http server 共用
+	Auth *auth.Auth
+	// Admission 限流和过载保护, 在认证之后
+	Admission *ratelimit.AdmissionConfig
+	// Shutdown 优雅退出的配置
+	Shutdown *shutdownConfig
+	// Options grpc server 的参数
+	Options *serverOptionsConfig
+	// Reflection 是否注册 reflection 服务, 默认注册, 配置 reflection: false 关闭
+	Reflection bool
+	// Interceptors 按名称启用的拦截器, 在内置拦截器之后, 见 RegisterServerInterceptor
+	Interceptors []string
+	Registry     *discovery.Config
+	Service      *registry.Service
+}
+
+// shutdownConfig Delay 注销后的等待时间, Timeout GracefulStop 的最长等待时间, 单位为秒
+type shutdownConfig struct {
+	Delay   int
+	Timeout int
+}
+
+// serverOptionsConfig 大小单位为字节, 时间单位为秒, 0 使用 grpc 的默认值
+type serverOptionsConfig struct {
+	MaxRecvMsgSize       int
+	MaxSendMsgSize       int
+	MaxConcurrentStreams int
+	ConnectionTimeout    int
+	Keepalive            *keepaliveConfig
+}
+
+type keepaliveConfig struct {
+	MaxConnectionIdle     int
+	MaxConnectionAge      int
+	MaxConnectionAgeGrace int
+	Time                  int
+	Timeout               int
+	// Enforcement 客户端 keepalive 的限制, 违反时关闭连接
+	Enforcement *enforcementConfig
+}
+
+type enforcementConfig struct {
+	MinTime             int
+	PermitWithoutStream bool
+}
+
+func (c *serverOptionsConfig) validate() error {
+	if c.MaxRecvMsgSize < 0 || c.MaxSendMsgSize < 0 {
+		return fmt.Errorf("negative message size")
+	}
+	if c.MaxConcurrentStreams < 0 || int64(c.MaxConcurrentStreams) > int64(^uint32(0)) {
+		return fmt.Errorf("maxconcurrentstreams out of range:%v", c.MaxConcurrentStreams)
+	}
+	if c.ConnectionTimeout < 0 {
+		return fmt.Errorf("negative connectiontimeout")
+	}
+	if k := c.Keepalive; k != nil {
+		if k.MaxConnectionIdle < 0 || k.MaxConnectionAge < 0 || k.MaxConnectionAgeGrace < 0 || k.Time < 0 || k.Timeout < 0 {
+			return fmt.Errorf("negative keepalive duration")
+		}
+		if e := k.Enforcement; e != nil && e.MinTime < 0 {
+			return fmt.Errorf("negative keepalive enforcement mintime")
+		}
+	}
+	return nil
+}
+
+func (c *serverOptionsConfig) serverOptions() []grpc.ServerOption {
+	var opts []grpc.ServerOption
+	if c.MaxSendMsgSize > 0 {
+		opts = append(opts, grpc.MaxSendMsgSize(c.MaxSendMsgSize))
+	}
+	if c.MaxConcurrentStreams > 0 {
+		opts = append(opts, grpc.MaxConcurrentStreams(uint32(c.MaxConcurrentStreams)))
+	}
+	if c.ConnectionTimeout > 0 {
+		opts = append(opts, grpc.ConnectionTimeout(seconds(c.ConnectionTimeout)))
+	}
+	if k := c.Keepalive; k != nil {
+		opts = append(opts, grpc.KeepaliveParams(keepalive.ServerParameters{
+			MaxConnectionIdle:     seconds(k.MaxConnectionIdle),
+			MaxConnectionAge:      seconds(k.MaxConnectionAge),
+			MaxConnectionAgeGrace: seconds(k.MaxConnectionAgeGrace),
+			Time:                  seconds(k.Time),
+			Timeout:               seconds(k.Timeout),
+		}))
+		if e := k.Enforcement; e != nil {
+			opts = append(opts, grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+				MinTime:             seconds(e.MinTime),
+				PermitWithoutStream: e.PermitWithoutStream,
+			}))
+		}
+	}
+	return opts
+}
+
+// seconds 0 保持 grpc 的默认值
+func seconds(s int) time.Duration {
+	return time.Second * time.Duration(s)
+}
+
+type namedServerInterceptor struct {
+	unary  grpc.UnaryServerInterceptor
+	stream grpc.StreamServerInterceptor
+}
+
+// 可以在 yaml 中按名称启用的拦截器
+var (
+	serverInterceptorsMu sync.RWMutex
+	serverInterceptors   = map[string]namedServerInterceptor{
+		"gin": {interceptors.GinUnaryServerInterceptor(), interceptors.GinStreamServerInterceptor()},
+	}
+)
+
+// RegisterServerInterceptor 注册可以在 rpcserver.interceptors 中按名称启用的拦截器,
+// 需要在 Run 之前注册, unary 和 stream 可以为 nil
+func RegisterServerInterceptor(name string, unary grpc.UnaryServerInterceptor, stream grpc.StreamServerInterceptor) {
+	serverInterceptorsMu.Lock()
+	defer serverInterceptorsMu.Unlock()
+	serverInterceptors[name] = namedServerInterceptor{unary, stream}
+}
+
+// namedServerInterceptors 按名称查找拦截器, 重复的名称只启用一次
+func namedServerInterceptors(names []string) ([]grpc.UnaryServerInterceptor, []grpc.StreamServerInterceptor, error) {
+	serverInterceptorsMu.RLock()
+	defer serverInterceptorsMu.RUnlock()
+
+	var unary []grpc.UnaryServerInterceptor
+	var stream []grpc.StreamServerInterceptor
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		i, ok := serverInterceptors[name]
+		if !ok {
+			known := make([]string, 0, len(serverInterceptors))
+			for k := range serverInterceptors {
+				known = append(known, k)
+			}
+			sort.Strings(known)
+			return nil, nil, fmt.Errorf("interceptor:%v not found, registered:%v", name, known)
+		}
+		if i.unary != nil {
+			unary = append(unary, i.unary)
+		}
+		if i.stream != nil {
+			stream = append(stream, i.stream)
+		}
+	}
+	return unary, stream, nil
+}
+
+func getServerConfig(conf config.Provider) (*serverConfig, error) {
+	var cv config.Value
+	if cv = conf.Get("rpcserver"); !cv.HasValue() {
+		return nil, nil
+	}
+
+	raw := struct {
+		Addr         string
+		Listen       []string
+		Advertise    string
+		Interfaces   []string
+		Metadata     string
+		TLS          *tlsconfig.Config
+		Admission    *ratelimit.AdmissionConfig
+		Shutdown     *shutdownConfig
+		Options      *serverOptionsConfig
+		Reflection   *bool
+		Interceptors []string
+	}{}
+	if err := cv.Populate(&raw); err != nil {
+		return nil, err
+	}
+	if raw.Options != nil {
+		if err := raw.Options.validate(); err != nil {
+			return nil, err
+		}
+	}
+	if sd := raw.Shutdown; sd != nil && (sd.Delay < 0 || sd.Timeout < 0) {
+		return nil, fmt.Errorf("negative shutdown duration")
+	}
+	// metadata: gin 与 interceptors: [gin] 相同
+	interceptorNames := raw.Interceptors
+	if raw.Metadata == "gin" {
+		interceptorNames = append([]string{"gin"}, interceptorNames...)
+	}
+	if _, _, err := namedServerInterceptors(interceptorNames); err != nil {
+		return nil, err
+	}
+
+	var cfg serverConfig
+	cfg.Addr = port(raw.Addr)
+	cfg.Listen = raw.Listen
+	cfg.Advertise = raw.Advertise
+	cfg.Interfaces = raw.Interfaces
+	cfg.Metadata = raw.Metadata
+	cfg.TLS = raw.TLS
+	cfg.Admission = raw.Admission
+	cfg.Shutdown = raw.Shutdown
+	cfg.Options = raw.Options
+	cfg.Reflection = raw.Reflection == nil || *raw.Reflection
+	cfg.Interceptors = interceptorNames
+	var err error
+	if cfg.Registry, err = discovery.GetConfig(conf); err != nil {
+		return nil, err
+	}
+	cfg.Service = discovery.NewService(conf, serviceSuffix)
+	// 与 http server 共用同一个 Auth, 最后创建, 之后出错时由调用方 Close
+	if cfg.Auth, err = auth.FromConfig(conf); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+func port(addr string) string {
+	port := os.Getenv("PORT_" + addr)
+	if port != "" {
+		return ":" + port
+	}
+
+	port = os.Getenv("PORT")
+	if port != "" {
+		return ":" + port
+	}
+
+	return addr
+}
@@ -3,14 +3,30 @@ package grpc
 import (
 	registry "github.com/aka-yz/go-micro-core/register"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"time"
 )
 
 type ServerOptions struct {
-	registry      registry.Registry
-	service       *registry.Service
-	addr          string
+	registry registry.Registry
+	service  *registry.Service
+	addr     string
+	// listens addr 之外的监听地址, 如 "[::1]:9001", "unix:///tmp/user.sock"
+	listens []string
+	// advertise 注册的地址, host 或 host:port, 为空时取第一个 tcp 监听地址,
+	// 监听所有网卡时取 interfaces 中(默认所有网卡)的本机 ip
+	advertise     string
+	interfaces    []string
 	serverOptions []grpc.ServerOption
 	interceptors  []grpc.UnaryServerInterceptor
+	// streamInterceptors 与 interceptors 一起在 GRPCServerOption 的拦截器之后执行
+	streamInterceptors []grpc.StreamServerInterceptor
+	creds              credentials.TransportCredentials
+	// maxRecvMsgSize 接收消息的上限, 0 为 DefaultMaxRecvMsgSize
+	maxRecvMsgSize int
+	// drainDelay 注销后等待注册中心传播的时间, shutdownTimeout GracefulStop 的最长等待时间
+	drainDelay      time.Duration
+	shutdownTimeout time.Duration
 }
 
 type ServerOption func(*ServerOptions)
@@ -21,6 +37,19 @@ func UnaryInterceptor(interceptors ...grpc.UnaryServerInterceptor) ServerOption
 	}
 }
 
+func StreamInterceptor(interceptors ...grpc.StreamServerInterceptor) ServerOption {
+	return func(o *ServerOptions) {
+		o.streamInterceptors = interceptors
+	}
+}
+
+// Credentials 传输层凭证, 如 credentials.NewTLS, 默认不加密
+func Credentials(creds credentials.TransportCredentials) ServerOption {
+	return func(o *ServerOptions) {
+		o.creds = creds
+	}
+}
+
 func Registry(registry registry.Registry) ServerOption {
 	return func(o *ServerOptions) {
 		o.registry = registry
@@ -39,8 +68,50 @@ func Addr(addr string) ServerOption {
 	}
 }
 
+// Listen 增加监听地址, 支持 ipv6 和 unix socket, 如 "unix:///tmp/user.sock"
+func Listen(addrs ...string) ServerOption {
+	return func(o *ServerOptions) {
+		o.listens = append(o.listens, addrs...)
+	}
+}
+
+// Advertise 注册到 registry 的地址, host 或 host:port, 没有端口时使用第一个 tcp 监听的端口
+func Advertise(addr string) ServerOption {
+	return func(o *ServerOptions) {
+		o.advertise = addr
+	}
+}
+
+// Interfaces 监听所有网卡且没有 Advertise 时, 从这些网卡中选择注册的 ip
+func Interfaces(names ...string) ServerOption {
+	return func(o *ServerOptions) {
+		o.interfaces = names
+	}
+}
+
+// MaxRecvMsgSize 接收消息的上限, 单位为字节, 同时用于 gin Gateway 限制请求 body, 见 RPCServer.MaxRecvMsgSize
+func MaxRecvMsgSize(n int) ServerOption {
+	return func(o *ServerOptions) {
+		o.maxRecvMsgSize = n
+	}
+}
+
 func GRPCServerOption(opts ...grpc.ServerOption) ServerOption {
 	return func(o *ServerOptions) {
 		o.serverOptions = opts
 	}
 }
+
+// DrainDelay 注销之后, 健康检查置为 NOT_SERVING 之前的等待时间, 让客户端摘除节点
+func DrainDelay(d time.Duration) ServerOption {
+	return func(o *ServerOptions) {
+		o.drainDelay = d
+	}
+}
+
+// ShutdownTimeout GracefulStop 的最长等待时间, 超时后 Stop 中断剩余的请求, 默认 DefaultShutdownTimeout
+func ShutdownTimeout(d time.Duration) ServerOption {
+	return func(o *ServerOptions) {
+		o.shutdownTimeout = d
+	}
+}
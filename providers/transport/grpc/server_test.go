@@ -0,0 +1,309 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	registry "github.com/aka-yz/go-micro-core/register"
+	"go.uber.org/config"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+func TestServerStopTimeout(t *testing.T) {
+	s := NewServer(ShutdownTimeout(time.Millisecond * 200))
+	ls, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(ls)
+
+	conn, err := grpc.Dial(ls.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// Watch 是长连接的流, GracefulStop 会一直等待
+	stream, err := healthpb.NewHealthClient(conn).Watch(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp, err := stream.Recv(); err != nil || resp.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("status:%v err:%v", resp, err)
+	}
+
+	start := time.Now()
+	s.Stop()
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("stop took %v", d)
+	}
+
+	if resp, err := stream.Recv(); err != nil || resp.Status != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Fatalf("status:%v err:%v", resp, err)
+	}
+	if _, err := stream.Recv(); err == nil {
+		t.Fatal("stream should be cut")
+	}
+	// 重复 Stop 不会 panic
+	s.Stop()
+}
+
+// blockingRegistry Register 阻塞到 release 关闭
+type blockingRegistry struct {
+	registry.Registry
+	registering chan struct{}
+	release     chan struct{}
+	deregisters int64
+}
+
+func (r *blockingRegistry) Register(*registry.Service, ...registry.RegisterOption) error {
+	close(r.registering)
+	<-r.release
+	return nil
+}
+
+func (r *blockingRegistry) Deregister(*registry.Service) error {
+	atomic.AddInt64(&r.deregisters, 1)
+	return nil
+}
+
+func TestServerStopDuringRegister(t *testing.T) {
+	r := &blockingRegistry{registering: make(chan struct{}), release: make(chan struct{})}
+	service := &registry.Service{Name: "user", Nodes: []*registry.Node{{Id: "1"}}}
+	s := NewServer(Addr("127.0.0.1:0"), Registry(r), ShutdownTimeout(time.Millisecond*200), Service(service))
+	s.Start()
+	<-r.registering
+	// 注册的是副本, 配置中的 service 不被修改
+	if service.Nodes[0].Address != "" || service.Endpoints != nil {
+		t.Fatalf("shared service modified: %+v", service.Nodes[0])
+	}
+
+	// Register 阻塞时 Stop 不会被卡住
+	stopped := make(chan struct{})
+	go func() {
+		s.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("stop blocked by register")
+	}
+
+	// 晚于注销完成的注册会被再注销一次
+	close(r.release)
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt64(&r.deregisters) < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond * 10)
+	}
+	if n := atomic.LoadInt64(&r.deregisters); n != 2 {
+		t.Fatalf("deregisters:%d", n)
+	}
+}
+
+// recordRegistry 记录注册的 service
+type recordRegistry struct {
+	registry.Registry
+	registered chan *registry.Service
+}
+
+func (r *recordRegistry) Register(s *registry.Service, _ ...registry.RegisterOption) error {
+	select {
+	case r.registered <- s:
+	default:
+	}
+	return nil
+}
+
+func (r *recordRegistry) Deregister(*registry.Service) error {
+	return nil
+}
+
+func TestServerAddEndpoints(t *testing.T) {
+	r := &recordRegistry{registered: make(chan *registry.Service, 1)}
+	s := NewServer(Registry(r), Advertise("10.0.0.1"),
+		Service(&registry.Service{Name: "user-rpc", Nodes: []*registry.Node{{Id: "1"}}}))
+	// mux 上 http 的路由与 grpc 方法一起注册
+	s.ServeExternal(&net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8000})
+	s.AddEndpoints(func(port int) []*registry.Endpoint {
+		return []*registry.Endpoint{{Name: "GET /ping", Protocol: registry.ProtocolHTTP, Port: port}}
+	})
+	s.Start()
+	defer s.Stop()
+
+	var service *registry.Service
+	select {
+	case service = <-r.registered:
+	case <-time.After(time.Second):
+		t.Fatal("not registered")
+	}
+	// 只有健康检查服务, 没有 grpc 的 endpoint
+	eps := service.Endpoints
+	if len(eps) != 1 || eps[0].Name != "GET /ping" || eps[0].Port != 8000 ||
+		service.Nodes[0].Address != "10.0.0.1" || service.Nodes[0].Port != 8000 {
+		t.Fatalf("service: %+v %+v", service.Nodes[0], service.Endpoints)
+	}
+}
+
+func TestServerHealthWatchNotInflight(t *testing.T) {
+	s := NewServer()
+	ls, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(ls)
+	defer s.Stop()
+
+	conn, err := grpc.Dial(ls.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	stream, err := healthpb.NewHealthClient(conn).Watch(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt64(&s.inflight); n != 0 {
+		t.Fatalf("inflight:%d", n)
+	}
+}
+
+func TestServerConfig(t *testing.T) {
+	conf, err := config.NewYAML(config.Source(strings.NewReader(`
+name: user
+rpcserver:
+  addr: ":9000"
+  metadata: gin
+  interceptors: [gin]
+  options:
+    maxrecvmsgsize: 1024
+    maxconcurrentstreams: 100
+    keepalive:
+      time: 30
+      timeout: 5
+      enforcement:
+        mintime: 10
+        permitwithoutstream: true
+`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := getServerConfig(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.Reflection || len(cfg.Interceptors) != 2 {
+		t.Fatalf("reflection:%v interceptors:%v", cfg.Reflection, cfg.Interceptors)
+	}
+	if unary, _, err := namedServerInterceptors(cfg.Interceptors); err != nil || len(unary) != 1 {
+		t.Fatalf("unary:%d err:%v", len(unary), err)
+	}
+	s := NewServer(MaxRecvMsgSize(cfg.Options.MaxRecvMsgSize), GRPCServerOption(cfg.Options.serverOptions()...))
+	if s.MaxRecvMsgSize() != cfg.Options.MaxRecvMsgSize {
+		t.Fatalf("maxrecvmsgsize:%d", s.MaxRecvMsgSize())
+	}
+	ls, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(ls)
+	defer s.Stop()
+	conn, err := grpc.Dial(ls.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := healthpb.NewHealthClient(conn)
+	// gzip 由客户端协商
+	if _, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{}, grpc.UseCompressor("gzip")); err != nil {
+		t.Fatal(err)
+	}
+	// 超过 maxrecvmsgsize 的请求被拒绝
+	large := &healthpb.HealthCheckRequest{Service: strings.Repeat("a", 2048)}
+	if _, err := client.Check(context.Background(), large); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("large request err:%v", err)
+	}
+
+	for _, bad := range []string{
+		"options: {maxsendmsgsize: -1}",
+		"options: {keepalive: {enforcement: {mintime: -1}}}",
+		"interceptors: [unknown]",
+	} {
+		conf, err := config.NewYAML(config.Source(strings.NewReader("rpcserver:\n  " + bad)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := getServerConfig(conf); err == nil {
+			t.Errorf("%s should fail", bad)
+		}
+	}
+
+	// reflection 默认注册, 可以关闭
+	conf, err = config.NewYAML(config.Source(strings.NewReader("rpcserver: {addr: \":9000\", reflection: false}")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg, err := getServerConfig(conf); err != nil || cfg.Reflection {
+		t.Fatalf("reflection off: %v", err)
+	}
+
+	// registry 配置错误不能被当作未配置
+	conf, err = config.NewYAML(config.Source(strings.NewReader("rpcserver: {addr: \":9000\"}\nregistry: {registryttl: abc}")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := getServerConfig(conf); err == nil {
+		t.Error("bad registry config should fail")
+	}
+}
+
+func TestServerListeners(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "user.sock")
+	s := NewServer(Addr("127.0.0.1:0"), Listen("unix://"+sock), Advertise("10.0.0.1"))
+	s.Start()
+	defer s.Stop()
+
+	addrs := s.Addrs()
+	if len(addrs) != 2 || addrs[1].Network() != "unix" {
+		t.Fatalf("addrs:%v", addrs)
+	}
+
+	conn, err := grpc.Dial("unix://"+sock, grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	tcpPort := addrs[0].(*net.TCPAddr).Port
+	for advertise, want := range map[string]string{
+		"10.0.0.1":    net.JoinHostPort("10.0.0.1", fmt.Sprint(tcpPort)),
+		"[::1]:7000":  "[::1]:7000",
+		"[fd00::1]":   net.JoinHostPort("fd00::1", fmt.Sprint(tcpPort)),
+		"":            net.JoinHostPort("127.0.0.1", fmt.Sprint(tcpPort)),
+		"user.local:": net.JoinHostPort("user.local", fmt.Sprint(tcpPort)),
+	} {
+		s.opts.advertise = advertise
+		host, port, err := s.advertiseAddr()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := net.JoinHostPort(host, fmt.Sprint(port)); got != want {
+			t.Errorf("advertise %q: got %v want %v", advertise, got, want)
+		}
+	}
+}
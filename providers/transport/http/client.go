@@ -4,6 +4,8 @@ import (
 	"github.com/aka-yz/go-micro-core"
 	"github.com/aka-yz/go-micro-core/providers/constants"
 	"github.com/aka-yz/go-micro-core/providers/option"
+	"github.com/aka-yz/go-micro-core/providers/transport/auth"
+	"github.com/aka-yz/go-micro-core/providers/transport/breaker"
 	"go.uber.org/config"
 	"time"
 )
@@ -28,6 +30,18 @@ func newHTTPClient(cfg *option.HttpClientConfig) *HttpClient {
 		opt = append(opt, WithServiceName(cfg.Name))
 	}
 
+	if cfg.Breaker != nil {
+		opt = append(opt, WithBreaker(breaker.NewGroup(breaker.ConfigOptions(cfg.Breaker))))
+	}
+
+	if l := cfg.RateLimit; l != nil && l.Rate > 0 {
+		opt = append(opt, WithRateLimit(l.Rate, l.Burst, l.Wait))
+	}
+
+	if cfg.Auth != nil {
+		opt = append(opt, WithSigner(auth.NewSigner(*cfg.Auth)))
+	}
+
 	return NewHttpClient(opt...)
 }
 
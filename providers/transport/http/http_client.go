@@ -11,12 +11,18 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
+
+	errs "github.com/aka-yz/go-micro-core/providers/transport/errors"
+	"github.com/aka-yz/go-micro-core/providers/transport/ratelimit"
 )
 
 type HttpClient struct {
 	client  *http.Client
 	options options
+	// limiters host -> *ratelimit.Limiter
+	limiters sync.Map
 }
 
 func (h *HttpClient) Post(ctx context.Context, url string, body interface{}, v interface{}, opts ...RequestOption) (err error) {
@@ -60,12 +66,13 @@ func (h *HttpClient) handle(ctx context.Context, method string, url string, reqB
 
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
+		msg := fmt.Sprintf("http code:%v url:%v", resp.StatusCode, url)
 		body, tempErr := ioutil.ReadAll(resp.Body)
 		if tempErr != nil {
-			return fmt.Errorf("http code:%v url:%v", resp.StatusCode, url)
+			return errs.New(errs.CodeFromHTTPStatus(resp.StatusCode), "", msg)
 		}
 		_ = json.Unmarshal(body, v)
-		return fmt.Errorf("http code:%v url:%v", resp.StatusCode, url)
+		return errs.FromHTTP(resp.StatusCode, body, msg)
 	}
 
 	body, err := ioutil.ReadAll(resp.Body)
@@ -111,17 +118,72 @@ func (h *HttpClient) doWithRetry(ctx context.Context, method string, url string,
 		}
 	}
 
+	// 签名需要 body 的内容
+	var signed []byte
+	if h.options.signer != nil && reader != nil {
+		if signed, err = ioutil.ReadAll(reader); err != nil {
+			return
+		}
+		reader = bytes.NewReader(signed)
+	}
+
 	req, err := http.NewRequest(method, url, reader)
 	if err != nil {
 		return nil, err
 	}
 
 	req.Header = header
+	if h.options.signer != nil {
+		for k, v := range h.options.signer.Headers(method+" "+req.URL.RequestURI(), signed) {
+			req.Header.Set(k, v)
+		}
+	}
 
-	resp, err = h.client.Do(req)
+	resp, err = h.send(ctx, req)
 	return
 }
 
+// send 经过限流和熔断后发送请求
+func (h *HttpClient) send(ctx context.Context, req *http.Request) (*http.Response, error) {
+	if h.options.limit > 0 {
+		if err := h.limit(ctx, req.URL.Host); err != nil {
+			return nil, err
+		}
+	}
+	if h.options.breaker == nil {
+		return h.client.Do(req)
+	}
+
+	b := h.options.breaker.Get(req.Method + " " + req.URL.Host)
+	done, err := b.Allow()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", b.Name(), err)
+	}
+	start := time.Now()
+	resp, err := h.client.Do(req)
+	done(err != nil || resp.StatusCode >= http.StatusInternalServerError, time.Since(start))
+	return resp, err
+}
+
+func (h *HttpClient) limit(ctx context.Context, host string) error {
+	v, ok := h.limiters.Load(host)
+	if !ok {
+		v, _ = h.limiters.LoadOrStore(host, ratelimit.NewLimiter(host, h.options.limit, h.options.limitBurst, ratelimit.MetricsHook))
+	}
+	l := v.(*ratelimit.Limiter)
+
+	if h.options.limitWait {
+		if err := l.Wait(ctx); err != nil {
+			return fmt.Errorf("%s: %w", host, err)
+		}
+		return nil
+	}
+	if ok, retryAfter := l.Take(); !ok {
+		return fmt.Errorf("%s: %w, retry after %v", host, ratelimit.ErrLimited, retryAfter)
+	}
+	return nil
+}
+
 func (h *HttpClient) bodyReader(body interface{}) (io.Reader, error) {
 	if _, ok := body.(io.Reader); ok {
 		return body.(io.Reader), nil
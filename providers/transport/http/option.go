@@ -3,6 +3,9 @@ package http
 import (
 	"net/http"
 	"time"
+
+	"github.com/aka-yz/go-micro-core/providers/transport/auth"
+	"github.com/aka-yz/go-micro-core/providers/transport/breaker"
 )
 
 type options struct {
@@ -13,6 +16,12 @@ type options struct {
 	keepAlive           time.Duration
 	tlsHandshakeTimeout time.Duration
 	name                string
+	breaker             *breaker.Group
+	// limit 不为 0 时按 host 限流
+	limit      float64
+	limitBurst int
+	limitWait  bool
+	signer     *auth.Signer
 }
 
 type Option func(*options)
@@ -59,6 +68,29 @@ func WithServiceName(name string) Option {
 	}
 }
 
+// WithBreaker 按 "METHOD host" 熔断, 请求错误和 5xx 响应为失败
+func WithBreaker(g *breaker.Group) Option {
+	return func(opt *options) {
+		opt.breaker = g
+	}
+}
+
+// WithRateLimit 按 host 限流, 每秒 rate 个请求, wait 为 true 时等待令牌, 否则直接返回错误
+func WithRateLimit(rate float64, burst int, wait bool) Option {
+	return func(opt *options) {
+		opt.limit = rate
+		opt.limitBurst = burst
+		opt.limitWait = wait
+	}
+}
+
+// WithSigner 请求携带 signer 的凭证
+func WithSigner(s *auth.Signer) Option {
+	return func(opt *options) {
+		opt.signer = s
+	}
+}
+
 type RequestOptions struct {
 	ContentType string
 	Header      http.Header
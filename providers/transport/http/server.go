@@ -5,19 +5,40 @@ import (
 	"github.com/aka-yz/go-micro-core"
 	"github.com/aka-yz/go-micro-core/configs/log"
 	"github.com/aka-yz/go-micro-core/providers/constants"
+	"github.com/aka-yz/go-micro-core/providers/transport/auth"
+	"github.com/aka-yz/go-micro-core/providers/transport/discovery"
+	"github.com/aka-yz/go-micro-core/providers/transport/ratelimit"
+	registry "github.com/aka-yz/go-micro-core/register"
+	"github.com/aka-yz/go-micro-core/utils/json"
+	netutils "github.com/aka-yz/go-micro-core/utils/net"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/config"
+	"net"
 	"net/http"
 	"os"
+	"sync"
 	"time"
 )
 
 type serverFactory struct{}
 
 func (s *serverFactory) NewProvider(conf config.Provider) go_micro_core.Provider {
-	if cfg := getServerConfig(conf); cfg != nil {
-		return go_micro_core.NewProvider(newHTTPServer(cfg))
+	cfg, err := getServerConfig(conf)
+	if err != nil {
+		log.Errorf(context.TODO(), "httpserver config error: %v", err)
+		return nil
+	}
+	if cfg != nil {
+		s, err := newHTTPServer(cfg)
+		if err != nil {
+			log.Errorf(context.TODO(), "httpserver config error: %v", err)
+			if cfg.Auth != nil {
+				cfg.Auth.Close()
+			}
+			return nil
+		}
+		return go_micro_core.NewProvider(s)
 	}
 	return nil
 }
@@ -26,17 +47,134 @@ type Server struct {
 	r      *gin.Engine
 	Server *http.Server
 
+	registry registry.Registry
+	service  *registry.Service
+	exit     chan bool
+	// auth 与 rpc server 共用, Stop 时释放
+	auth *auth.Auth
+
+	// registered 最后一次注册的副本, register 与 Stop 不共享 service 的修改
+	mu         sync.Mutex
+	registered *registry.Service
+	stopped    bool
+	stopOnce   sync.Once
+	// external 不为空时由其他 server 在该地址上提供服务
+	external net.Addr
+	// advertise 和 interfaces 与 rpcserver 相同, 见 netutils.AdvertiseAddr
+	advertise  string
+	interfaces []string
+
 	closeSyncJob  chan<- struct{}
 	syncJobClosed <-chan struct{}
 }
 
+// ServeExternal Start 时不监听也不注册, 由 addr 上的其他 server(如单端口的 mux)调用 Handler,
+// 并通过 Endpoints 注册路由. 需要在 Start 之前调用
+func (s *Server) ServeExternal(addr net.Addr) {
+	s.external = addr
+}
+
+// Endpoints gin 的路由, port 为注册的端口
+func (s *Server) Endpoints(port int) []*registry.Endpoint {
+	return routeEndpoints(s.r, port)
+}
+
+// Handler gin 的 handler
+func (s *Server) Handler() http.Handler {
+	return s.r
+}
+
 func (s *Server) Start() {
+	if s.external != nil {
+		log.Infof(context.TODO(), "HTTP server served on: %v", s.external)
+		return
+	}
 	go func() {
 		go_micro_core.HttpErrCh <- s.Server.ListenAndServe()
 	}()
+	go s.register()
+}
+
+// register 注册 http 服务, 让客户端可以发现 http 协议的节点
+func (s *Server) register() {
+	if s.registry == nil || s.service == nil {
+		return
+	}
+
+	addr, err := net.ResolveTCPAddr("tcp", s.Server.Addr)
+	if err != nil {
+		log.Errorf(context.TODO(), "HTTP server register addr:%v failed: %v", s.Server.Addr, err)
+		return
+	}
+	host, port, err := netutils.AdvertiseAddr(s.advertise, s.interfaces, addr)
+	if err != nil {
+		log.Errorf(context.TODO(), "HTTP server register failed: %v", err)
+		return
+	}
+	base := registry.CopyService(s.service)
+	base.Nodes[0].Address = host
+	base.Nodes[0].Port = port
+
+	for {
+		service := registry.CopyService(base)
+		service.Endpoints = routeEndpoints(s.r, port)
+		if err := s.registry.Register(service); err == nil {
+			log.Infof(context.TODO(), "HTTP server register: %v", json.MustString(service))
+		}
+
+		s.mu.Lock()
+		stopped := s.stopped
+		s.registered = service
+		s.mu.Unlock()
+		if stopped {
+			// Register 期间 Stop 已经注销, 重新注销
+			_ = s.registry.Deregister(service)
+			return
+		}
+
+		select {
+		case <-s.exit:
+			return
+		case <-time.After(time.Second * 15):
+		}
+	}
 }
 
+func routeEndpoints(r *gin.Engine, port int) (endpoints []*registry.Endpoint) {
+	for _, route := range r.Routes() {
+		endpoints = append(endpoints, &registry.Endpoint{
+			Name:     route.Method + " " + route.Path,
+			Protocol: registry.ProtocolHTTP,
+			Port:     port,
+		})
+	}
+	return
+}
+
+// Stop 可以重复调用, 只有第一次生效
 func (s *Server) Stop() {
+	s.stopOnce.Do(s.shutdown)
+}
+
+func (s *Server) shutdown() {
+	// 先注销, 客户端不再路由到当前节点
+	s.mu.Lock()
+	s.stopped = true
+	registered := s.registered
+	s.mu.Unlock()
+	close(s.exit)
+	if s.registry != nil && registered != nil {
+		if err := s.registry.Deregister(registered); err != nil {
+			log.Errorf(context.TODO(), "HTTP server deregister failed: %v", err)
+		}
+	}
+	if s.registry != nil {
+		registry.Stop(s.registry)
+	}
+	if s.auth != nil {
+		s.auth.Close()
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 	defer cancel()
 	if err := s.Server.Shutdown(ctx); err != nil {
@@ -48,7 +186,7 @@ func (s *Server) Stop() {
 	}
 }
 
-func newHTTPServer(cfg *serverConfig) *Server {
+func newHTTPServer(cfg *serverConfig) (*Server, error) {
 	r := gin.New()
 	r.Use(gin.Logger())
 	r.Use(gin.Recovery())
@@ -67,6 +205,14 @@ func newHTTPServer(cfg *serverConfig) *Server {
 	})
 	r.Use(corsConfig)
 
+	if cfg.Auth != nil {
+		r.Use(auth.GinMiddleware(cfg.Auth))
+	}
+
+	if cfg.Admission != nil {
+		r.Use(ratelimit.GinMiddleware(ratelimit.NewAdmission(*cfg.Admission)))
+	}
+
 	HTTPserver := &http.Server{
 		Addr:              cfg.Addr,
 		Handler:           r,
@@ -74,33 +220,73 @@ func newHTTPServer(cfg *serverConfig) *Server {
 		ReadTimeout:       20 * time.Second, // setting them for go sec lint.
 		WriteTimeout:      20 * time.Second,
 	}
+	var register registry.Registry
+	if cfg.Registry != nil {
+		var err error
+		if register, err = discovery.NewRegistry(cfg.Registry); err != nil {
+			return nil, err
+		}
+	}
+
 	//server.addHandlers()
 	return &Server{
-		r:      r,
-		Server: HTTPserver,
-	}
+		r:          r,
+		Server:     HTTPserver,
+		registry:   register,
+		service:    cfg.Service,
+		auth:       cfg.Auth,
+		advertise:  cfg.Advertise,
+		interfaces: cfg.Interfaces,
+		exit:       make(chan bool),
+	}, nil
 }
 
 type serverConfig struct {
-	Addr  string
-	PProf string
+	Addr string
+	// Advertise 注册的地址, host 或 host:port, 为空时从 Interfaces(默认所有网卡)中选择本机 ip
+	Advertise  string
+	Interfaces []string
+	PProf      string
+	// Auth 来自 auth 配置, 与 rpc server 共用
+	Auth *auth.Auth
+	// Admission 限流和过载保护, 在认证之后
+	Admission *ratelimit.AdmissionConfig
+	Registry  *discovery.Config
+	Service   *registry.Service
 }
 
-func getServerConfig(conf config.Provider) *serverConfig {
+func getServerConfig(conf config.Provider) (*serverConfig, error) {
 	var cv config.Value
 
 	if cv = conf.Get("httpserver"); !cv.HasValue() {
-		return nil
+		return nil, nil
 	}
 
-	addrMap := make(map[string]string)
-	if err := cv.Populate(&addrMap); err != nil {
-		return nil
+	var raw struct {
+		Addr       string
+		Advertise  string
+		Interfaces []string
+		Admission  *ratelimit.AdmissionConfig
+	}
+	if err := cv.Populate(&raw); err != nil {
+		return nil, err
 	}
 
 	var cfg serverConfig
-	cfg.Addr = port(addrMap["addr"])
-	return &cfg
+	cfg.Addr = port(raw.Addr)
+	cfg.Advertise = raw.Advertise
+	cfg.Interfaces = raw.Interfaces
+	cfg.Admission = raw.Admission
+	var err error
+	if cfg.Registry, err = discovery.GetConfig(conf); err != nil {
+		return nil, err
+	}
+	cfg.Service = discovery.NewService(conf, "-http")
+	// 与 rpc server 共用同一个 Auth, 最后创建, 之后出错时由调用方 Close
+	if cfg.Auth, err = auth.FromConfig(conf); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
 }
 
 func port(addr string) string {
@@ -0,0 +1,11 @@
+package mux
+
+import (
+	"github.com/aka-yz/go-micro-core"
+)
+
+func init() {
+	go_micro_core.RegisterProvider(
+		&serverFactory{},
+	)
+}
@@ -0,0 +1,206 @@
+package mux
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	go_micro_core "github.com/aka-yz/go-micro-core"
+	"github.com/aka-yz/go-micro-core/configs/log"
+	"github.com/aka-yz/go-micro-core/providers/constants"
+	grpcserver "github.com/aka-yz/go-micro-core/providers/transport/grpc"
+	httpserver "github.com/aka-yz/go-micro-core/providers/transport/http"
+	netutils "github.com/aka-yz/go-micro-core/utils/net"
+	"github.com/improbable-eng/grpc-web/go/grpcweb"
+	"go.uber.org/config"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
+)
+
+// ConfigKey 单端口的配置, 同时需要 rpcserver 和 httpserver 配置, 它们的 addr 不再监听
+const ConfigKey = "mux"
+
+type serverFactory struct{}
+
+func (f *serverFactory) NewProvider(conf config.Provider) go_micro_core.Provider {
+	cv := conf.Get(ConfigKey)
+	if !cv.HasValue() {
+		return nil
+	}
+
+	var raw struct {
+		Addr string
+		// GRPCWeb 是否支持 grpc-web, 默认支持
+		GRPCWeb *bool
+	}
+	if err := cv.Populate(&raw); err != nil {
+		log.Errorf(context.TODO(), "mux config error: %v", err)
+		return nil
+	}
+	if raw.Addr == "" {
+		log.Errorf(context.TODO(), "mux config error: empty addr")
+		return nil
+	}
+	if !conf.Get("rpcserver").HasValue() || !conf.Get("httpserver").HasValue() {
+		log.Errorf(context.TODO(), "mux config error: rpcserver and httpserver are required")
+		return nil
+	}
+	return go_micro_core.NewProvider(&Server{
+		addr:    raw.Addr,
+		grpcWeb: raw.GRPCWeb == nil || *raw.GRPCWeb,
+	})
+}
+
+// Server 在一个端口上提供 gin, grpc 和 grpc-web 服务, 按请求的 content-type 分发.
+// rpcserver 配置了 tls 时该端口使用 tls, 否则 grpc 使用 h2c.
+// 该端口只由 RPCServer 注册一次, endpoint 包括 grpc 方法和 gin 路由
+type Server struct {
+	RPC  *grpcserver.RPCServer `inject:""`
+	HTTP *httpserver.Server    `inject:""`
+
+	addr    string
+	grpcWeb bool
+	ls      net.Listener
+	server  *http.Server
+}
+
+// Init 在所有 server Start 之前监听, 让 RPCServer 注册该端口.
+// 出错时不接管, RPCServer 和 http Server 各自监听
+func (s *Server) Init() {
+	if s.RPC == nil || s.RPC.Server == nil || s.HTTP == nil || s.HTTP.Server == nil {
+		log.Errorf(context.TODO(), "mux server error: rpcserver and httpserver are required")
+		return
+	}
+	ls, err := netutils.Listen(s.addr, func(addr string) (net.Listener, error) {
+		return net.Listen("tcp", addr)
+	})
+	if err != nil {
+		log.Errorf(context.TODO(), "mux listen on:%v error:%v", s.addr, err)
+		return
+	}
+	s.RPC.ServeExternal(ls.Addr())
+	s.RPC.AddEndpoints(s.HTTP.Endpoints)
+	s.HTTP.ServeExternal(ls.Addr())
+	// rpcserver 配置了 tls 时在监听上终止 tls, grpc 和 http 使用同一个证书
+	if cfg := s.RPC.TLSConfig(); cfg != nil {
+		ls = tls.NewListener(ls, serverTLSConfig(cfg))
+	}
+	s.ls = ls
+
+	hs := s.HTTP.Server
+	idle := hs.IdleTimeout
+	if idle == 0 {
+		idle = hs.ReadTimeout
+	}
+	s.server = &http.Server{
+		Handler:           Handler(s.RPC.Server, withTimeouts(s.HTTP.Handler(), hs.ReadTimeout, hs.WriteTimeout), s.grpcWeb),
+		ReadHeaderTimeout: hs.ReadHeaderTimeout,
+		IdleTimeout:       idle,
+		ConnContext:       connContext,
+	}
+}
+
+func (s *Server) Start() {
+	if s.server == nil {
+		return
+	}
+	log.Infof(context.TODO(), "mux server listen on: %v", s.ls.Addr())
+	go func() {
+		if err := s.server.Serve(s.ls); err != nil && err != http.ErrServerClosed {
+			log.Errorf(context.TODO(), "mux server error: %v", err)
+		}
+	}()
+}
+
+// Stop 在 RPCServer 和 http Server 注销之后关闭监听, 等待正在处理的请求
+func (s *Server) Stop() {
+	if s.server == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	if err := s.server.Shutdown(ctx); err != nil {
+		log.Errorf(context.TODO(), "mux server shutdown error: %v", err)
+	}
+}
+
+type connKey struct{}
+
+// connContext 保存请求的连接, withTimeouts 按请求设置 deadline
+func connContext(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connKey{}, c)
+}
+
+// withTimeouts http server 的读写超时只用于 http/1 的 gin 请求, 与 net/http 一样按请求设置连接的 deadline,
+// 响应写完后 net/http 清除写 deadline. 设置在 mux 的 http.Server 上会中断 grpc 和 grpc-web 的长连接流,
+// http/2 的请求与 grpc 共用连接, 不设置
+func withTimeouts(h http.Handler, read, write time.Duration) http.Handler {
+	if read <= 0 && write <= 0 {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c, ok := r.Context().Value(connKey{}).(net.Conn); ok && r.ProtoMajor == 1 {
+			now := time.Now()
+			if read > 0 {
+				_ = c.SetReadDeadline(now.Add(read))
+			}
+			if write > 0 {
+				_ = c.SetWriteDeadline(now.Add(write))
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// serverTLSConfig ALPN 同时支持 h2 和 http/1.1, rpcserver 的配置只有 h2
+func serverTLSConfig(base *tls.Config) *tls.Config {
+	protos := []string{"h2", "http/1.1"}
+	cfg := base.Clone()
+	cfg.NextProtos = protos
+	if get := base.GetConfigForClient; get != nil {
+		cfg.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			c, err := get(hello)
+			if err != nil || c == nil {
+				return c, err
+			}
+			c = c.Clone()
+			c.NextProtos = protos
+			return c, nil
+		}
+	}
+	return cfg
+}
+
+// Handler 按请求分发: grpc-web(包括 CORS 预检)到 grpc-web, http2 的 application/grpc 到
+// grpc, 其他到 h. 没有 tls 时支持 h2c
+func Handler(rpc *grpc.Server, h http.Handler, grpcWeb bool) http.Handler {
+	var web *grpcweb.WrappedGrpcServer
+	if grpcWeb {
+		web = grpcweb.WrapServer(rpc, grpcweb.WithOriginFunc(allowedOrigin))
+	}
+
+	return h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case web != nil && (web.IsGrpcWebRequest(r) || web.IsAcceptableGrpcCorsRequest(r)):
+			web.ServeHTTP(w, r)
+		case r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc"):
+			rpc.ServeHTTP(w, r)
+		default:
+			h.ServeHTTP(w, r)
+		}
+	}), &http2.Server{})
+}
+
+// allowedOrigin grpc-web 的 CORS 与 gin 的 cors 使用同样的 origin
+func allowedOrigin(origin string) bool {
+	for _, o := range constants.AllowedOrigins {
+		if o == origin {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,236 @@
+package mux
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aka-yz/go-micro-core/configs/log"
+	grpcserver "github.com/aka-yz/go-micro-core/providers/transport/grpc"
+	"go.uber.org/config"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestHandler(t *testing.T) {
+	rpc := grpcserver.NewServer()
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("gin"))
+	})
+
+	ls, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: Handler(rpc.Server, h, true)}
+	go server.Serve(ls)
+	defer server.Close()
+	addr := ls.Addr().String()
+
+	// grpc 通过 h2c
+	conn, err := grpc.Dial(addr, grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	resp, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil || resp.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("grpc resp:%v err:%v", resp, err)
+	}
+
+	// http
+	r, err := http.Get("http://" + addr + "/ping")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	if string(body) != "gin" {
+		t.Fatalf("http body:%s", body)
+	}
+
+	// grpc-web, 空的请求消息只有 5 字节的帧头
+	r, err = http.Post("http://"+addr+"/grpc.health.v1.Health/Check", "application/grpc-web+proto",
+		bytes.NewReader([]byte{0, 0, 0, 0, 0}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ = ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	if r.StatusCode != http.StatusOK || !strings.Contains(string(body), "grpc-status: 0") {
+		t.Fatalf("grpc-web status:%d body:%q", r.StatusCode, body)
+	}
+}
+
+// selfSigned 与 tlsconfig.Reloader 一样在 GetConfigForClient 中返回证书, 只有 h2
+func selfSigned(t *testing.T) *tls.Config {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "mux"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	return &tls.Config{
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return &tls.Config{Certificates: []tls.Certificate{cert}, NextProtos: []string{"h2"}}, nil
+		},
+	}
+}
+
+func TestHandlerTLS(t *testing.T) {
+	rpc := grpcserver.NewServer()
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("gin"))
+	})
+
+	ls, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: Handler(rpc.Server, h, true)}
+	go server.Serve(tls.NewListener(ls, serverTLSConfig(selfSigned(t))))
+	defer server.Close()
+	addr := ls.Addr().String()
+	clientTLS := &tls.Config{InsecureSkipVerify: true}
+
+	// grpc 通过 tls 的 h2
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(credentials.NewTLS(clientTLS)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	resp, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil || resp.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("grpc resp:%v err:%v", resp, err)
+	}
+
+	// http/1.1 的客户端同样可以协商
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientTLS}}
+	r, err := client.Get("https://" + addr + "/ping")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	if r.ProtoMajor != 1 || string(body) != "gin" {
+		t.Fatalf("http proto:%v body:%s", r.Proto, body)
+	}
+
+	// 明文的 h2c 不再可用
+	plain, err := grpc.Dial(addr, grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer plain.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := healthpb.NewHealthClient(plain).Check(ctx, &healthpb.HealthCheckRequest{}); err == nil {
+		t.Fatal("plaintext grpc should fail")
+	}
+}
+
+func TestHandlerTimeouts(t *testing.T) {
+	rpc := grpcserver.NewServer()
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(300 * time.Millisecond)
+		}
+		_, _ = w.Write([]byte("gin"))
+	})
+
+	ls, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{
+		Handler:     Handler(rpc.Server, withTimeouts(h, time.Second, 100*time.Millisecond), true),
+		ConnContext: connContext,
+	}
+	go server.Serve(ls)
+	defer server.Close()
+	addr := ls.Addr().String()
+
+	// gin 的请求超过 WriteTimeout 时连接被关闭
+	client := &http.Client{Transport: &http.Transport{}}
+	if r, err := client.Get("http://" + addr + "/slow"); err == nil {
+		r.Body.Close()
+		t.Fatal("slow request should time out")
+	}
+
+	// 同一连接上之后的 grpc-web 请求不受 gin 请求的 deadline 影响
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+	if _, err := conn.Write([]byte("GET /ping HTTP/1.1\r\nHost: mux\r\n\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	r, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.ReadAll(r.Body)
+	r.Body.Close()
+
+	time.Sleep(200 * time.Millisecond)
+	req, _ := http.NewRequest("POST", "http://mux/grpc.health.v1.Health/Check", bytes.NewReader([]byte{0, 0, 0, 0, 0}))
+	req.Header.Set("Content-Type", "application/grpc-web+proto")
+	if err := req.Write(conn); err != nil {
+		t.Fatal(err)
+	}
+	if r, err = http.ReadResponse(br, req); err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	if !strings.Contains(string(body), "grpc-status: 0") {
+		t.Fatalf("grpc-web status:%d body:%q", r.StatusCode, body)
+	}
+}
+
+func TestNewProviderConfigErrors(t *testing.T) {
+	log.InitLogger(&log.Option{DirPath: t.TempDir() + "/"})
+	for _, bad := range []string{
+		"mux: {addr: [1]}",
+		"mux: {grpcweb: true}",
+		"mux: {addr: \":8000\"}\nrpcserver: {addr: \":9000\"}",
+	} {
+		conf, err := config.NewYAML(config.Source(strings.NewReader(bad)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p := (&serverFactory{}).NewProvider(conf); p != nil {
+			t.Errorf("%s should fail", bad)
+		}
+	}
+
+	// 没有 rpcserver 和 httpserver 时不接管, 也不 panic
+	s := &Server{addr: "127.0.0.1:0"}
+	s.Init()
+	s.Start()
+	s.Stop()
+}
@@ -0,0 +1,113 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// 自适应并发限制的默认值
+var (
+	DefaultAdaptiveInitial   = 20
+	DefaultAdaptiveMin       = 5
+	DefaultAdaptiveMax       = 1000
+	DefaultAdaptiveTolerance = 1.5
+	DefaultAdaptiveWindow    = 100
+)
+
+// AdaptiveOptions zero values use the defaults
+type AdaptiveOptions struct {
+	InitialLimit int
+	MinLimit     int
+	MaxLimit     int
+	// Tolerance 延迟超过最小延迟的该倍数后开始降低并发限制
+	Tolerance float64
+	// Window 每 Window 个请求调整一次限制
+	Window int
+}
+
+// AdaptiveLimiter limits the concurrency by a gradient of the latency: the limit
+// grows while the latency stays near the minimum and shrinks when requests queue
+// and the latency rises.
+type AdaptiveLimiter struct {
+	opts AdaptiveOptions
+
+	sync.Mutex
+	limit    float64
+	inflight int
+	// minRTT 观察到的最小延迟, 每 100 个窗口重置一次, 适应服务本身的变化
+	minRTT  time.Duration
+	windows int
+	// 当前窗口的延迟
+	samples int
+	sum     time.Duration
+}
+
+func NewAdaptiveLimiter(opts AdaptiveOptions) *AdaptiveLimiter {
+	if opts.InitialLimit <= 0 {
+		opts.InitialLimit = DefaultAdaptiveInitial
+	}
+	if opts.MinLimit <= 0 {
+		opts.MinLimit = DefaultAdaptiveMin
+	}
+	if opts.MaxLimit <= 0 {
+		opts.MaxLimit = DefaultAdaptiveMax
+	}
+	if opts.Tolerance <= 1 {
+		opts.Tolerance = DefaultAdaptiveTolerance
+	}
+	if opts.Window <= 0 {
+		opts.Window = DefaultAdaptiveWindow
+	}
+	return &AdaptiveLimiter{opts: opts, limit: float64(opts.InitialLimit)}
+}
+
+// Limit returns the current concurrency limit
+func (l *AdaptiveLimiter) Limit() int {
+	l.Lock()
+	defer l.Unlock()
+	return int(l.limit)
+}
+
+// Acquire returns false when the concurrency reaches the limit, otherwise the
+// release must be called with the latency, 0 for the calls not measured
+func (l *AdaptiveLimiter) Acquire() (func(rtt time.Duration), bool) {
+	l.Lock()
+	defer l.Unlock()
+	if l.inflight >= int(l.limit) {
+		return nil, false
+	}
+	l.inflight++
+	return l.release, true
+}
+
+func (l *AdaptiveLimiter) release(rtt time.Duration) {
+	l.Lock()
+	defer l.Unlock()
+	l.inflight--
+	if rtt <= 0 {
+		return
+	}
+
+	if l.minRTT == 0 || rtt < l.minRTT {
+		l.minRTT = rtt
+	}
+	l.samples++
+	l.sum += rtt
+	if l.samples < l.opts.Window {
+		return
+	}
+
+	avg := l.sum / time.Duration(l.samples)
+	l.samples, l.sum = 0, 0
+	// gradient 为 1 时延迟正常, 增加 sqrt(limit) 的排队空间; 延迟升高时按比例降低
+	gradient := math.Max(0.5, math.Min(1, l.opts.Tolerance*float64(l.minRTT)/float64(avg)))
+	limit := l.limit*gradient + math.Sqrt(l.limit)
+	// 平滑调整, 避免抖动
+	l.limit = math.Max(float64(l.opts.MinLimit), math.Min(float64(l.opts.MaxLimit), 0.8*l.limit+0.2*limit))
+
+	l.windows++
+	if l.windows >= 100 {
+		l.windows, l.minRTT = 0, 0
+	}
+}
@@ -0,0 +1,181 @@
+package ratelimit
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultRetryAfter 并发限制拒绝时建议的重试时间
+var DefaultRetryAfter = time.Second
+
+// UnmatchedRoute 没有匹配路由的 http 请求共用的方法名, 不按 url 创建令牌桶
+const UnmatchedRoute = "<unmatched>"
+
+// LimitConfig is a token bucket of rate requests per second
+type LimitConfig struct {
+	Rate  float64
+	Burst int
+}
+
+// AdmissionConfig server 的准入控制, 可以不配置其中的部分
+type AdmissionConfig struct {
+	// Methods 按方法限流, key 为完整方法名 /pkg.Svc/Method 或 "GET /users/:id",
+	// 以 * 结尾时按前缀匹配, 匹配的每个方法单独计数
+	Methods map[string]*LimitConfig
+	// Callers 按调用方限流, key 为认证的调用方或 client ip, "*" 为每个调用方默认的限制
+	Callers map[string]*LimitConfig
+	// MaxConcurrency 最大并发请求数
+	MaxConcurrency int
+	// Adaptive 根据延迟自适应的并发限制
+	Adaptive *AdaptiveOptions
+}
+
+// RejectError is returned when a request is not admitted
+type RejectError struct {
+	Reason     string
+	RetryAfter time.Duration
+}
+
+func (e *RejectError) Error() string {
+	return fmt.Sprintf("%v: %s, retry after %v", ErrLimited, e.Reason, e.RetryAfter)
+}
+
+func (e *RejectError) Unwrap() error {
+	return ErrLimited
+}
+
+// Admission is the admission control of a server, shared by all its methods
+type Admission struct {
+	cfg AdmissionConfig
+	// methods/callers key -> *Limiter
+	methods  sync.Map
+	callers  sync.Map
+	inflight int64
+	adaptive *AdaptiveLimiter
+	// lastSweep 上次清理空闲调用方的时间(UnixNano)
+	lastSweep int64
+}
+
+// callerIdle 调用方的令牌桶空闲超过该时间后删除, client ip 作为调用方时数量不受控制
+var callerIdle = 10 * time.Minute
+
+func NewAdmission(cfg AdmissionConfig) *Admission {
+	a := &Admission{cfg: cfg}
+	if cfg.Adaptive != nil {
+		a.adaptive = NewAdaptiveLimiter(*cfg.Adaptive)
+	}
+	return a
+}
+
+// Admit checks the limits in the order of method, caller, concurrency and adaptive
+// concurrency, a rejected request takes no tokens. done must be called when the request
+// ends, measured is false for the requests whose latency should not adjust the adaptive
+// limit, e.g. streams.
+func (a *Admission) Admit(method, caller string) (done func(measured bool), err error) {
+	// taken 已经取得的令牌, 之后的检查拒绝时归还
+	var taken []*Limiter
+	reject := func(reason string, retryAfter time.Duration) (func(bool), error) {
+		for _, l := range taken {
+			l.refund()
+		}
+		return nil, &RejectError{Reason: reason, RetryAfter: retryAfter}
+	}
+
+	if c := matchLimit(a.cfg.Methods, method); c != nil {
+		l := a.limiter(&a.methods, "method:"+method, c)
+		if ok, retryAfter := l.Take(); !ok {
+			return reject("method "+method, retryAfter)
+		}
+		taken = append(taken, l)
+	}
+
+	if c, ok := a.cfg.Callers[caller]; ok || a.cfg.Callers["*"] != nil {
+		if !ok {
+			c = a.cfg.Callers["*"]
+		}
+		a.sweep()
+		l := a.limiter(&a.callers, "caller:"+caller, c)
+		if ok, retryAfter := l.Take(); !ok {
+			return reject("caller "+caller, retryAfter)
+		}
+		taken = append(taken, l)
+	}
+
+	if max := int64(a.cfg.MaxConcurrency); max > 0 {
+		if atomic.AddInt64(&a.inflight, 1) > max {
+			atomic.AddInt64(&a.inflight, -1)
+			rejected.Add("concurrency", 1)
+			return reject("concurrency", DefaultRetryAfter)
+		}
+	}
+
+	var release func(time.Duration)
+	if a.adaptive != nil {
+		var ok bool
+		if release, ok = a.adaptive.Acquire(); !ok {
+			if a.cfg.MaxConcurrency > 0 {
+				atomic.AddInt64(&a.inflight, -1)
+			}
+			rejected.Add("adaptive", 1)
+			return reject("load shedding", DefaultRetryAfter)
+		}
+	}
+
+	start := time.Now()
+	return func(measured bool) {
+		if a.cfg.MaxConcurrency > 0 {
+			atomic.AddInt64(&a.inflight, -1)
+		}
+		if release != nil {
+			var rtt time.Duration
+			if measured {
+				rtt = time.Since(start)
+			}
+			release(rtt)
+		}
+	}, nil
+}
+
+func (a *Admission) limiter(m *sync.Map, key string, c *LimitConfig) *Limiter {
+	if l, ok := m.Load(key); ok {
+		return l.(*Limiter)
+	}
+	l, _ := m.LoadOrStore(key, NewLimiter(key, c.Rate, c.Burst, MetricsHook))
+	return l.(*Limiter)
+}
+
+func (a *Admission) sweep() {
+	now := time.Now()
+	last := atomic.LoadInt64(&a.lastSweep)
+	if now.UnixNano()-last < int64(callerIdle) || !atomic.CompareAndSwapInt64(&a.lastSweep, last, now.UnixNano()) {
+		return
+	}
+	a.callers.Range(func(key, l interface{}) bool {
+		if l.(*Limiter).idle(now, callerIdle) {
+			a.callers.Delete(key)
+		}
+		return true
+	})
+}
+
+// matchLimit 完整匹配优先, 其次是最长的前缀
+func matchLimit(limits map[string]*LimitConfig, method string) *LimitConfig {
+	if c, ok := limits[method]; ok {
+		return c
+	}
+	var limit *LimitConfig
+	var longest int
+	for key, c := range limits {
+		prefix := strings.TrimSuffix(key, "*")
+		if len(prefix) == len(key) || !strings.HasPrefix(method, prefix) {
+			continue
+		}
+		if limit == nil || len(prefix) > longest {
+			limit, longest = c, len(prefix)
+		}
+	}
+	return limit
+}
@@ -0,0 +1,137 @@
+package ratelimit
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAdmission(t *testing.T) {
+	a := NewAdmission(AdmissionConfig{
+		Methods:        map[string]*LimitConfig{"/user.User/*": {Rate: 1, Burst: 2}},
+		Callers:        map[string]*LimitConfig{"*": {Rate: 1, Burst: 3}},
+		MaxConcurrency: 2,
+	})
+
+	// 每个方法单独计数
+	for i := 0; i < 2; i++ {
+		done, err := a.Admit("/user.User/Get", "order")
+		if err != nil {
+			t.Fatal(err)
+		}
+		done(true)
+	}
+	_, err := a.Admit("/user.User/Get", "order")
+	var re *RejectError
+	if !errors.As(err, &re) || !errors.Is(err, ErrLimited) || re.RetryAfter <= 0 {
+		t.Fatalf("unexpected err %v", err)
+	}
+
+	// order 的令牌已用完, 其他调用方不受影响
+	done1, err := a.Admit("/user.User/Put", "order")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = a.Admit("/pay.Pay/Get", "order"); err == nil {
+		t.Fatal("caller limit not applied")
+	}
+	done2, err := a.Admit("/pay.Pay/Get", "pay")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 并发达到上限
+	if _, err = a.Admit("/pay.Pay/Get", "pay"); err == nil || err.(*RejectError).Reason != "concurrency" {
+		t.Fatalf("unexpected err %v", err)
+	}
+	done1(true)
+	done2(true)
+	if _, err = a.Admit("/pay.Pay/Get", "pay"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 调用方被拒绝时归还方法的令牌
+	a = NewAdmission(AdmissionConfig{
+		Methods: map[string]*LimitConfig{"/user.User/Get": {Burst: 2}},
+		Callers: map[string]*LimitConfig{"order": {Burst: 1}},
+	})
+	for i, c := range []struct {
+		caller string
+		reason string
+	}{{"order", ""}, {"order", "caller order"}, {"pay", ""}, {"pay", "method /user.User/Get"}} {
+		var reason string
+		if _, err := a.Admit("/user.User/Get", c.caller); errors.As(err, &re) {
+			reason = re.Reason
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if reason != c.reason {
+			t.Fatalf("%d: unexpected reject %q", i, reason)
+		}
+	}
+}
+
+func TestGinUnmatched(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	a := NewAdmission(AdmissionConfig{Methods: map[string]*LimitConfig{"*": {Burst: 1}}})
+	r := gin.New()
+	r.Use(GinMiddleware(a))
+
+	// 没有匹配路由的请求共用一个令牌桶
+	for i, path := range []string{"/a", "/b"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if want := []int{http.StatusNotFound, http.StatusTooManyRequests}[i]; w.Code != want {
+			t.Fatalf("%s: unexpected code %d", path, w.Code)
+		}
+	}
+	var n int
+	a.methods.Range(func(key, value interface{}) bool {
+		n++
+		return true
+	})
+	if n != 1 {
+		t.Fatalf("unexpected limiters %d", n)
+	}
+}
+
+func TestAdaptiveLimiter(t *testing.T) {
+	l := NewAdaptiveLimiter(AdaptiveOptions{InitialLimit: 50, Window: 10})
+
+	// 延迟稳定时限制增加
+	for i := 0; i < 100; i++ {
+		release, ok := l.Acquire()
+		if !ok {
+			t.Fatal("not acquired")
+		}
+		release(10 * time.Millisecond)
+	}
+	grown := l.Limit()
+	if grown <= 50 {
+		t.Fatalf("limit not grown %d", grown)
+	}
+
+	// 延迟升高到 10 倍后限制降低
+	for i := 0; i < 200; i++ {
+		release, _ := l.Acquire()
+		release(100 * time.Millisecond)
+	}
+	if l.Limit() >= grown {
+		t.Fatalf("limit not shrunk %d >= %d", l.Limit(), grown)
+	}
+
+	// 达到限制后拒绝
+	limit := l.Limit()
+	for i := 0; i < limit; i++ {
+		if _, ok := l.Acquire(); !ok {
+			t.Fatalf("rejected at %d", i)
+		}
+	}
+	if _, ok := l.Acquire(); ok {
+		t.Fatal("acquired over the limit")
+	}
+}
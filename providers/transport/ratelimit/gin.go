@@ -0,0 +1,50 @@
+package ratelimit
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/aka-yz/go-micro-core/providers/transport/auth"
+	errs "github.com/aka-yz/go-micro-core/providers/transport/errors"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+)
+
+// GinMiddleware admits the http requests by "METHOD route", the requests without a
+// matched route by UnmatchedRoute. The caller is the authenticated principal or the
+// client ip. It must be used after auth.GinMiddleware.
+func GinMiddleware(a *Admission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		target := c.Request.Method + " " + c.FullPath()
+		if c.FullPath() == "" {
+			target = UnmatchedRoute
+		}
+		caller := c.ClientIP()
+		if p, ok := auth.FromContext(c.Request.Context()); ok {
+			caller = p.Subject
+		}
+
+		done, err := a.Admit(target, caller)
+		if err != nil {
+			e := errs.New(codes.ResourceExhausted, "RATE_LIMITED", err.Error()).WithRetryable(true)
+			var re *RejectError
+			if errors.As(err, &re) {
+				retryAfter := RetryAfterSeconds(re.RetryAfter)
+				c.Header("Retry-After", retryAfter)
+				e = e.WithMetadata("reason", re.Reason, "retry_after", retryAfter)
+			}
+			c.Abort()
+			_ = errs.WriteHTTP(c.Writer, e)
+			return
+		}
+		defer done(true)
+		c.Next()
+	}
+}
+
+// RetryAfterSeconds Retry-After 的秒数, 至少 1 秒
+func RetryAfterSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Max(1, math.Ceil(d.Seconds()))))
+}
@@ -0,0 +1,151 @@
+// Package ratelimit is a token bucket rate limiter
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"sync"
+	"time"
+)
+
+// ErrLimited is returned when the request is rejected
+var ErrLimited = errors.New("rate limited")
+
+// rejected expvar ratelimit_rejected: name -> 被拒绝的次数
+var rejected = expvar.NewMap("ratelimit_rejected")
+
+// Hook is called when a request is rejected, it must not block
+type Hook func(name string)
+
+// MetricsHook counts the rejections by expvar
+func MetricsHook(name string) {
+	rejected.Add(name, 1)
+}
+
+// Limiter is a token bucket, rate tokens are added per second up to burst
+type Limiter struct {
+	name  string
+	rate  float64
+	burst float64
+	hooks []Hook
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewLimiter returns a full bucket, burst less than 1 is set to 1
+func NewLimiter(name string, rate float64, burst int, hooks ...Hook) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{
+		name:   name,
+		rate:   rate,
+		burst:  float64(burst),
+		hooks:  hooks,
+		tokens: float64(burst),
+	}
+}
+
+func (l *Limiter) Name() string {
+	return l.name
+}
+
+func (l *Limiter) advance(now time.Time) {
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	l.last = now
+}
+
+// Take takes a token if available, otherwise returns how long until one is available
+func (l *Limiter) Take() (bool, time.Duration) {
+	l.mu.Lock()
+	l.advance(time.Now())
+	if l.tokens >= 1 {
+		l.tokens--
+		l.mu.Unlock()
+		return true, 0
+	}
+	retryAfter := l.wait()
+	l.mu.Unlock()
+
+	l.reject()
+	return false, retryAfter
+}
+
+// Allow takes a token if available
+func (l *Limiter) Allow() bool {
+	ok, _ := l.Take()
+	return ok
+}
+
+// Wait blocks until a token is available, it fails immediately when the
+// context would be done before that
+func (l *Limiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	l.advance(time.Now())
+	wait := l.wait()
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+		l.mu.Unlock()
+		l.reject()
+		return ErrLimited
+	}
+	// 预占令牌, 允许为负数, 之后的请求排在后面
+	l.tokens--
+	l.mu.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+	t := time.NewTimer(wait)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		// 归还预占的令牌
+		l.mu.Lock()
+		l.tokens++
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// refund 归还 Take 取得的令牌
+func (l *Limiter) refund() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.tokens++; l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+}
+
+// idle 超过 d 没有使用
+func (l *Limiter) idle(now time.Time, d time.Duration) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return now.Sub(l.last) > d
+}
+
+// wait 得到一个令牌需要等待的时间
+func (l *Limiter) wait() time.Duration {
+	if l.tokens >= 1 {
+		return 0
+	}
+	if l.rate <= 0 {
+		return time.Duration(1<<63 - 1)
+	}
+	return time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+}
+
+func (l *Limiter) reject() {
+	for _, hook := range l.hooks {
+		hook(l.name)
+	}
+}
@@ -0,0 +1,37 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	var rejected int
+	l := NewLimiter("test", 100, 2, func(string) { rejected++ })
+
+	if !l.Allow() || !l.Allow() {
+		t.Fatal("burst not allowed")
+	}
+	ok, retryAfter := l.Take()
+	if ok || retryAfter <= 0 || retryAfter > 10*time.Millisecond || rejected != 1 {
+		t.Fatalf("unexpected take %v %v %v", ok, retryAfter, rejected)
+	}
+
+	start := time.Now()
+	if err := l.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) < 5*time.Millisecond {
+		t.Fatal("wait returned too early")
+	}
+
+	// deadline 之前拿不到令牌时立即返回
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	l = NewLimiter("test", 1, 1)
+	l.Allow()
+	if err := l.Wait(ctx); err != ErrLimited {
+		t.Fatalf("unexpected err %v", err)
+	}
+}
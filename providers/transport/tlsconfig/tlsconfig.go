@@ -0,0 +1,212 @@
+// Package tlsconfig builds the server and client tls configs from files,
+// the certificates and CA bundle are reloaded when the files change
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	stdlog "log"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultReloadInterval 检查证书文件变化的间隔
+var DefaultReloadInterval = 30 * time.Second
+
+// Config tls 的 yaml 配置, 文件路径为 pem 格式
+type Config struct {
+	// CA server 用于校验 client 证书, client 用于校验 server 证书, client 为空时使用系统 CA
+	CA   string
+	Cert string
+	Key  string
+	// ServerName client 校验的 server 名称, 默认为服务注册名, 如 user-rpc
+	ServerName string
+	// ClientAuth server 要求并校验 client 证书(mTLS)
+	ClientAuth bool
+	// ReloadInterval 检查文件变化的间隔(秒), 小于 0 时不重新加载
+	ReloadInterval int
+}
+
+// Reloader keeps the certificate and CA pool loaded from the files
+type Reloader struct {
+	cfg      Config
+	stop     chan struct{}
+	stopOnce sync.Once
+
+	sync.RWMutex
+	cert *tls.Certificate
+	pool *x509.CertPool
+	// mod 文件的修改时间, 变化时重新加载
+	mod map[string]time.Time
+}
+
+// NewReloader loads the files and watches them for changes
+func NewReloader(cfg Config) (*Reloader, error) {
+	if (cfg.Cert == "") != (cfg.Key == "") {
+		return nil, errors.New("tls cert and key must be set together")
+	}
+	r := &Reloader{cfg: cfg, stop: make(chan struct{})}
+	if _, err := r.reload(); err != nil {
+		return nil, err
+	}
+
+	interval := DefaultReloadInterval
+	if cfg.ReloadInterval > 0 {
+		interval = time.Second * time.Duration(cfg.ReloadInterval)
+	}
+	if cfg.ReloadInterval >= 0 {
+		go r.watch(interval)
+	}
+	return r, nil
+}
+
+func (r *Reloader) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			// 加载失败时继续使用之前的证书
+			if reloaded, err := r.reload(); err != nil {
+				stdlog.Printf("tls reload cert:%s ca:%s error:%v", r.cfg.Cert, r.cfg.CA, err)
+			} else if reloaded {
+				stdlog.Printf("tls reloaded cert:%s ca:%s", r.cfg.Cert, r.cfg.CA)
+			}
+		}
+	}
+}
+
+// Close stops watching the files, it can be called more than once
+func (r *Reloader) Close() {
+	r.stopOnce.Do(func() { close(r.stop) })
+}
+
+// reload 文件修改时间有变化时重新加载
+func (r *Reloader) reload() (bool, error) {
+	mod := make(map[string]time.Time)
+	for _, file := range []string{r.cfg.CA, r.cfg.Cert, r.cfg.Key} {
+		if file == "" {
+			continue
+		}
+		fi, err := os.Stat(file)
+		if err != nil {
+			return false, err
+		}
+		mod[file] = fi.ModTime()
+	}
+
+	r.RLock()
+	changed := len(mod) != len(r.mod)
+	for file, t := range mod {
+		if !r.mod[file].Equal(t) {
+			changed = true
+		}
+	}
+	r.RUnlock()
+	if !changed {
+		return false, nil
+	}
+
+	var cert *tls.Certificate
+	if r.cfg.Cert != "" {
+		c, err := tls.LoadX509KeyPair(r.cfg.Cert, r.cfg.Key)
+		if err != nil {
+			return false, err
+		}
+		cert = &c
+	}
+
+	var pool *x509.CertPool
+	if r.cfg.CA != "" {
+		pem, err := ioutil.ReadFile(r.cfg.CA)
+		if err != nil {
+			return false, err
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return false, fmt.Errorf("no certificate found in ca:%s", r.cfg.CA)
+		}
+	}
+
+	r.Lock()
+	r.cert, r.pool, r.mod = cert, pool, mod
+	r.Unlock()
+	return true, nil
+}
+
+func (r *Reloader) current() (*tls.Certificate, *x509.CertPool) {
+	r.RLock()
+	defer r.RUnlock()
+	return r.cert, r.pool
+}
+
+// ServerConfig every handshake uses the current certificate and client CA pool
+func (r *Reloader) ServerConfig() (*tls.Config, error) {
+	if r.cfg.Cert == "" {
+		return nil, errors.New("tls server requires cert and key")
+	}
+	if r.cfg.ClientAuth && r.cfg.CA == "" {
+		return nil, errors.New("tls client auth requires ca")
+	}
+
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cert, pool := r.current()
+			cfg := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*cert},
+				NextProtos:   []string{"h2"},
+			}
+			if r.cfg.ClientAuth {
+				cfg.ClientAuth = tls.RequireAndVerifyClientCert
+				cfg.ClientCAs = pool
+			}
+			return cfg, nil
+		},
+	}, nil
+}
+
+// ClientConfig verifies the server with the current CA pool, the client
+// certificate is sent when cert and key are set
+func (r *Reloader) ClientConfig() *tls.Config {
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: r.cfg.ServerName,
+	}
+	if r.cfg.Cert != "" {
+		cfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, _ := r.current()
+			return cert, nil
+		}
+	}
+	if r.cfg.CA == "" {
+		return cfg
+	}
+
+	// RootCAs 在创建时固定, 跳过默认校验, 在 VerifyConnection 中使用当前的 CA 校验
+	cfg.InsecureSkipVerify = true
+	cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 {
+			return errors.New("tls: server certificate required")
+		}
+		_, pool := r.current()
+		opts := x509.VerifyOptions{
+			Roots:         pool,
+			DNSName:       cs.ServerName,
+			Intermediates: x509.NewCertPool(),
+		}
+		for _, cert := range cs.PeerCertificates[1:] {
+			opts.Intermediates.AddCert(cert)
+		}
+		_, err := cs.PeerCertificates[0].Verify(opts)
+		return err
+	}
+	return cfg
+}
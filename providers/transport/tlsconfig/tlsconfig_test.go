@@ -0,0 +1,167 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newCA(t *testing.T) *testCA {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key}
+}
+
+// issue 签发证书, 写入 dir/name.pem 和 dir/name-key.pem
+func (ca *testCA) issue(t *testing.T, dir, name string) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, _ := x509.MarshalECPrivateKey(key)
+	writePEM(t, filepath.Join(dir, name+".pem"), "CERTIFICATE", der)
+	writePEM(t, filepath.Join(dir, name+"-key.pem"), "EC PRIVATE KEY", keyDer)
+}
+
+func (ca *testCA) write(t *testing.T, file string) {
+	writePEM(t, file, "CERTIFICATE", ca.cert.Raw)
+}
+
+func writePEM(t *testing.T, file, typ string, der []byte) {
+	if err := ioutil.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func handshake(t *testing.T, server, client *tls.Config) error {
+	lis, err := tls.Listen("tcp", "127.0.0.1:0", server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	go func() {
+		conn, err := lis.Accept()
+		if err == nil {
+			_ = conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+
+	conn, err := tls.Dial("tcp", lis.Addr().String(), client)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	// TLS 1.3 client 证书的校验结果在读取时返回
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	if err != nil && err.Error() == "EOF" {
+		return nil
+	}
+	return err
+}
+
+func TestReloader(t *testing.T) {
+	dir := t.TempDir()
+	ca := newCA(t)
+	ca.write(t, filepath.Join(dir, "ca.pem"))
+	ca.issue(t, dir, "user-rpc")
+	ca.issue(t, dir, "client")
+
+	server, err := NewReloader(Config{
+		CA:             filepath.Join(dir, "ca.pem"),
+		Cert:           filepath.Join(dir, "user-rpc.pem"),
+		Key:            filepath.Join(dir, "user-rpc-key.pem"),
+		ClientAuth:     true,
+		ReloadInterval: -1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverConfig, err := server.ServerConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := NewReloader(Config{
+		CA:             filepath.Join(dir, "ca.pem"),
+		Cert:           filepath.Join(dir, "client.pem"),
+		Key:            filepath.Join(dir, "client-key.pem"),
+		ServerName:     "user-rpc",
+		ReloadInterval: -1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = handshake(t, serverConfig, client.ClientConfig()); err != nil {
+		t.Fatalf("mtls handshake: %v", err)
+	}
+
+	// 没有 client 证书
+	noCert, _ := NewReloader(Config{CA: filepath.Join(dir, "ca.pem"), ServerName: "user-rpc", ReloadInterval: -1})
+	if err = handshake(t, serverConfig, noCert.ClientConfig()); err == nil {
+		t.Fatal("handshake without client cert succeeded")
+	}
+
+	// 证书换成另一个 CA 签发, 重新加载之后使用新的证书和 CA
+	other := newCA(t)
+	other.issue(t, dir, "user-rpc")
+	other.issue(t, dir, "client")
+	other.write(t, filepath.Join(dir, "ca.pem"))
+	forceReload(t, server)
+	if err = handshake(t, serverConfig, client.ClientConfig()); err == nil {
+		t.Fatal("handshake with the old client ca succeeded")
+	}
+
+	forceReload(t, client)
+	if err = handshake(t, serverConfig, client.ClientConfig()); err != nil {
+		t.Fatalf("handshake after reload: %v", err)
+	}
+}
+
+// forceReload 同一时间内写入的文件修改时间可能不变, 清空后重新加载
+func forceReload(t *testing.T, r *Reloader) {
+	r.Lock()
+	r.mod = nil
+	r.Unlock()
+	if reloaded, err := r.reload(); err != nil || !reloaded {
+		t.Fatalf("reload %v %v", reloaded, err)
+	}
+}
@@ -0,0 +1,276 @@
+// Package cache provides a registry cache which serves reads from memory,
+// keeps them fresh by watching the backend and falls back to the last
+// known good copy when the backend errors
+package cache
+
+import (
+	"sync"
+	"time"
+
+	registry "github.com/aka-yz/go-micro-core/register"
+)
+
+// Cache is the registry cache interface
+type Cache interface {
+	// registry.Registry embedded, reads are served from memory
+	registry.Registry
+	// Stats returns the cache hit/miss/staleness stats
+	Stats() Stats
+	// Stop the cache watchers and the backend registry
+	Stop()
+}
+
+// Stats of the registry cache
+type Stats struct {
+	// Hits reads served from memory
+	Hits uint64
+	// Misses reads which went to the backend
+	Misses uint64
+	// StaleHits reads served from the last known good copy after a backend error
+	StaleHits uint64
+	// Errors backend errors returned to the caller
+	Errors uint64
+	// Staleness time since each cached service was last refreshed
+	Staleness map[string]time.Duration
+}
+
+var (
+	DefaultTTL = time.Minute
+
+	// watch 失败后的重试间隔
+	watchRetryInterval = time.Second
+)
+
+type cache struct {
+	registry.Registry
+	opts Options
+
+	sync.RWMutex
+	cache      map[string][]*registry.Service
+	updated    map[string]time.Time
+	watched    map[string]bool
+	watchEnded map[string]time.Time
+	stats      Stats
+
+	exit chan bool
+	// now 当前时间, 测试中替换
+	now func() time.Time
+}
+
+func (c *cache) isValid(name string, now time.Time) bool {
+	updated, ok := c.updated[name]
+	if !ok || len(c.cache[name]) == 0 {
+		return false
+	}
+	return c.opts.TTL <= 0 || now.Sub(updated) < c.opts.TTL
+}
+
+func (c *cache) isStale(name string, now time.Time) bool {
+	updated, ok := c.updated[name]
+	if !ok || len(c.cache[name]) == 0 {
+		return false
+	}
+	return c.opts.MaxStale <= 0 || now.Sub(updated) < c.opts.MaxStale
+}
+
+func (c *cache) GetService(name string) ([]*registry.Service, error) {
+	now := c.now()
+
+	c.Lock()
+	if c.isValid(name, now) {
+		c.stats.Hits++
+		services := registry.Copy(c.cache[name])
+		c.Unlock()
+		return services, nil
+	}
+	c.stats.Misses++
+	c.Unlock()
+
+	services, err := c.Registry.GetService(name)
+
+	c.Lock()
+	defer c.Unlock()
+	switch {
+	case err == nil:
+		c.set(name, services, now)
+		c.startWatch(name)
+		return registry.Copy(services), nil
+	case err == registry.ErrNotFound:
+		c.del(name)
+		return nil, err
+	case c.isStale(name, now):
+		// 回源失败, 返回最后一次成功的数据
+		c.stats.StaleHits++
+		return registry.Copy(c.cache[name]), nil
+	default:
+		c.stats.Errors++
+		return nil, err
+	}
+}
+
+func (c *cache) ListServices() ([]*registry.Service, error) {
+	services, err := c.Registry.ListServices()
+	if err == nil {
+		return services, nil
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	now := c.now()
+	services = nil
+	for name, ss := range c.cache {
+		if c.isStale(name, now) {
+			services = append(services, registry.Copy(ss)...)
+		}
+	}
+	if len(services) == 0 {
+		c.stats.Errors++
+		return nil, err
+	}
+	c.stats.StaleHits++
+	return services, nil
+}
+
+func (c *cache) set(name string, services []*registry.Service, now time.Time) {
+	c.cache[name] = registry.Copy(services)
+	c.updated[name] = now
+}
+
+func (c *cache) del(name string) {
+	delete(c.cache, name)
+	delete(c.updated, name)
+}
+
+// startWatch 每个服务启动一个 watcher 更新缓存, 需要持有锁
+func (c *cache) startWatch(name string) {
+	if c.watched[name] {
+		return
+	}
+	select {
+	case <-c.exit:
+		return
+	default:
+	}
+	// watch 失败后避免每次读都重新 watch
+	if c.now().Sub(c.watchEnded[name]) < watchRetryInterval {
+		return
+	}
+
+	c.watched[name] = true
+	go c.run(name)
+}
+
+func (c *cache) run(name string) {
+	defer func() {
+		c.Lock()
+		c.watched[name] = false
+		c.watchEnded[name] = c.now()
+		c.Unlock()
+	}()
+
+	w, err := c.Registry.Watch(name)
+	if err != nil {
+		return
+	}
+
+	done := make(chan bool)
+	defer close(done)
+	go func() {
+		select {
+		case <-c.exit:
+			w.Stop()
+		case <-done:
+			w.Stop()
+		}
+	}()
+
+	for {
+		res, err := w.Next()
+		if err != nil {
+			return
+		}
+		c.update(res)
+	}
+}
+
+func (c *cache) update(res *registry.Result) {
+	if res == nil || res.Service == nil {
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	name := res.Service.Name
+	services, ok := c.cache[name]
+	if !ok {
+		// 没有被读过的服务不缓存
+		return
+	}
+
+	switch res.Action {
+	case registry.Delete:
+		services = registry.Remove(services, []*registry.Service{res.Service})
+	default:
+		services = registry.Merge(services, []*registry.Service{res.Service})
+	}
+
+	if len(services) == 0 {
+		c.del(name)
+		return
+	}
+	c.cache[name] = services
+	c.updated[name] = c.now()
+}
+
+func (c *cache) Stats() Stats {
+	c.RLock()
+	defer c.RUnlock()
+
+	now := c.now()
+	stats := c.stats
+	stats.Staleness = make(map[string]time.Duration, len(c.updated))
+	for name, updated := range c.updated {
+		stats.Staleness[name] = now.Sub(updated)
+	}
+	return stats
+}
+
+func (c *cache) Stop() {
+	c.Lock()
+	defer c.Unlock()
+
+	select {
+	case <-c.exit:
+		return
+	default:
+		close(c.exit)
+	}
+	registry.Stop(c.Registry)
+}
+
+func (c *cache) String() string {
+	return "cache"
+}
+
+// New returns a new registry cache wrapping r
+func New(r registry.Registry, opts ...Option) Cache {
+	options := Options{
+		TTL: DefaultTTL,
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+
+	return &cache{
+		Registry:   r,
+		opts:       options,
+		cache:      make(map[string][]*registry.Service),
+		updated:    make(map[string]time.Time),
+		watched:    make(map[string]bool),
+		watchEnded: make(map[string]time.Time),
+		exit:       make(chan bool),
+		now:        time.Now,
+	}
+}
@@ -0,0 +1,123 @@
+package cache
+
+import (
+	"errors"
+	registry "github.com/aka-yz/go-micro-core/register"
+	"github.com/aka-yz/go-micro-core/register/static"
+	"sync"
+	"testing"
+	"time"
+)
+
+type flakyRegistry struct {
+	registry.Registry
+	mu  sync.Mutex
+	err error
+	// nexts 每次 watcher 的 Next 被调用时通知, 第 n+1 次调用说明前 n 个事件已经处理完
+	nexts chan struct{}
+}
+
+func (f *flakyRegistry) setErr(err error) {
+	f.mu.Lock()
+	f.err = err
+	f.mu.Unlock()
+}
+
+func (f *flakyRegistry) GetService(name string) ([]*registry.Service, error) {
+	f.mu.Lock()
+	err := f.err
+	f.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return f.Registry.GetService(name)
+}
+
+func (f *flakyRegistry) Watch(service string, opts ...registry.WatchOption) (registry.Watcher, error) {
+	w, err := f.Registry.Watch(service, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &notifyWatcher{Watcher: w, nexts: f.nexts}, nil
+}
+
+type notifyWatcher struct {
+	registry.Watcher
+	nexts chan struct{}
+}
+
+func (w *notifyWatcher) Next() (*registry.Result, error) {
+	w.nexts <- struct{}{}
+	return w.Watcher.Next()
+}
+
+// clock 测试用的时钟
+type clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *clock) Add(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+func TestCache(t *testing.T) {
+	r, err := static.NewRegistry(static.Services(map[string][]string{
+		"foo-rpc": {"10.0.0.1:9000"},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := &flakyRegistry{Registry: r, nexts: make(chan struct{})}
+	c := New(backend, WithTTL(50*time.Millisecond), WithMaxStale(200*time.Millisecond))
+	defer c.Stop()
+	clk := &clock{now: time.Unix(1000, 0)}
+	c.(*cache).now = clk.Now
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.GetService("foo-rpc"); err != nil {
+			t.Fatalf("Unexpected error getting service: %v", err)
+		}
+	}
+	if stats := c.Stats(); stats.Misses != 1 || stats.Hits != 1 {
+		t.Fatalf("Expected 1 miss and 1 hit, got %+v", stats)
+	}
+
+	// updates from the watcher are applied to the cached copy
+	<-backend.nexts
+	if err := backend.Register(&registry.Service{
+		Name:  "foo-rpc",
+		Nodes: []*registry.Node{{Id: "foo-rpc-10.0.0.2:9000", Address: "10.0.0.2", Port: 9000}},
+	}); err != nil {
+		t.Fatalf("Unexpected register error: %v", err)
+	}
+	<-backend.nexts
+	services, _ := c.GetService("foo-rpc")
+	if i := len(services[0].Nodes); i != 2 {
+		t.Fatalf("Expected 2 nodes, got %d: %+v", i, services[0].Nodes)
+	}
+
+	// backend errors are served from the last known good copy until max stale
+	backendErr := errors.New("etcd unavailable")
+	backend.setErr(backendErr)
+	clk.Add(60 * time.Millisecond)
+	if _, err := c.GetService("foo-rpc"); err != nil {
+		t.Fatalf("Expected stale copy, got error: %v", err)
+	}
+	if stats := c.Stats(); stats.StaleHits != 1 {
+		t.Fatalf("Expected 1 stale hit, got %+v", stats)
+	}
+
+	clk.Add(200 * time.Millisecond)
+	if _, err := c.GetService("foo-rpc"); err != backendErr {
+		t.Fatalf("Expected backend error after max stale, got %v", err)
+	}
+}
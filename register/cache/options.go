@@ -0,0 +1,26 @@
+package cache
+
+import "time"
+
+type Options struct {
+	// TTL 缓存有效期, 过期后回源查询
+	TTL time.Duration
+	// MaxStale 回源失败时允许返回的最旧数据, 0 表示不限制
+	MaxStale time.Duration
+}
+
+type Option func(*Options)
+
+// WithTTL sets how long cached services are served without asking the backend
+func WithTTL(t time.Duration) Option {
+	return func(o *Options) {
+		o.TTL = t
+	}
+}
+
+// WithMaxStale sets the max age of the last known good copy served when the backend errors
+func WithMaxStale(t time.Duration) Option {
+	return func(o *Options) {
+		o.MaxStale = t
+	}
+}
@@ -0,0 +1,71 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	registry "github.com/aka-yz/go-micro-core/register"
+)
+
+func TestDNSRegistry(t *testing.T) {
+	r := NewRegistry(Services(map[string][]string{
+		"foo-rpc": {"127.0.0.1:9000", "localhost:9001"},
+	}))
+
+	services, err := r.GetService("foo-rpc")
+	if err != nil {
+		t.Fatalf("Unexpected error getting service: %v", err)
+	}
+	if i := len(services[0].Nodes); i < 2 {
+		t.Fatalf("Expected at least 2 nodes, got %d: %+v", i, services[0].Nodes)
+	}
+
+	if _, err = r.GetService("bar-rpc"); err != registry.ErrNotFound {
+		t.Fatalf("Expected not found, got %v", err)
+	}
+
+	w, err := r.Watch("foo-rpc")
+	if err != nil {
+		t.Fatalf("Unexpected watch error: %v", err)
+	}
+	registry.Stop(r)
+	if _, err = w.Next(); err != registry.ErrWatcherStopped {
+		t.Fatalf("Expected watcher stopped, got %v", err)
+	}
+	// 重复 Stop 不会 panic
+	registry.Stop(r)
+}
+
+func TestDiffNodes(t *testing.T) {
+	old := []*registry.Node{{Id: "a"}, {Id: "b"}}
+	neu := []*registry.Node{{Id: "b"}, {Id: "c"}}
+
+	added, removed := diffNodes(old, neu)
+	if len(added) != 1 || added[0].Id != "c" {
+		t.Errorf("Expected c added, got %+v", added)
+	}
+	if len(removed) != 1 || removed[0].Id != "a" {
+		t.Errorf("Expected a removed, got %+v", removed)
+	}
+}
+
+func TestDNSTimeout(t *testing.T) {
+	// resolver 一直没有响应
+	hung := &net.Resolver{PreferGo: true, Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}}
+	r := NewRegistry(Services(map[string][]string{"foo-rpc": {"foo.example:9000"}}),
+		Resolver(hung), registry.Timeout(100*time.Millisecond))
+	defer registry.Stop(r)
+
+	start := time.Now()
+	if _, err := r.GetService("foo-rpc"); err == nil {
+		t.Fatal("Expected lookup error")
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("Lookup took %v", d)
+	}
+}
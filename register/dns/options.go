@@ -0,0 +1,40 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"time"
+
+	registry "github.com/aka-yz/go-micro-core/register"
+)
+
+type servicesKey struct{}
+
+type intervalKey struct{}
+
+type resolverKey struct{}
+
+// Services sets the records to resolve for each service.
+// "host:port" is resolved by A/AAAA, "_service._proto.name" by SRV
+func Services(services map[string][]string) registry.Option {
+	return setOption(servicesKey{}, services)
+}
+
+// Interval sets how often the records are re-resolved
+func Interval(d time.Duration) registry.Option {
+	return setOption(intervalKey{}, d)
+}
+
+// Resolver sets a custom resolver, net.DefaultResolver is used by default
+func Resolver(r *net.Resolver) registry.Option {
+	return setOption(resolverKey{}, r)
+}
+
+func setOption(k, v interface{}) registry.Option {
+	return func(o *registry.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, k, v)
+	}
+}
@@ -0,0 +1,282 @@
+// Package dns is a registry which resolves A/AAAA/SRV records,
+// records are managed outside the process so Register is a no-op
+package dns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	registry "github.com/aka-yz/go-micro-core/register"
+	"github.com/aka-yz/go-micro-core/register/notify"
+)
+
+var (
+	defaultInterval = 30 * time.Second
+	defaultTimeout  = 5 * time.Second
+)
+
+type dnsRegistry struct {
+	opts     registry.Options
+	records  map[string][]string
+	interval time.Duration
+	resolver *net.Resolver
+
+	sync.RWMutex
+	// 已解析过的服务, 定时刷新
+	services map[string]*registry.Service
+	watchers notify.Watchers
+
+	exit     chan struct{}
+	stopOnce sync.Once
+}
+
+func (d *dnsRegistry) Register(service *registry.Service, opts ...registry.RegisterOption) error {
+	return nil
+}
+
+func (d *dnsRegistry) Deregister(service *registry.Service) error {
+	return nil
+}
+
+func (d *dnsRegistry) GetService(name string) ([]*registry.Service, error) {
+	d.RLock()
+	service, ok := d.services[name]
+	d.RUnlock()
+	if ok {
+		return []*registry.Service{registry.CopyService(service)}, nil
+	}
+
+	service, err := d.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+
+	d.Lock()
+	d.services[name] = service
+	d.Unlock()
+	return []*registry.Service{registry.CopyService(service)}, nil
+}
+
+func (d *dnsRegistry) ListServices() ([]*registry.Service, error) {
+	var services []*registry.Service
+	for name := range d.records {
+		ss, err := d.GetService(name)
+		if err != nil {
+			return nil, err
+		}
+		services = append(services, ss...)
+	}
+	return services, nil
+}
+
+func (d *dnsRegistry) Watch(service string, opts ...registry.WatchOption) (registry.Watcher, error) {
+	wo := registry.WatchOptions{
+		Service: service,
+	}
+	for _, o := range opts {
+		o(&wo)
+	}
+
+	// 保证被 watch 的服务会被定时刷新
+	if wo.Service != "" {
+		if _, err := d.GetService(wo.Service); err != nil && err != registry.ErrNotFound {
+			return nil, err
+		}
+	}
+	return d.watchers.Watch(wo), nil
+}
+
+func (d *dnsRegistry) String() string {
+	return "dns"
+}
+
+func (d *dnsRegistry) Options() registry.Options {
+	return d.opts
+}
+
+func (d *dnsRegistry) run() {
+	t := time.NewTicker(d.interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			d.refresh()
+		case <-d.exit:
+			return
+		}
+	}
+}
+
+// Stop 停止定时刷新, 所有 watcher 的 Next 返回 ErrWatcherStopped
+func (d *dnsRegistry) Stop() {
+	d.stopOnce.Do(func() {
+		close(d.exit)
+		d.watchers.Stop()
+	})
+}
+
+// refresh 重新解析所有已解析过的服务, 有变化时通知 watcher
+func (d *dnsRegistry) refresh() {
+	d.RLock()
+	names := make([]string, 0, len(d.services))
+	for name := range d.services {
+		names = append(names, name)
+	}
+	d.RUnlock()
+
+	for _, name := range names {
+		service, err := d.resolve(name)
+		if err != nil {
+			// 解析失败保留上一次的结果
+			continue
+		}
+
+		d.Lock()
+		old := d.services[name]
+		d.services[name] = service
+		d.Unlock()
+
+		added, removed := diffNodes(old.Nodes, service.Nodes)
+		if len(removed) > 0 {
+			d.sendEvent(&registry.Result{Action: registry.Delete, Service: &registry.Service{Name: name, Nodes: removed}})
+		}
+		if len(added) > 0 {
+			d.sendEvent(&registry.Result{Action: registry.Create, Service: &registry.Service{Name: name, Nodes: added}})
+		}
+	}
+}
+
+func (d *dnsRegistry) resolve(name string) (*registry.Service, error) {
+	records, ok := d.records[name]
+	if !ok || len(records) == 0 {
+		return nil, registry.ErrNotFound
+	}
+
+	timeout := d.opts.Timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	service := &registry.Service{Name: name}
+	for _, record := range records {
+		nodes, err := d.lookup(ctx, record)
+		if err != nil {
+			return nil, err
+		}
+		service.Nodes = append(service.Nodes, nodes...)
+	}
+
+	sort.Slice(service.Nodes, func(i, j int) bool {
+		return service.Nodes[i].Id < service.Nodes[j].Id
+	})
+	return service, nil
+}
+
+func (d *dnsRegistry) lookup(ctx context.Context, record string) (nodes []*registry.Node, err error) {
+	// SRV: _service._proto.name
+	if strings.HasPrefix(record, "_") {
+		_, srvs, err := d.resolver.LookupSRV(ctx, "", "", record)
+		if err != nil {
+			return nil, err
+		}
+		for _, srv := range srvs {
+			ns, err := d.lookupHost(ctx, strings.TrimSuffix(srv.Target, "."), int(srv.Port))
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, ns...)
+		}
+		return nodes, nil
+	}
+
+	host, p, err := net.SplitHostPort(record)
+	if err != nil {
+		return nil, fmt.Errorf("dns registry record:%v error:%v", record, err)
+	}
+	port, err := strconv.Atoi(p)
+	if err != nil {
+		return nil, fmt.Errorf("dns registry record:%v error:%v", record, err)
+	}
+	return d.lookupHost(ctx, host, port)
+}
+
+// lookupHost 解析 A/AAAA 记录
+func (d *dnsRegistry) lookupHost(ctx context.Context, host string, port int) (nodes []*registry.Node, err error) {
+	addrs, err := d.resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return
+	}
+
+	for _, addr := range addrs {
+		ip := addr.IP.String()
+		nodes = append(nodes, &registry.Node{
+			Id:      net.JoinHostPort(ip, strconv.Itoa(port)),
+			Address: ip,
+			Port:    port,
+		})
+	}
+	return
+}
+
+func diffNodes(old, neu []*registry.Node) (added, removed []*registry.Node) {
+	oldIds := make(map[string]bool, len(old))
+	for _, n := range old {
+		oldIds[n.Id] = true
+	}
+	newIds := make(map[string]bool, len(neu))
+	for _, n := range neu {
+		newIds[n.Id] = true
+		if !oldIds[n.Id] {
+			added = append(added, n)
+		}
+	}
+	for _, n := range old {
+		if !newIds[n.Id] {
+			removed = append(removed, n)
+		}
+	}
+	return
+}
+
+func (d *dnsRegistry) sendEvent(r *registry.Result) {
+	d.watchers.Send(r)
+}
+
+func NewRegistry(opts ...registry.Option) registry.Registry {
+	var opt registry.Options
+	for _, o := range opts {
+		o(&opt)
+	}
+
+	d := &dnsRegistry{
+		opts:     opt,
+		interval: defaultInterval,
+		resolver: net.DefaultResolver,
+		services: make(map[string]*registry.Service),
+		exit:     make(chan struct{}),
+	}
+
+	if opt.Context != nil {
+		if records, ok := opt.Context.Value(servicesKey{}).(map[string][]string); ok {
+			d.records = records
+		}
+		if interval, ok := opt.Context.Value(intervalKey{}).(time.Duration); ok && interval > 0 {
+			d.interval = interval
+		}
+		if resolver, ok := opt.Context.Value(resolverKey{}).(*net.Resolver); ok && resolver != nil {
+			d.resolver = resolver
+		}
+	}
+
+	go d.run()
+	return d
+}
@@ -8,6 +8,7 @@ import (
 	clientv3 "go.etcd.io/etcd/client/v3"
 	"path"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -16,8 +17,16 @@ type etcdv3Registry struct {
 	Client *clientv3.Client
 	opt    registry.Options
 	Ctx    context.Context
-	stop   chan bool
 	leaser clientv3.Lease
+
+	sync.Mutex
+	// registered 节点 key -> lease, 重复注册时只续约
+	registered map[string]*registration
+}
+
+type registration struct {
+	lease clientv3.LeaseID
+	value string
 }
 
 const (
@@ -42,7 +51,7 @@ func decode(val []byte) (ret *registry.Service) {
 	return
 }
 
-// Register 一个client 对应一个服务
+// Register 注册 service 的所有节点, 每个节点一个 key
 func (e *etcdv3Registry) Register(service *registry.Service, opt ...registry.RegisterOption) (err error) {
 	if len(service.Nodes) == 0 {
 		return errors.New("service nodes empty")
@@ -57,37 +66,76 @@ func (e *etcdv3Registry) Register(service *registry.Service, opt ...registry.Reg
 
 	ctx, cancel := context.WithTimeout(context.Background(), e.opt.Timeout)
 	defer cancel()
-	grantResp, err := e.leaser.Grant(ctx, int64(registerOptions.TTL.Seconds()))
-	if err != nil {
-		return err
+	for _, node := range service.Nodes {
+		if err = e.registerNode(ctx, service, node, registerOptions.TTL); err != nil {
+			return
+		}
 	}
+	return
+}
 
-	if _, err = e.leaser.KeepAliveOnce(e.Ctx, grantResp.ID); err != nil {
-		return
+func (e *etcdv3Registry) registerNode(ctx context.Context, service *registry.Service, node *registry.Node, ttl time.Duration) error {
+	key := nodePath(service.Name, node.Id)
+	s := registry.CopyService(service)
+	s.Nodes = []*registry.Node{node}
+	value := encode(s)
+
+	e.Lock()
+	reg, ok := e.registered[key]
+	e.Unlock()
+
+	// lease 还在并且内容没有变化时只续约, 避免 watcher 收到无意义的 update
+	if ok {
+		if _, err := e.leaser.KeepAliveOnce(ctx, reg.lease); err != nil {
+			ok = false
+		} else if reg.value == value {
+			return nil
+		}
 	}
 
-	_, err = e.Client.Put(ctx, nodePath(service.Name, service.Nodes[0].Id), encode(service), clientv3.WithLease(grantResp.ID))
-	if err != nil {
-		return
+	var lease clientv3.LeaseID
+	if ok {
+		lease = reg.lease
+	} else {
+		grantResp, err := e.leaser.Grant(ctx, int64(ttl.Seconds()))
+		if err != nil {
+			return err
+		}
+		lease = grantResp.ID
 	}
 
-	return
+	if _, err := e.Client.Put(ctx, key, value, clientv3.WithLease(lease)); err != nil {
+		return err
+	}
+
+	e.Lock()
+	e.registered[key] = &registration{lease: lease, value: value}
+	e.Unlock()
+	return nil
 }
 
+// Deregister 删除 service 的所有节点并释放 lease
 func (e *etcdv3Registry) Deregister(service *registry.Service) (err error) {
 	if len(service.Nodes) == 0 {
 		return errors.New("service nodes empty")
 	}
 
-	if _, err = e.Client.Delete(e.Ctx, nodePath(service.Name, service.Nodes[0].Id), clientv3.WithPrefix()); err != nil {
-		return
-	}
+	ctx, cancel := context.WithTimeout(context.Background(), e.opt.Timeout)
+	defer cancel()
+	for _, node := range service.Nodes {
+		key := nodePath(service.Name, node.Id)
+		if _, err = e.Client.Delete(ctx, key); err != nil {
+			return
+		}
 
-	if err = e.leaser.Close(); err != nil {
-		return
+		e.Lock()
+		reg, ok := e.registered[key]
+		delete(e.registered, key)
+		e.Unlock()
+		if ok {
+			_, _ = e.leaser.Revoke(ctx, reg.lease)
+		}
 	}
-
-	close(e.stop)
 	return
 }
 
@@ -128,8 +176,19 @@ func (e *etcdv3Registry) ListServices() (services []*registry.Service, err error
 }
 
 // Watch 监听服务变化
-func (e *etcdv3Registry) Watch(service string) (w registry.Watcher, err error) {
-	return newEtcdV3Watcher(e, servicePath(service)), nil
+func (e *etcdv3Registry) Watch(service string, opts ...registry.WatchOption) (w registry.Watcher, err error) {
+	wo := registry.WatchOptions{
+		Service: service,
+	}
+	for _, o := range opts {
+		o(&wo)
+	}
+
+	p := prefix
+	if wo.Service != "" {
+		p = servicePath(wo.Service) + "/"
+	}
+	return newEtcdV3Watcher(e, p, wo)
 }
 
 func (e *etcdv3Registry) String() string {
@@ -154,21 +213,13 @@ func NewRegistry(opts ...registry.Option) registry.Registry {
 		Endpoints: opt.Addrs,
 	}
 
-	ctx, cancel := context.WithCancel(context.TODO())
 	// TODO 暂时不支持TLS
 	client, _ := clientv3.New(cfg)
-	regist := &etcdv3Registry{
-		Client: client,
-		Ctx:    ctx,
-		opt:    opt,
-		leaser: clientv3.NewLease(client),
-		stop:   make(chan bool),
+	return &etcdv3Registry{
+		Client:     client,
+		Ctx:        context.Background(),
+		opt:        opt,
+		leaser:     clientv3.NewLease(client),
+		registered: make(map[string]*registration),
 	}
-
-	go func() {
-		<-regist.stop
-		cancel()
-	}()
-
-	return regist
 }
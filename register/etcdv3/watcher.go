@@ -2,54 +2,175 @@ package etcdv3
 
 import (
 	"context"
-	"errors"
-	"github.com/aka-yz/go-micro-core/configs/log"
+	"time"
+
 	registry "github.com/aka-yz/go-micro-core/register"
 	clientv3 "go.etcd.io/etcd/client/v3"
 )
 
+// 重新 watch 之前的等待时间
+var rewatchInterval = time.Second
+
 type watcher struct {
+	client *clientv3.Client
+	path   string
+	ctx    context.Context
+	cancel context.CancelFunc
+
 	watchChan clientv3.WatchChan
+	// revision 最后一个已处理事件的 revision, 断线后从 revision+1 继续
+	revision int64
+	// pending 一次 etcd 响应中还未返回的事件
+	pending []*registry.Result
+	// services key -> 节点, 用于没有 PrevKv 的删除事件和 compaction 后的重新同步
+	services map[string]*registry.Service
 }
 
-func newEtcdV3Watcher(e *etcdv3Registry, path string) registry.Watcher {
-	return &watcher{
-		watchChan: e.Client.Watch(e.Ctx, path, clientv3.WithPrefix(), clientv3.WithPrevKV()),
+func newEtcdV3Watcher(e *etcdv3Registry, path string, opts registry.WatchOptions) (registry.Watcher, error) {
+	parent := e.Ctx
+	if opts.Context != nil {
+		parent = opts.Context
+	}
+	ctx, cancel := context.WithCancel(parent)
+
+	w := &watcher{
+		client:   e.Client,
+		path:     path,
+		ctx:      ctx,
+		cancel:   cancel,
+		revision: opts.Revision,
+		services: make(map[string]*registry.Service),
 	}
+
+	// 没有指定 revision 时从当前状态开始
+	if w.revision == 0 {
+		if _, err := w.load(); err != nil {
+			cancel()
+			return nil, err
+		}
+	}
+
+	w.watch()
+	return w, nil
 }
 
-// Next 监听服务变化
-func (w *watcher) Next() (result *registry.Result, err error) {
-	for resp := range w.watchChan {
-		err = resp.Err()
-		if err != nil {
-			return
+func (w *watcher) watch() {
+	w.watchChan = w.client.Watch(clientv3.WithRequireLeader(w.ctx), w.path,
+		clientv3.WithPrefix(), clientv3.WithPrevKV(), clientv3.WithRev(w.revision+1))
+}
+
+// load 读取当前所有节点, 返回从旧状态到当前状态的变化
+func (w *watcher) load() (results []*registry.Result, err error) {
+	resp, err := w.client.Get(w.ctx, w.path, clientv3.WithPrefix())
+	if err != nil {
+		return
+	}
+
+	services := make(map[string]*registry.Service, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		service := decode(kv.Value)
+		if service == nil {
+			continue
 		}
-		for _, event := range resp.Events {
-			service := decode(event.Kv.Value)
-			var action string
-			switch event.Type {
-			case clientv3.EventTypePut:
-				action = "create"
-			case clientv3.EventTypeDelete:
-				action = "delete"
-				service = decode(event.PrevKv.Value)
+		key := string(kv.Key)
+		services[key] = service
+
+		if old, ok := w.services[key]; !ok {
+			results = append(results, &registry.Result{Action: registry.Create, Service: service, Revision: kv.ModRevision})
+		} else if encode(old) != encode(service) {
+			results = append(results, &registry.Result{Action: registry.Update, Service: service, Revision: kv.ModRevision})
+		}
+	}
+	for key, service := range w.services {
+		if _, ok := services[key]; !ok {
+			results = append(results, &registry.Result{Action: registry.Delete, Service: service, Revision: resp.Header.Revision})
+		}
+	}
+
+	w.services = services
+	w.revision = resp.Header.Revision
+	return
+}
+
+// Next 监听服务变化, 每个 etcd 事件都会返回一次
+func (w *watcher) Next() (*registry.Result, error) {
+	for {
+		if len(w.pending) > 0 {
+			result := w.pending[0]
+			w.pending = w.pending[1:]
+			return result, nil
+		}
+
+		resp, ok := <-w.watchChan
+		if w.ctx.Err() != nil {
+			return nil, registry.ErrWatcherStopped
+		}
+
+		// 需要的 revision 已经被 compact, 重新同步全量数据
+		if resp.CompactRevision > w.revision {
+			results, err := w.load()
+			if err != nil {
+				return nil, err
 			}
+			w.pending = append(w.pending, results...)
+			w.watch()
+			continue
+		}
 
-			if service == nil {
-				continue
+		if !ok || resp.Canceled || resp.Err() != nil {
+			// watch 被关闭(断线, 无 leader), 从最后的 revision 继续
+			select {
+			case <-w.ctx.Done():
+				return nil, registry.ErrWatcherStopped
+			case <-time.After(rewatchInterval):
 			}
+			w.watch()
+			continue
+		}
+
+		for _, event := range resp.Events {
+			w.handle(event)
+		}
+	}
+}
+
+func (w *watcher) handle(event *clientv3.Event) {
+	key := string(event.Kv.Key)
+	w.revision = event.Kv.ModRevision
 
-			result = &registry.Result{
-				Action:  action,
-				Service: service,
+	var result *registry.Result
+	switch event.Type {
+	case clientv3.EventTypePut:
+		service := decode(event.Kv.Value)
+		if service == nil {
+			return
+		}
+		action := registry.Update
+		if event.IsCreate() {
+			action = registry.Create
+		}
+		w.services[key] = service
+		result = &registry.Result{Action: action, Service: service, Revision: event.Kv.ModRevision}
+	case clientv3.EventTypeDelete:
+		service := w.services[key]
+		if event.PrevKv != nil {
+			if prev := decode(event.PrevKv.Value); prev != nil {
+				service = prev
 			}
+		}
+		delete(w.services, key)
+		if service == nil {
 			return
 		}
+		result = &registry.Result{Action: registry.Delete, Service: service, Revision: event.Kv.ModRevision}
+	default:
+		return
 	}
-	return nil, errors.New("not found next")
+
+	w.pending = append(w.pending, result)
 }
 
+// Stop 取消 etcd watch
 func (w *watcher) Stop() {
-	log.Info(context.TODO(), "stop the etcd watcher")
+	w.cancel()
 }
@@ -0,0 +1,41 @@
+package etcdv3
+
+import (
+	registry "github.com/aka-yz/go-micro-core/register"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"testing"
+)
+
+func TestWatcherHandle(t *testing.T) {
+	service := &registry.Service{
+		Name:  "foo-rpc",
+		Nodes: []*registry.Node{{Id: "foo-rpc-123", Address: "10.0.0.1", Port: 9999}},
+	}
+	key := []byte(nodePath(service.Name, service.Nodes[0].Id))
+	val := []byte(encode(service))
+
+	w := &watcher{services: make(map[string]*registry.Service)}
+	// several events in one etcd response are all delivered
+	events := []*clientv3.Event{
+		{Type: clientv3.EventTypePut, Kv: &mvccpb.KeyValue{Key: key, Value: val, CreateRevision: 2, ModRevision: 2}},
+		{Type: clientv3.EventTypePut, Kv: &mvccpb.KeyValue{Key: key, Value: val, CreateRevision: 2, ModRevision: 3}},
+		{Type: clientv3.EventTypeDelete, Kv: &mvccpb.KeyValue{Key: key, ModRevision: 4}},
+	}
+	for _, event := range events {
+		w.handle(event)
+	}
+
+	expected := []registry.Action{registry.Create, registry.Update, registry.Delete}
+	if len(w.pending) != len(expected) {
+		t.Fatalf("Expected %d results, got %d", len(expected), len(w.pending))
+	}
+	for i, action := range expected {
+		if w.pending[i].Action != action || w.pending[i].Service.Name != service.Name {
+			t.Errorf("Expected %v for event %d, got %+v", action, i, w.pending[i])
+		}
+	}
+	if w.revision != 4 {
+		t.Errorf("Expected revision 4, got %d", w.revision)
+	}
+}
@@ -0,0 +1,306 @@
+package mdns
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	registry "github.com/aka-yz/go-micro-core/register"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	serviceType = "_gomicro._tcp"
+
+	txtService  = "service"
+	txtVersion  = "version"
+	txtId       = "id"
+	txtAddress  = "address"
+	txtNodeMD   = "md."
+	txtServerMD = "smd."
+	// txtEndpoint service.Endpoints 的 json 按顺序拆分到 ep.0, ep.1 ...
+	txtEndpoint = "ep."
+
+	// endpointChunk 每条 txt 中 endpoints json 的长度, 加上 key 不超过 255
+	endpointChunk = 240
+	// maxEndpointsSize endpoints json 的上限, 使整个响应不超过 mdns 建议的 9000 字节,
+	// 超过时去掉 request/response, 仍然超过则不发布 endpoints
+	maxEndpointsSize = 6000
+)
+
+// entry 一个节点在 mdns 中的记录: PTR + SRV + TXT + A/AAAA
+type entry struct {
+	domain   string
+	instance string
+	host     string
+	// service 只包含当前节点
+	service *registry.Service
+	ttl     uint32
+}
+
+func typeName(domain string) string {
+	return serviceType + "." + domain + "."
+}
+
+// label 将 node id 转换成合法的 dns label
+func label(s string) string {
+	l := []byte(s)
+	for i, c := range l {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+			l[i] = '-'
+		}
+	}
+	if len(l) > 63 {
+		l = l[:63]
+	}
+	return string(l)
+}
+
+func newEntry(domain string, service *registry.Service, node *registry.Node, ttl uint32) *entry {
+	s := registry.CopyService(service)
+	s.Nodes = []*registry.Node{node}
+	return &entry{
+		domain:   domain,
+		instance: label(node.Id) + "." + typeName(domain),
+		host:     label(node.Id) + "." + domain + ".",
+		service:  s,
+		ttl:      ttl,
+	}
+}
+
+func (e *entry) node() *registry.Node {
+	return e.service.Nodes[0]
+}
+
+func (e *entry) txt() (txt []string, err error) {
+	txt = append(txt,
+		txtService+"="+e.service.Name,
+		txtVersion+"="+e.service.Version,
+		txtId+"="+e.node().Id,
+	)
+	if net.ParseIP(e.node().Address) == nil {
+		txt = append(txt, txtAddress+"="+e.node().Address)
+	}
+	for k, v := range e.service.Metadata {
+		txt = append(txt, txtServerMD+k+"="+v)
+	}
+	for k, v := range e.node().Metadata {
+		txt = append(txt, txtNodeMD+k+"="+v)
+	}
+	ep, err := encodeEndpoints(e.service.Endpoints)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; len(ep) > 0; i++ {
+		n := endpointChunk
+		if n > len(ep) {
+			n = len(ep)
+		}
+		txt = append(txt, txtEndpoint+strconv.Itoa(i)+"="+ep[:n])
+		ep = ep[n:]
+	}
+
+	for _, t := range txt {
+		if len(t) > 255 {
+			return nil, fmt.Errorf("mdns txt record too long: %v", t)
+		}
+	}
+	return
+}
+
+func (e *entry) records() (rs []dnsmessage.Resource, err error) {
+	instance, err := dnsmessage.NewName(e.instance)
+	if err != nil {
+		return
+	}
+	host, err := dnsmessage.NewName(e.host)
+	if err != nil {
+		return
+	}
+	ptr, err := dnsmessage.NewName(typeName(e.domain))
+	if err != nil {
+		return
+	}
+	txt, err := e.txt()
+	if err != nil {
+		return
+	}
+
+	rs = append(rs,
+		dnsmessage.Resource{
+			Header: dnsmessage.ResourceHeader{Name: ptr, Type: dnsmessage.TypePTR, Class: dnsmessage.ClassINET, TTL: e.ttl},
+			Body:   &dnsmessage.PTRResource{PTR: instance},
+		},
+		dnsmessage.Resource{
+			Header: dnsmessage.ResourceHeader{Name: instance, Type: dnsmessage.TypeSRV, Class: dnsmessage.ClassINET, TTL: e.ttl},
+			Body:   &dnsmessage.SRVResource{Port: uint16(e.node().Port), Target: host},
+		},
+		dnsmessage.Resource{
+			Header: dnsmessage.ResourceHeader{Name: instance, Type: dnsmessage.TypeTXT, Class: dnsmessage.ClassINET, TTL: e.ttl},
+			Body:   &dnsmessage.TXTResource{TXT: txt},
+		},
+	)
+
+	ip := net.ParseIP(e.node().Address)
+	if ip4 := ip.To4(); ip4 != nil {
+		a := dnsmessage.AResource{}
+		copy(a.A[:], ip4)
+		rs = append(rs, dnsmessage.Resource{
+			Header: dnsmessage.ResourceHeader{Name: host, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: e.ttl},
+			Body:   &a,
+		})
+	} else if ip != nil {
+		aaaa := dnsmessage.AAAAResource{}
+		copy(aaaa.AAAA[:], ip.To16())
+		rs = append(rs, dnsmessage.Resource{
+			Header: dnsmessage.ResourceHeader{Name: host, Type: dnsmessage.TypeAAAA, Class: dnsmessage.ClassINET, TTL: e.ttl},
+			Body:   &aaaa,
+		})
+	}
+	return
+}
+
+func encodeEndpoints(endpoints []*registry.Endpoint) (string, error) {
+	if len(endpoints) == 0 {
+		return "", nil
+	}
+	b, err := json.Marshal(endpoints)
+	if err != nil || len(b) <= maxEndpointsSize {
+		return string(b), err
+	}
+
+	brief := make([]*registry.Endpoint, len(endpoints))
+	for i, ep := range endpoints {
+		c := *ep
+		c.Request, c.Response = nil, nil
+		brief[i] = &c
+	}
+	if b, err = json.Marshal(brief); err != nil || len(b) <= maxEndpointsSize {
+		return string(b), err
+	}
+	return "", nil
+}
+
+// decodeEndpoints 按序号拼接 ep.N 后解析, 不完整时忽略
+func decodeEndpoints(chunks map[int]string) []*registry.Endpoint {
+	if len(chunks) == 0 {
+		return nil
+	}
+	idx := make([]int, 0, len(chunks))
+	for i := range chunks {
+		idx = append(idx, i)
+	}
+	sort.Ints(idx)
+	var b strings.Builder
+	for n, i := range idx {
+		if n != i {
+			return nil
+		}
+		b.WriteString(chunks[i])
+	}
+	var endpoints []*registry.Endpoint
+	if err := json.Unmarshal([]byte(b.String()), &endpoints); err != nil {
+		return nil
+	}
+	return endpoints
+}
+
+// parseEntries 从 mdns 响应中解析出所有节点
+func parseEntries(msg *dnsmessage.Message, domain string) (entries []*entry) {
+	var (
+		ptrs  []string
+		srvs  = make(map[string]dnsmessage.Resource)
+		txts  = make(map[string]*dnsmessage.TXTResource)
+		addrs = make(map[string]net.IP)
+	)
+
+	records := append(append([]dnsmessage.Resource{}, msg.Answers...), msg.Additionals...)
+	for _, r := range records {
+		name := strings.ToLower(r.Header.Name.String())
+		switch body := r.Body.(type) {
+		case *dnsmessage.PTRResource:
+			if name == strings.ToLower(typeName(domain)) {
+				ptrs = append(ptrs, strings.ToLower(body.PTR.String()))
+			}
+		case *dnsmessage.SRVResource:
+			srvs[name] = r
+		case *dnsmessage.TXTResource:
+			txts[name] = body
+		case *dnsmessage.AResource:
+			addrs[name] = net.IP(body.A[:])
+		case *dnsmessage.AAAAResource:
+			if _, ok := addrs[name]; !ok {
+				addrs[name] = net.IP(body.AAAA[:])
+			}
+		}
+	}
+
+	for _, instance := range ptrs {
+		srv, ok := srvs[instance]
+		if !ok {
+			continue
+		}
+		txt, ok := txts[instance]
+		if !ok {
+			continue
+		}
+
+		body := srv.Body.(*dnsmessage.SRVResource)
+		host := strings.ToLower(body.Target.String())
+		service := &registry.Service{}
+		node := &registry.Node{Port: int(body.Port)}
+		if ip, ok := addrs[host]; ok {
+			node.Address = ip.String()
+		}
+
+		endpoints := make(map[int]string)
+		for _, kv := range txt.TXT {
+			parts := strings.SplitN(kv, "=", 2)
+			if len(parts) != 2 {
+				continue
+			}
+			k, v := parts[0], parts[1]
+			switch {
+			case k == txtService:
+				service.Name = v
+			case k == txtVersion:
+				service.Version = v
+			case k == txtId:
+				node.Id = v
+			case k == txtAddress:
+				node.Address = v
+			case strings.HasPrefix(k, txtServerMD):
+				if service.Metadata == nil {
+					service.Metadata = make(map[string]string)
+				}
+				service.Metadata[strings.TrimPrefix(k, txtServerMD)] = v
+			case strings.HasPrefix(k, txtNodeMD):
+				if node.Metadata == nil {
+					node.Metadata = make(map[string]string)
+				}
+				node.Metadata[strings.TrimPrefix(k, txtNodeMD)] = v
+			case strings.HasPrefix(k, txtEndpoint):
+				if i, err := strconv.Atoi(strings.TrimPrefix(k, txtEndpoint)); err == nil {
+					endpoints[i] = v
+				}
+			}
+		}
+		service.Endpoints = decodeEndpoints(endpoints)
+
+		if service.Name == "" || node.Id == "" {
+			continue
+		}
+		service.Nodes = []*registry.Node{node}
+		entries = append(entries, &entry{
+			domain:   domain,
+			instance: instance,
+			host:     host,
+			service:  service,
+			ttl:      srv.Header.TTL,
+		})
+	}
+	return
+}
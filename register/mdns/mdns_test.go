@@ -0,0 +1,159 @@
+package mdns
+
+import (
+	"errors"
+	"fmt"
+	registry "github.com/aka-yz/go-micro-core/register"
+	"golang.org/x/net/dns/dnsmessage"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newTestRegistry(t *testing.T) registry.Registry {
+	ifi, err := net.InterfaceByName("lo")
+	if err != nil {
+		t.Skipf("loopback interface not found: %v", err)
+	}
+	return NewRegistry(registry.Addrs("224.0.0.251:25353"), registry.Timeout(200*time.Millisecond), Interface(ifi), Domain("test"))
+}
+
+func TestMDNSRegistry(t *testing.T) {
+	a, b := newTestRegistry(t), newTestRegistry(t)
+
+	w, err := b.Watch("foo-rpc")
+	if err != nil {
+		t.Skipf("multicast not available: %v", err)
+	}
+	defer w.Stop()
+
+	service := &registry.Service{
+		Name:    "foo-rpc",
+		Version: "1.0.1",
+		Nodes: []*registry.Node{
+			{
+				Id:       "foo-rpc-123",
+				Address:  "127.0.0.1",
+				Port:     9999,
+				Metadata: map[string]string{"zone": "a"},
+			},
+		},
+	}
+	if err = a.Register(service); err != nil {
+		t.Fatalf("Unexpected register error: %v", err)
+	}
+
+	res, err := next(w)
+	if err != nil {
+		t.Fatalf("Unexpected next error: %v", err)
+	}
+	if res.Action != registry.Create || res.Service.Nodes[0].Id != "foo-rpc-123" {
+		t.Fatalf("Unexpected result %+v", res)
+	}
+
+	services, err := b.GetService("foo-rpc")
+	if err != nil {
+		t.Fatalf("Unexpected error getting service: %v", err)
+	}
+	if len(services) != 1 || len(services[0].Nodes) != 1 {
+		t.Fatalf("Expected 1 node, got %+v", services)
+	}
+	node := services[0].Nodes[0]
+	if services[0].Version != "1.0.1" || node.Address != "127.0.0.1" || node.Port != 9999 || node.Metadata["zone"] != "a" {
+		t.Fatalf("Unexpected service %+v node %+v", services[0], node)
+	}
+
+	if err = a.Deregister(service); err != nil {
+		t.Fatalf("Unexpected deregister error: %v", err)
+	}
+	res, err = next(w)
+	if err != nil {
+		t.Fatalf("Unexpected next error: %v", err)
+	}
+	if res.Action != registry.Delete {
+		t.Fatalf("Unexpected result %+v", res)
+	}
+
+	if _, err = b.GetService("foo-rpc"); err != registry.ErrNotFound {
+		t.Fatalf("Expected not found, got %v", err)
+	}
+
+	// Stop 发送 goodbye 并结束 watcher
+	if err = a.Register(service); err != nil {
+		t.Fatalf("Unexpected register error: %v", err)
+	}
+	if res, err = next(w); err != nil || res.Action != registry.Create {
+		t.Fatalf("Unexpected result %+v error %v", res, err)
+	}
+	registry.Stop(a)
+	if res, err = next(w); err != nil || res.Action != registry.Delete {
+		t.Fatalf("Unexpected result %+v error %v", res, err)
+	}
+	if err = a.Register(service); err != errStopped {
+		t.Fatalf("Expected stopped, got %v", err)
+	}
+	registry.Stop(b)
+	if _, err = w.Next(); err != registry.ErrWatcherStopped {
+		t.Fatalf("Expected watcher stopped, got %v", err)
+	}
+}
+
+func next(w registry.Watcher) (*registry.Result, error) {
+	type result struct {
+		res *registry.Result
+		err error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		res, err := w.Next()
+		ch <- result{res, err}
+	}()
+
+	select {
+	case r := <-ch:
+		return r.res, r.err
+	case <-time.After(2 * time.Second):
+		w.Stop()
+		return nil, errors.New("watch timeout")
+	}
+}
+
+func TestEntryEndpoints(t *testing.T) {
+	service := &registry.Service{Name: "foo-rpc", Version: "1.0.1"}
+	for i := 0; i < 20; i++ {
+		service.Endpoints = append(service.Endpoints, &registry.Endpoint{
+			Name:     fmt.Sprintf("/foo.Foo/Method%d", i),
+			Protocol: registry.ProtocolGRPC,
+			Port:     9999,
+			Request:  &registry.Value{Name: "Request", Type: "Request", Values: []*registry.Value{{Name: "id", Type: "int64"}}},
+		})
+	}
+	node := &registry.Node{Id: "foo-rpc-123", Address: "127.0.0.1", Port: 9999}
+
+	parse := func(s *registry.Service) *registry.Service {
+		rs, err := newEntry("test", s, node, 120).records()
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries := parseEntries(&dnsmessage.Message{Answers: rs}, "test")
+		if len(entries) != 1 {
+			t.Fatalf("Expected 1 entry, got %d", len(entries))
+		}
+		return entries[0].service
+	}
+
+	// endpoints 拆分到多条 txt 后还原
+	if got := parse(service); !reflect.DeepEqual(got.Endpoints, service.Endpoints) {
+		t.Fatalf("Unexpected endpoints %d", len(got.Endpoints))
+	}
+
+	// 超过上限时去掉 request/response
+	for i := 0; i < 60; i++ {
+		service.Endpoints = append(service.Endpoints, service.Endpoints[0])
+	}
+	got := parse(service)
+	if len(got.Endpoints) != len(service.Endpoints) || got.Endpoints[0].Request != nil || got.Endpoints[0].Name != "/foo.Foo/Method0" {
+		t.Fatalf("Unexpected endpoints %d %+v", len(got.Endpoints), got.Endpoints[0])
+	}
+}
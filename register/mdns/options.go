@@ -0,0 +1,39 @@
+package mdns
+
+import (
+	"context"
+	"net"
+
+	registry "github.com/aka-yz/go-micro-core/register"
+)
+
+type domainKey struct{}
+
+type portKey struct{}
+
+type interfaceKey struct{}
+
+// Domain sets the mdns domain, "local" by default
+func Domain(d string) registry.Option {
+	return setOption(domainKey{}, d)
+}
+
+// Port sets the multicast port, 5353 by default
+func Port(p int) registry.Option {
+	return setOption(portKey{}, p)
+}
+
+// Interface sets the network interface used to send and receive multicast,
+// the system default is used when not set
+func Interface(ifi *net.Interface) registry.Option {
+	return setOption(interfaceKey{}, ifi)
+}
+
+func setOption(k, v interface{}) registry.Option {
+	return func(o *registry.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, k, v)
+	}
+}
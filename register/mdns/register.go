@@ -0,0 +1,467 @@
+// Package mdns is a zero-dependency registry which announces and browses
+// nodes over multicast DNS-SD, for local multi-service development
+package mdns
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	registry "github.com/aka-yz/go-micro-core/register"
+	"github.com/aka-yz/go-micro-core/register/notify"
+	"golang.org/x/net/dns/dnsmessage"
+	"golang.org/x/net/ipv4"
+)
+
+var (
+	defaultDomain  = "local"
+	defaultPort    = 5353
+	defaultTTL     = 30 * time.Second
+	defaultTimeout = 100 * time.Millisecond
+
+	mdnsGroup = net.IPv4(224, 0, 0, 251)
+
+	errStopped = errors.New("mdns registry stopped")
+)
+
+type mdnsRegistry struct {
+	opts   registry.Options
+	domain string
+	group  *net.UDPAddr
+	ifi    *net.Interface
+
+	once sync.Once
+	err  error
+	// conn 监听组播: 查询 + 其他节点的广播
+	conn   *net.UDPConn
+	sender *net.UDPConn
+
+	sync.RWMutex
+	// local 当前进程注册的节点
+	local map[string]*entry
+	// remote 监听到的节点, 用于 watch
+	remote   map[string]*remoteEntry
+	watchers notify.Watchers
+
+	exit     chan struct{}
+	stopOnce sync.Once
+}
+
+type remoteEntry struct {
+	*entry
+	expire time.Time
+}
+
+func (m *mdnsRegistry) start() error {
+	select {
+	case <-m.exit:
+		return errStopped
+	default:
+	}
+	m.once.Do(func() {
+		if m.conn, m.err = net.ListenMulticastUDP("udp4", m.ifi, m.group); m.err != nil {
+			return
+		}
+		if m.sender, m.err = m.newConn(); m.err != nil {
+			return
+		}
+		go m.listen()
+		go m.expire()
+	})
+	return m.err
+}
+
+func (m *mdnsRegistry) newConn() (*net.UDPConn, error) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4zero})
+	if err != nil {
+		return nil, err
+	}
+
+	p := ipv4.NewPacketConn(conn)
+	if m.ifi != nil {
+		if err = p.SetMulticastInterface(m.ifi); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	_ = p.SetMulticastLoopback(true)
+	_ = p.SetMulticastTTL(255)
+	return conn, nil
+}
+
+func (m *mdnsRegistry) listen() {
+	buf := make([]byte, 65536)
+	for {
+		n, from, err := m.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+
+		var msg dnsmessage.Message
+		if err = msg.Unpack(buf[:n]); err != nil {
+			continue
+		}
+
+		if msg.Header.Response {
+			m.handleResponse(&msg)
+		} else {
+			m.handleQuery(&msg, from)
+		}
+	}
+}
+
+// handleQuery 回应对服务类型的 PTR 查询
+func (m *mdnsRegistry) handleQuery(msg *dnsmessage.Message, from *net.UDPAddr) {
+	var answers []dnsmessage.Resource
+	for _, q := range msg.Questions {
+		if q.Type != dnsmessage.TypePTR && q.Type != dnsmessage.TypeALL {
+			continue
+		}
+		if !strings.EqualFold(q.Name.String(), typeName(m.domain)) {
+			continue
+		}
+
+		m.RLock()
+		for _, e := range m.local {
+			if rs, err := e.records(); err == nil {
+				answers = append(answers, rs...)
+			}
+		}
+		m.RUnlock()
+		break
+	}
+
+	if len(answers) == 0 {
+		return
+	}
+
+	resp := &dnsmessage.Message{
+		Header:  dnsmessage.Header{Response: true, Authoritative: true},
+		Answers: answers,
+	}
+	to := m.group
+	// legacy unicast: 查询方不是从 mdns 端口发出, 直接单播回复
+	if from.Port != m.group.Port {
+		resp.Header.ID = msg.Header.ID
+		resp.Questions = msg.Questions
+		to = from
+	}
+	_ = m.send(resp, to)
+}
+
+// handleResponse 处理其他节点的广播, 通知 watcher
+func (m *mdnsRegistry) handleResponse(msg *dnsmessage.Message) {
+	for _, e := range parseEntries(msg, m.domain) {
+		m.Lock()
+		old, ok := m.remote[e.instance]
+		if e.ttl == 0 {
+			delete(m.remote, e.instance)
+		} else {
+			m.remote[e.instance] = &remoteEntry{entry: e, expire: time.Now().Add(time.Duration(e.ttl) * time.Second)}
+		}
+		m.Unlock()
+
+		switch {
+		case e.ttl == 0 && ok:
+			m.sendEvent(&registry.Result{Action: registry.Delete, Service: e.service})
+		case e.ttl == 0:
+		case !ok:
+			m.sendEvent(&registry.Result{Action: registry.Create, Service: e.service})
+		case !reflect.DeepEqual(old.service, e.service):
+			m.sendEvent(&registry.Result{Action: registry.Update, Service: e.service})
+		}
+	}
+}
+
+// expire 节点没有发送 goodbye 就下线时, 在 ttl 过期后通知 watcher
+func (m *mdnsRegistry) expire() {
+	t := time.NewTicker(time.Second)
+	defer t.Stop()
+
+	for {
+		var now time.Time
+		select {
+		case now = <-t.C:
+		case <-m.exit:
+			return
+		}
+
+		var expired []*remoteEntry
+		m.Lock()
+		for instance, e := range m.remote {
+			if now.After(e.expire) {
+				expired = append(expired, e)
+				delete(m.remote, instance)
+			}
+		}
+		m.Unlock()
+
+		for _, e := range expired {
+			m.sendEvent(&registry.Result{Action: registry.Delete, Service: e.service})
+		}
+	}
+}
+
+func (m *mdnsRegistry) send(msg *dnsmessage.Message, to *net.UDPAddr) error {
+	b, err := msg.Pack()
+	if err != nil {
+		return err
+	}
+	_, err = m.sender.WriteToUDP(b, to)
+	return err
+}
+
+func (m *mdnsRegistry) announce(records []dnsmessage.Resource) error {
+	return m.send(&dnsmessage.Message{
+		Header:  dnsmessage.Header{Response: true, Authoritative: true},
+		Answers: records,
+	}, m.group)
+}
+
+func (m *mdnsRegistry) Register(service *registry.Service, opts ...registry.RegisterOption) error {
+	if len(service.Nodes) == 0 {
+		return errors.New("service nodes empty")
+	}
+
+	options := registry.RegisterOptions{
+		TTL: defaultTTL,
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+
+	if err := m.start(); err != nil {
+		return err
+	}
+
+	var records []dnsmessage.Resource
+	m.Lock()
+	for _, node := range service.Nodes {
+		e := newEntry(m.domain, service, node, uint32(options.TTL.Seconds()))
+		rs, err := e.records()
+		if err != nil {
+			m.Unlock()
+			return err
+		}
+		m.local[e.instance] = e
+		records = append(records, rs...)
+	}
+	m.Unlock()
+
+	return m.announce(records)
+}
+
+func (m *mdnsRegistry) Deregister(service *registry.Service) error {
+	if len(service.Nodes) == 0 {
+		return errors.New("service nodes empty")
+	}
+
+	if err := m.start(); err != nil {
+		return err
+	}
+
+	// goodbye: ttl 为 0 的记录
+	var records []dnsmessage.Resource
+	m.Lock()
+	for _, node := range service.Nodes {
+		e := newEntry(m.domain, service, node, 0)
+		delete(m.local, e.instance)
+		if rs, err := e.records(); err == nil {
+			records = append(records, rs...)
+		}
+	}
+	m.Unlock()
+
+	return m.announce(records)
+}
+
+// browse 发送 PTR 查询, 在超时时间内收集所有节点的回复
+func (m *mdnsRegistry) browse() (entries []*entry, err error) {
+	conn, err := m.newConn()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	name, err := dnsmessage.NewName(typeName(m.domain))
+	if err != nil {
+		return
+	}
+	query := &dnsmessage.Message{
+		Questions: []dnsmessage.Question{{Name: name, Type: dnsmessage.TypePTR, Class: dnsmessage.ClassINET}},
+	}
+	b, err := query.Pack()
+	if err != nil {
+		return
+	}
+	if _, err = conn.WriteToUDP(b, m.group); err != nil {
+		return
+	}
+
+	timeout := m.opts.Timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+	if err = conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return
+	}
+
+	seen := make(map[string]bool)
+	buf := make([]byte, 65536)
+	for {
+		n, _, rerr := conn.ReadFromUDP(buf)
+		if rerr != nil {
+			if ne, ok := rerr.(net.Error); ok && ne.Timeout() {
+				return entries, nil
+			}
+			return nil, rerr
+		}
+
+		var msg dnsmessage.Message
+		if err = msg.Unpack(buf[:n]); err != nil || !msg.Header.Response {
+			continue
+		}
+		for _, e := range parseEntries(&msg, m.domain) {
+			if e.ttl == 0 || seen[e.instance] {
+				continue
+			}
+			seen[e.instance] = true
+			entries = append(entries, e)
+		}
+	}
+}
+
+func (m *mdnsRegistry) GetService(name string) ([]*registry.Service, error) {
+	entries, err := m.browse()
+	if err != nil {
+		return nil, err
+	}
+
+	var services []*registry.Service
+	for _, e := range entries {
+		if e.service.Name == name {
+			services = registry.Merge(services, []*registry.Service{e.service})
+		}
+	}
+
+	if len(services) == 0 {
+		return nil, registry.ErrNotFound
+	}
+	return services, nil
+}
+
+func (m *mdnsRegistry) ListServices() ([]*registry.Service, error) {
+	entries, err := m.browse()
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string][]*registry.Service)
+	for _, e := range entries {
+		byName[e.service.Name] = registry.Merge(byName[e.service.Name], []*registry.Service{e.service})
+	}
+
+	var services []*registry.Service
+	for _, ss := range byName {
+		services = append(services, ss...)
+	}
+	return services, nil
+}
+
+func (m *mdnsRegistry) Watch(service string, opts ...registry.WatchOption) (registry.Watcher, error) {
+	wo := registry.WatchOptions{
+		Service: service,
+	}
+	for _, o := range opts {
+		o(&wo)
+	}
+
+	if err := m.start(); err != nil {
+		return nil, err
+	}
+
+	return m.watchers.Watch(wo), nil
+}
+
+func (m *mdnsRegistry) sendEvent(r *registry.Result) {
+	m.watchers.Send(r)
+}
+
+// Stop 对本进程注册的节点发送 goodbye, 关闭组播连接和后台 goroutine,
+// 所有 watcher 的 Next 返回 ErrWatcherStopped
+func (m *mdnsRegistry) Stop() {
+	m.stopOnce.Do(func() {
+		close(m.exit)
+		// 没有 start 过时之后也不再 start
+		m.once.Do(func() { m.err = errStopped })
+
+		m.Lock()
+		var records []dnsmessage.Resource
+		for instance, e := range m.local {
+			if rs, err := newEntry(m.domain, e.service, e.node(), 0).records(); err == nil {
+				records = append(records, rs...)
+			}
+			delete(m.local, instance)
+		}
+		m.Unlock()
+		m.watchers.Stop()
+
+		if m.sender != nil {
+			if len(records) > 0 {
+				_ = m.announce(records)
+			}
+			m.sender.Close()
+		}
+		if m.conn != nil {
+			m.conn.Close()
+		}
+	})
+}
+
+func (m *mdnsRegistry) String() string {
+	return "mdns"
+}
+
+func (m *mdnsRegistry) Options() registry.Options {
+	return m.opts
+}
+
+func NewRegistry(opts ...registry.Option) registry.Registry {
+	var opt registry.Options
+	for _, o := range opts {
+		o(&opt)
+	}
+
+	m := &mdnsRegistry{
+		opts:   opt,
+		domain: defaultDomain,
+		group:  &net.UDPAddr{IP: mdnsGroup, Port: defaultPort},
+		local:  make(map[string]*entry),
+		remote: make(map[string]*remoteEntry),
+		exit:   make(chan struct{}),
+	}
+
+	// Addrs 为组播地址, 如 224.0.0.251:5353
+	if len(opt.Addrs) > 0 {
+		if addr, err := net.ResolveUDPAddr("udp4", opt.Addrs[0]); err == nil && addr.IP.IsMulticast() {
+			m.group = addr
+		}
+	}
+
+	if opt.Context != nil {
+		if domain, ok := opt.Context.Value(domainKey{}).(string); ok && domain != "" {
+			m.domain = strings.Trim(domain, ".")
+		}
+		if port, ok := opt.Context.Value(portKey{}).(int); ok && port > 0 {
+			m.group.Port = port
+		}
+		if ifi, ok := opt.Context.Value(interfaceKey{}).(*net.Interface); ok {
+			m.ifi = ifi
+		}
+	}
+
+	return m
+}
@@ -87,10 +87,13 @@ func (m *mockRegistry) Deregister(s *registry.Service) error {
 	return nil
 }
 
-func (m *mockRegistry) Watch(name string) (registry.Watcher, error) {
+func (m *mockRegistry) Watch(name string, opts ...registry.WatchOption) (registry.Watcher, error) {
 	wopts := registry.WatchOptions{
 		Service: name,
 	}
+	for _, o := range opts {
+		o(&wopts)
+	}
 	return &mockWatcher{exit: make(chan bool), opts: wopts}, nil
 }
 
@@ -1,7 +1,6 @@
 package mock
 
 import (
-	"errors"
 	registry "github.com/aka-yz/go-micro-core/register"
 )
 
@@ -14,7 +13,7 @@ func (m *mockWatcher) Next() (*registry.Result, error) {
 	// not implement so we just block until exit
 	select {
 	case <-m.exit:
-		return nil, errors.New("watcher stopped")
+		return nil, registry.ErrWatcherStopped
 	}
 }
 
@@ -0,0 +1,153 @@
+// Package notify fans registry results out to in-process watchers,
+// shared by the registries which produce events themselves (static, dns, mdns)
+package notify
+
+import (
+	"sync"
+
+	registry "github.com/aka-yz/go-micro-core/register"
+	"github.com/aka-yz/go-micro-core/utils/uuid"
+)
+
+// Watcher is a registry.Watcher fed by Watchers.Send, results are queued
+// until Next reads them so a slow reader never blocks the sender
+type Watcher struct {
+	id string
+	wo registry.WatchOptions
+
+	mu    sync.Mutex
+	queue []*registry.Result
+	// wake 有新的事件时非阻塞写入
+	wake chan struct{}
+	exit chan bool
+	once sync.Once
+}
+
+// NewWatcher 创建 watcher, wo.Context 结束时自动 Stop
+func NewWatcher(wo registry.WatchOptions) *Watcher {
+	w := &Watcher{
+		id:   uuid.New(),
+		wo:   wo,
+		wake: make(chan struct{}, 1),
+		exit: make(chan bool),
+	}
+
+	if wo.Context != nil {
+		go func() {
+			select {
+			case <-wo.Context.Done():
+				w.Stop()
+			case <-w.exit:
+			}
+		}()
+	}
+	return w
+}
+
+func (w *Watcher) Next() (*registry.Result, error) {
+	for {
+		select {
+		case <-w.exit:
+			return nil, registry.ErrWatcherStopped
+		default:
+		}
+
+		w.mu.Lock()
+		if len(w.queue) > 0 {
+			r := w.queue[0]
+			w.queue[0] = nil
+			w.queue = w.queue[1:]
+			w.mu.Unlock()
+			if !w.wants(r) {
+				continue
+			}
+			return r, nil
+		}
+		w.mu.Unlock()
+
+		select {
+		case <-w.wake:
+		case <-w.exit:
+			return nil, registry.ErrWatcherStopped
+		}
+	}
+}
+
+func (w *Watcher) Stop() {
+	w.once.Do(func() {
+		close(w.exit)
+		w.mu.Lock()
+		w.queue = nil
+		w.mu.Unlock()
+	})
+}
+
+// push 放入队列, watcher 已经停止时返回 false
+func (w *Watcher) push(r *registry.Result) bool {
+	select {
+	case <-w.exit:
+		return false
+	default:
+	}
+	w.mu.Lock()
+	w.queue = append(w.queue, r)
+	w.mu.Unlock()
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+func (w *Watcher) wants(r *registry.Result) bool {
+	return len(w.wo.Service) == 0 || w.wo.Service == r.Service.Name
+}
+
+// Watchers 一组 watcher, Send 把事件发给所有关注该服务的 watcher
+type Watchers struct {
+	mu       sync.RWMutex
+	watchers map[string]*Watcher
+}
+
+// Watch 创建并加入一个 watcher
+func (ws *Watchers) Watch(wo registry.WatchOptions) *Watcher {
+	w := NewWatcher(wo)
+	ws.mu.Lock()
+	if ws.watchers == nil {
+		ws.watchers = make(map[string]*Watcher)
+	}
+	ws.watchers[w.id] = w
+	ws.mu.Unlock()
+	return w
+}
+
+// Send 把事件放入每个 watcher 的队列, 不阻塞也不丢弃事件, 可以在网络读取或刷新的
+// goroutine 中调用. 不读取的 watcher 只会让自己的队列变长
+func (ws *Watchers) Send(r *registry.Result) {
+	ws.mu.RLock()
+	watchers := make([]*Watcher, 0, len(ws.watchers))
+	for _, w := range ws.watchers {
+		if w.wants(r) {
+			watchers = append(watchers, w)
+		}
+	}
+	ws.mu.RUnlock()
+
+	for _, w := range watchers {
+		if !w.push(r) {
+			ws.mu.Lock()
+			delete(ws.watchers, w.id)
+			ws.mu.Unlock()
+		}
+	}
+}
+
+// Stop 停止所有 watcher
+func (ws *Watchers) Stop() {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	for id, w := range ws.watchers {
+		w.Stop()
+		delete(ws.watchers, id)
+	}
+}
@@ -0,0 +1,52 @@
+package notify
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	registry "github.com/aka-yz/go-micro-core/register"
+)
+
+func TestSendNeverBlocks(t *testing.T) {
+	var ws Watchers
+	stalled := ws.Watch(registry.WatchOptions{})
+	active := ws.Watch(registry.WatchOptions{Service: "foo"})
+
+	// stalled 一直不读取, Send 仍然立即返回
+	const n = 1000
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < n; i++ {
+			ws.Send(&registry.Result{Action: registry.Update, Service: &registry.Service{Name: "foo", Version: fmt.Sprint(i)}})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Send blocked by a watcher which never reads")
+	}
+
+	// 事件不丢弃, 按顺序读取
+	for i := 0; i < n; i++ {
+		r, err := active.Next()
+		if err != nil || r.Service.Version != fmt.Sprint(i) {
+			t.Fatalf("event %d: %+v %v", i, r, err)
+		}
+	}
+	if r, err := stalled.Next(); err != nil || r.Service.Version != "0" {
+		t.Fatalf("stalled first event: %+v %v", r, err)
+	}
+
+	// 停止的 watcher 不再接收, Next 返回 ErrWatcherStopped
+	stalled.Stop()
+	ws.Send(&registry.Result{Action: registry.Delete, Service: &registry.Service{Name: "foo"}})
+	if _, err := stalled.Next(); err != registry.ErrWatcherStopped {
+		t.Fatalf("Expected watcher stopped, got %v", err)
+	}
+	ws.Stop()
+	if _, err := active.Next(); err != registry.ErrWatcherStopped {
+		t.Fatalf("Expected watcher stopped, got %v", err)
+	}
+}
@@ -61,6 +61,9 @@ type WatchOptions struct {
 	// Specify a service to watch
 	// If blank, the watch is for all services
 	Service string
+	// Revision to resume from, changes after it are delivered.
+	// Only honored by versioned registries
+	Revision int64
 	// Other options for implementations of the interface
 	// can be stored in a context
 	Context context.Context
@@ -72,3 +75,17 @@ func WatchService(name string) WatchOption {
 		o.Service = name
 	}
 }
+
+// WatchRevision resumes a watch after the given revision
+func WatchRevision(rev int64) WatchOption {
+	return func(o *WatchOptions) {
+		o.Revision = rev
+	}
+}
+
+// WatchContext stops the watcher when ctx is done
+func WatchContext(ctx context.Context) WatchOption {
+	return func(o *WatchOptions) {
+		o.Context = ctx
+	}
+}
@@ -12,10 +12,23 @@ type Registry interface {
 	Deregister(*Service) error
 	GetService(string) ([]*Service, error)
 	ListServices() ([]*Service, error)
-	Watch(service string) (Watcher, error)
+	Watch(service string, opts ...WatchOption) (Watcher, error)
 	String() string
 }
 
+// Stopper is implemented by registries which own background goroutines
+// or connections, they are released by Stop
+type Stopper interface {
+	Stop()
+}
+
+// Stop releases the resources of r if it is a Stopper
+func Stop(r Registry) {
+	if s, ok := r.(Stopper); ok {
+		s.Stop()
+	}
+}
+
 type Option func(*Options)
 
 type RegisterOption func(*RegisterOptions)
@@ -23,5 +36,6 @@ type RegisterOption func(*RegisterOptions)
 type WatchOption func(*WatchOptions)
 
 var (
-	ErrNotFound = errors.New("not found")
+	ErrNotFound       = errors.New("not found")
+	ErrWatcherStopped = errors.New("watcher stopped")
 )
@@ -1,10 +1,11 @@
 package registry
 
 type Service struct {
-	Name     string            `json:"name"`
-	Version  string            `json:"version"`
-	Metadata map[string]string `json:"metadata"`
-	Nodes    []*Node           `json:"nodes"`
+	Name      string            `json:"name"`
+	Version   string            `json:"version"`
+	Metadata  map[string]string `json:"metadata"`
+	Endpoints []*Endpoint       `json:"endpoints"`
+	Nodes     []*Node           `json:"nodes"`
 }
 
 type Node struct {
@@ -13,3 +14,32 @@ type Node struct {
 	Port     int               `json:"port"`
 	Metadata map[string]string `json:"metadata"`
 }
+
+// Endpoint is a method exposed by the service on one protocol
+type Endpoint struct {
+	// Name full method for grpc e.g. /helloworld.Greeter/SayHello, "METHOD /path" for http
+	Name     string            `json:"name"`
+	Protocol string            `json:"protocol"`
+	Port     int               `json:"port"`
+	Request  *Value            `json:"request,omitempty"`
+	Response *Value            `json:"response,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// Value is the schema of a request/response message or one of its fields
+type Value struct {
+	Name   string   `json:"name"`
+	Type   string   `json:"type"`
+	Values []*Value `json:"values,omitempty"`
+}
+
+const (
+	ProtocolGRPC = "grpc"
+	ProtocolHTTP = "http"
+)
+
+// 节点位置的 metadata key
+const (
+	ZoneKey   = "zone"
+	RegionKey = "region"
+)
@@ -0,0 +1,19 @@
+package static
+
+import (
+	"context"
+
+	registry "github.com/aka-yz/go-micro-core/register"
+)
+
+type servicesKey struct{}
+
+// Services sets the static service table: service name -> ["host:port", ...]
+func Services(services map[string][]string) registry.Option {
+	return func(o *registry.Options) {
+		if o.Context == nil {
+			o.Context = context.Background()
+		}
+		o.Context = context.WithValue(o.Context, servicesKey{}, services)
+	}
+}
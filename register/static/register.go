@@ -0,0 +1,136 @@
+// Package static is a registry backed by a fixed service table,
+// for local development and deployments without etcd
+package static
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+
+	registry "github.com/aka-yz/go-micro-core/register"
+	"github.com/aka-yz/go-micro-core/register/notify"
+)
+
+type staticRegistry struct {
+	opts registry.Options
+
+	sync.RWMutex
+	services map[string][]*registry.Service
+	watchers notify.Watchers
+}
+
+// parseServices 将 name -> [host:port] 配置转换成 service
+func parseServices(table map[string][]string) (map[string][]*registry.Service, error) {
+	services := make(map[string][]*registry.Service, len(table))
+	for name, addrs := range table {
+		service := &registry.Service{Name: name}
+		for _, addr := range addrs {
+			host, p, err := net.SplitHostPort(addr)
+			if err != nil {
+				return nil, fmt.Errorf("static registry service:%v addr:%v error:%v", name, addr, err)
+			}
+			port, err := strconv.Atoi(p)
+			if err != nil {
+				return nil, fmt.Errorf("static registry service:%v addr:%v error:%v", name, addr, err)
+			}
+			service.Nodes = append(service.Nodes, &registry.Node{
+				Id:      name + "-" + addr,
+				Address: host,
+				Port:    port,
+			})
+		}
+		services[name] = []*registry.Service{service}
+	}
+	return services, nil
+}
+
+func (s *staticRegistry) Register(service *registry.Service, opts ...registry.RegisterOption) error {
+	s.Lock()
+	s.services[service.Name] = registry.Merge(s.services[service.Name], []*registry.Service{service})
+	s.Unlock()
+
+	s.sendEvent(&registry.Result{Action: registry.Create, Service: registry.CopyService(service)})
+	return nil
+}
+
+func (s *staticRegistry) Deregister(service *registry.Service) error {
+	s.Lock()
+	if services := registry.Remove(s.services[service.Name], []*registry.Service{service}); len(services) == 0 {
+		delete(s.services, service.Name)
+	} else {
+		s.services[service.Name] = services
+	}
+	s.Unlock()
+
+	s.sendEvent(&registry.Result{Action: registry.Delete, Service: registry.CopyService(service)})
+	return nil
+}
+
+func (s *staticRegistry) GetService(name string) ([]*registry.Service, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	services, ok := s.services[name]
+	if !ok || len(services) == 0 {
+		return nil, registry.ErrNotFound
+	}
+	return registry.Copy(services), nil
+}
+
+func (s *staticRegistry) ListServices() ([]*registry.Service, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	var services []*registry.Service
+	for _, service := range s.services {
+		services = append(services, registry.Copy(service)...)
+	}
+	return services, nil
+}
+
+func (s *staticRegistry) Watch(service string, opts ...registry.WatchOption) (registry.Watcher, error) {
+	wo := registry.WatchOptions{
+		Service: service,
+	}
+	for _, o := range opts {
+		o(&wo)
+	}
+
+	return s.watchers.Watch(wo), nil
+}
+
+func (s *staticRegistry) sendEvent(r *registry.Result) {
+	s.watchers.Send(r)
+}
+
+func (s *staticRegistry) String() string {
+	return "static"
+}
+
+func (s *staticRegistry) Options() registry.Options {
+	return s.opts
+}
+
+// NewRegistry 服务表中的地址不是 host:port 时返回错误
+func NewRegistry(opts ...registry.Option) (registry.Registry, error) {
+	var opt registry.Options
+	for _, o := range opts {
+		o(&opt)
+	}
+
+	var table map[string][]string
+	if opt.Context != nil {
+		table, _ = opt.Context.Value(servicesKey{}).(map[string][]string)
+	}
+
+	services, err := parseServices(table)
+	if err != nil {
+		return nil, err
+	}
+
+	return &staticRegistry{
+		opts:     opt,
+		services: services,
+	}, nil
+}
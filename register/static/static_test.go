@@ -0,0 +1,97 @@
+package static
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	registry "github.com/aka-yz/go-micro-core/register"
+)
+
+func TestStaticRegistry(t *testing.T) {
+	r, err := NewRegistry(Services(map[string][]string{
+		"foo-rpc": {"10.0.0.1:9000", "10.0.0.2:9000"},
+	}))
+	if err != nil {
+		t.Fatalf("Unexpected error creating registry: %v", err)
+	}
+
+	services, err := r.GetService("foo-rpc")
+	if err != nil {
+		t.Fatalf("Unexpected error getting service: %v", err)
+	}
+	if i := len(services[0].Nodes); i != 2 {
+		t.Fatalf("Expected 2 nodes, got %d: %+v", i, services[0].Nodes)
+	}
+
+	if _, err = r.GetService("bar-rpc"); err != registry.ErrNotFound {
+		t.Fatalf("Expected not found, got %v", err)
+	}
+
+	w, err := r.Watch("foo-rpc")
+	if err != nil {
+		t.Fatalf("Unexpected watch error: %v", err)
+	}
+	defer w.Stop()
+
+	node := &registry.Service{
+		Name:  "foo-rpc",
+		Nodes: []*registry.Node{{Id: "foo-rpc-3", Address: "10.0.0.3", Port: 9000}},
+	}
+	if err = r.Register(node); err != nil {
+		t.Fatalf("Unexpected register error: %v", err)
+	}
+
+	res, err := w.Next()
+	if err != nil {
+		t.Fatalf("Unexpected next error: %v", err)
+	}
+	if res.Action != registry.Create || res.Service.Nodes[0].Id != "foo-rpc-3" {
+		t.Fatalf("Unexpected result %+v", res)
+	}
+
+	services, _ = r.GetService("foo-rpc")
+	if i := len(services[0].Nodes); i != 3 {
+		t.Fatalf("Expected 3 nodes, got %d: %+v", i, services[0].Nodes)
+	}
+
+	if err = r.Deregister(node); err != nil {
+		t.Fatalf("Unexpected deregister error: %v", err)
+	}
+	services, _ = r.GetService("foo-rpc")
+	if i := len(services[0].Nodes); i != 2 {
+		t.Fatalf("Expected 2 nodes, got %d: %+v", i, services[0].Nodes)
+	}
+}
+
+func TestStaticRegistryBadAddr(t *testing.T) {
+	if _, err := NewRegistry(Services(map[string][]string{"foo-rpc": {"10.0.0.1"}})); err == nil {
+		t.Fatal("Expected error for address without port")
+	}
+}
+
+func TestStaticRegistrySlowWatcher(t *testing.T) {
+	r, err := NewRegistry()
+	if err != nil {
+		t.Fatalf("Unexpected error creating registry: %v", err)
+	}
+	defer registry.Stop(r)
+	// watcher 一直不读取
+	if _, err := r.Watch("foo-rpc"); err != nil {
+		t.Fatalf("Unexpected watch error: %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 100; i++ {
+			node := &registry.Node{Id: fmt.Sprint(i), Address: "10.0.0.1", Port: 9000 + i}
+			_ = r.Register(&registry.Service{Name: "foo-rpc", Nodes: []*registry.Node{node}})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Register blocked by a watcher which never reads")
+	}
+}
@@ -0,0 +1,112 @@
+package registry
+
+// CopyService make a copy of service
+func CopyService(service *Service) *Service {
+	s := new(Service)
+	*s = *service
+
+	s.Metadata = copyMetadata(service.Metadata)
+	if service.Endpoints != nil {
+		s.Endpoints = make([]*Endpoint, len(service.Endpoints))
+		copy(s.Endpoints, service.Endpoints)
+	}
+	s.Nodes = make([]*Node, len(service.Nodes))
+	for i, node := range service.Nodes {
+		n := new(Node)
+		*n = *node
+		n.Metadata = copyMetadata(node.Metadata)
+		s.Nodes[i] = n
+	}
+	return s
+}
+
+// Copy makes a copy of services
+func Copy(current []*Service) []*Service {
+	services := make([]*Service, len(current))
+	for i, service := range current {
+		services[i] = CopyService(service)
+	}
+	return services
+}
+
+// Merge merges two lists of services and returns a new copy,
+// services with the same version are merged node by node
+func Merge(olist []*Service, nlist []*Service) []*Service {
+	services := Copy(olist)
+	for _, n := range nlist {
+		var seen bool
+		for _, o := range services {
+			if o.Version == n.Version {
+				o.Nodes = addNodes(o.Nodes, CopyService(n).Nodes)
+				seen = true
+				break
+			}
+		}
+		if !seen {
+			services = append(services, CopyService(n))
+		}
+	}
+	return services
+}
+
+// Remove removes the nodes of the services in del from old and returns a new copy,
+// services left without any node are dropped
+func Remove(old, del []*Service) []*Service {
+	var services []*Service
+	for _, o := range Copy(old) {
+		for _, s := range del {
+			if o.Version == s.Version {
+				o.Nodes = delNodes(o.Nodes, s.Nodes)
+			}
+		}
+		if len(o.Nodes) > 0 {
+			services = append(services, o)
+		}
+	}
+	return services
+}
+
+func addNodes(old, neu []*Node) []*Node {
+	for _, n := range neu {
+		var seen bool
+		for i, o := range old {
+			if o.Id == n.Id {
+				seen = true
+				old[i] = n
+				break
+			}
+		}
+		if !seen {
+			old = append(old, n)
+		}
+	}
+	return old
+}
+
+func delNodes(old, del []*Node) []*Node {
+	var nodes []*Node
+	for _, o := range old {
+		var rem bool
+		for _, n := range del {
+			if o.Id == n.Id {
+				rem = true
+				break
+			}
+		}
+		if !rem {
+			nodes = append(nodes, o)
+		}
+	}
+	return nodes
+}
+
+func copyMetadata(md map[string]string) map[string]string {
+	if md == nil {
+		return nil
+	}
+	m := make(map[string]string, len(md))
+	for k, v := range md {
+		m[k] = v
+	}
+	return m
+}
@@ -5,12 +5,26 @@ package registry
 type Watcher interface {
 	// Next is a blocking call
 	Next() (*Result, error)
+	// Stop the watcher and release its resources,
+	// a blocking Next returns ErrWatcherStopped
 	Stop()
 }
 
+// Action is the kind of change carried by a Result
+type Action string
+
+const (
+	Create Action = "create"
+	Update Action = "update"
+	Delete Action = "delete"
+)
+
 // Result is returned by a call to Next on
 // the watcher. Actions can be created, update, delete
 type Result struct {
-	Action  string
+	Action  Action
 	Service *Service
+	// Revision of the change in a versioned registry (e.g. etcd),
+	// 0 when the registry is not versioned
+	Revision int64
 }
@@ -22,15 +22,6 @@ func init() {
 	}
 }
 
-func ListenAddr(port string, fn func(string) (net.Listener, error)) (string, net.Listener, error) {
-	ip, err := GetLocalIP()
-	if err != nil {
-		return "", nil, err
-	}
-	net, err := Listen(ip+port, fn)
-	return ip, net, err
-}
-
 // Listen takes addr:portmin-portmax and binds to the first available port
 // Example: Listen("localhost:5000-6000", fn)
 func Listen(addr string, fn func(string) (net.Listener, error)) (net.Listener, error) {
@@ -85,26 +76,32 @@ func Listen(addr string, fn func(string) (net.Listener, error)) (net.Listener, e
 	return nil, fmt.Errorf("unable to bind to %s", addr)
 }
 
-// GetLocalIP returns a real ip
-func GetLocalIP() (string, error) {
-	interfaces, err := net.Interfaces()
+// GetLocalIP returns a real ip. Without interfaces it prefers the private ipv4 of
+// the up and broadcast interfaces (docker excluded), then other global ipv4, then
+// global ipv6. With interfaces only the named ones are used, e.g. GetLocalIP("eth1").
+func GetLocalIP(interfaces ...string) (string, error) {
+	inters, err := net.Interfaces()
 	if err != nil {
 		return "", fmt.Errorf("Failed to get interfaces! Err: %v", err)
 	}
 	var addrs []net.Addr
-	for _, inter := range interfaces {
-
-		if inter.Flags&net.FlagUp != 0 && inter.Flags&net.FlagBroadcast != 0 && !strings.Contains(inter.Name, "docker") { //过滤出开启且支持广播的网卡，排除docker虚拟网卡
-			interAddrs, err := inter.Addrs()
-			if err != nil {
-				return "", fmt.Errorf("Failed to get interfaces addresses! Err: %v", err)
+	for _, inter := range inters {
+		if len(interfaces) > 0 {
+			if !contains(interfaces, inter.Name) || inter.Flags&net.FlagUp == 0 {
+				continue
 			}
-			addrs = append(addrs, interAddrs...)
+		} else if inter.Flags&net.FlagUp == 0 || inter.Flags&net.FlagBroadcast == 0 || strings.Contains(inter.Name, "docker") { //过滤出开启且支持广播的网卡，排除docker虚拟网卡
+			continue
+		}
+		interAddrs, err := inter.Addrs()
+		if err != nil {
+			return "", fmt.Errorf("Failed to get interfaces addresses! Err: %v", err)
 		}
+		addrs = append(addrs, interAddrs...)
 	}
 
-	var ipAddr []byte
-
+	// 按优先级: 私有 ipv4, 其他 ipv4, ipv6
+	var private, v4, v6 net.IP
 	for _, rawAddr := range addrs {
 		var ip net.IP
 		switch addr := rawAddr.(type) {
@@ -116,23 +113,90 @@ func GetLocalIP() (string, error) {
 			continue
 		}
 
-		if ip.To4() == nil {
-			continue
+		if ip.To4() != nil {
+			if private == nil && IsPrivateIP(ip.String()) {
+				private = ip
+			} else if v4 == nil && (ip.IsGlobalUnicast() || len(interfaces) > 0) {
+				v4 = ip
+			}
+		} else if v6 == nil && (ip.IsGlobalUnicast() || len(interfaces) > 0) && !ip.IsLinkLocalUnicast() {
+			v6 = ip
 		}
+	}
 
-		if !IsPrivateIP(ip.String()) {
-			continue
+	for _, ip := range []net.IP{private, v4, v6} {
+		if ip != nil {
+			return ip.String(), nil
 		}
+	}
+	if len(interfaces) > 0 {
+		return "", fmt.Errorf("No IP address found on interfaces %v", interfaces)
+	}
+	return "", fmt.Errorf("No IP address found, and explicit IP not provided")
+}
 
-		ipAddr = ip
-		break
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseAddr splits the network from the address: "unix:///tmp/x.sock" and
+// "unix:/tmp/x.sock" are unix sockets, "tcp://host:port" and "host:port" are tcp
+func ParseAddr(addr string) (network, address string) {
+	for _, network := range []string{"unix", "tcp"} {
+		if strings.HasPrefix(addr, network+"://") {
+			return network, strings.TrimPrefix(addr, network+"://")
+		}
+		if strings.HasPrefix(addr, network+":") {
+			return network, strings.TrimPrefix(addr, network+":")
+		}
+	}
+	return "tcp", addr
+}
+
+// AdvertiseAddr returns the host and port to register. advertise is a host or
+// host:port, the port defaults to the first tcp addr. Without a host the ip of the
+// tcp addr is used, or a local ip of interfaces when it binds all interfaces.
+func AdvertiseAddr(advertise string, interfaces []string, addrs ...net.Addr) (string, int, error) {
+	var tcp *net.TCPAddr
+	for _, addr := range addrs {
+		if a, ok := addr.(*net.TCPAddr); ok {
+			tcp = a
+			break
+		}
 	}
 
-	if ipAddr == nil {
-		return "", fmt.Errorf("No private IP address found, and explicit IP not provided")
+	host := advertise
+	port := 0
+	if h, p, err := net.SplitHostPort(host); err == nil {
+		host = h
+		port, _ = strconv.Atoi(p)
+	} else if ip := net.ParseIP(strings.Trim(host, "[]")); ip != nil {
+		host = ip.String()
+	}
+	if port == 0 {
+		if tcp == nil {
+			return "", 0, fmt.Errorf("no tcp listener to advertise")
+		}
+		port = tcp.Port
+	}
+	if host != "" {
+		return host, port, nil
 	}
 
-	return net.IP(ipAddr).String(), nil
+	// 监听指定 ip 时注册该 ip, 监听所有网卡时选择本机 ip
+	if tcp != nil && len(tcp.IP) > 0 && !tcp.IP.IsUnspecified() {
+		return tcp.IP.String(), port, nil
+	}
+	ip, err := GetLocalIP(interfaces...)
+	if err != nil {
+		return "", 0, err
+	}
+	return ip, port, nil
 }
 
 func IsPrivateIP(ipAddr string) bool {